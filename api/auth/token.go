@@ -13,11 +13,14 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// TokenLifetime is how long an access token stays valid after it is issued
+const TokenLifetime = time.Hour * 1
+
 func CreateToken(user_id uint32) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = user_id
-	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
+	claims["exp"] = time.Now().Add(TokenLifetime).Unix()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("API_SECRET")))
 
@@ -54,8 +57,12 @@ func ExtractToken(r *http.Request) string {
 }
 
 func ExtractTokenID(r *http.Request) (uint32, error) {
+	return ParseTokenID(ExtractToken(r))
+}
 
-	tokenString := ExtractToken(r)
+// ParseTokenID returns the id of the user an access token was issued to, for
+// tokens sent outside of HTTP requests such as gRPC metadata
+func ParseTokenID(tokenString string) (uint32, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
@@ -41,9 +41,7 @@ func (server *Server) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	responses.AUTH_JSON(w, http.StatusOK, user, map[string]string{
-		"token": token,
-	})
+	responses.AUTH_JSON(w, http.StatusOK, user.SelfView(), token, auth.TokenLifetime)
 }
 
 func (server *Server) Register(w http.ResponseWriter, r *http.Request) {
@@ -74,9 +72,7 @@ func (server *Server) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	responses.AUTH_JSON(w, http.StatusCreated, userCreated, map[string]string{
-		"token": token,
-	})
+	responses.AUTH_JSON(w, http.StatusCreated, userCreated.SelfView(), token, auth.TokenLifetime)
 }
 
 func (server *Server) SignIn(email, password string) (string, error) {
@@ -95,3 +91,29 @@ func (server *Server) SignIn(email, password string) (string, error) {
 	}
 	return auth.CreateToken(user.ID)
 }
+
+// currentUser returns the user the request's token belongs to, or nil for
+// anonymous requests and invalid tokens
+func (server *Server) currentUser(r *http.Request) *models.User {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil || uid == 0 {
+		return nil
+	}
+
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return nil
+	}
+	return &user
+}
+
+// viewerID returns the id of the user the request's token belongs to, or 0
+// for anonymous requests and invalid tokens
+func viewerID(r *http.Request) uint32 {
+	uid, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return 0
+	}
+	return uid
+}
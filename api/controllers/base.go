@@ -1,19 +1,55 @@
 package controllers
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/jobs"
 	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/realtime"
+	"github.com/rizalreza/golang-restful/api/search"
+	"github.com/rizalreza/golang-restful/api/sse"
+	"github.com/rizalreza/golang-restful/api/storage"
 )
 
+// shutdownTimeout is how long requests in flight get to finish on shutdown
+const shutdownTimeout = 15 * time.Second
+
 type Server struct {
 	DB     *gorm.DB
 	Router *mux.Router
+	// Search is picked for the database on first use when not set
+	Search     search.Engine
+	searchOnce sync.Once
+	// Blobs keeps uploaded media, files under ./media when not set
+	Blobs     storage.BlobStore
+	blobsOnce sync.Once
+	// Events carries what users do to the features that react to it, a new
+	// bus when not set
+	Events     *events.Bus
+	eventsOnce sync.Once
+	// WebhookClient sends webhook deliveries, with a 10 second timeout when
+	// not set
+	WebhookClient *http.Client
+	// Stream feeds GET /events
+	Stream     *sse.Broker
+	streamOnce sync.Once
+	// Realtime keeps the rooms of GET /live, sharing them through a
+	// LocalBroadcaster when not set. Instances behind a load balancer need a
+	// hub with a broadcaster reaching the others.
+	Realtime     *realtime.Hub
+	realtimeOnce sync.Once
+	// GRPCAddress is where Run serves the gRPC API, which is off when empty
+	GRPCAddress string
 }
 
 func (server *Server) Initialize(Driver, User, Password, Port, Host, Name string) {
@@ -41,12 +77,94 @@ func (server *Server) Initialize(Driver, User, Password, Port, Host, Name string
 		}
 	}
 
-	server.DB.Debug().AutoMigrate(&models.User{}, &models.Post{})
+	server.DB.Debug().AutoMigrate(models.All()...)
+	err = models.BackfillSlugs(server.DB)
+	if err != nil {
+		log.Printf("Cannot backfill slugs: %v", err)
+	}
+	err = models.MigratePostContent(server.DB)
+	if err != nil {
+		log.Printf("Cannot migrate post content: %v", err)
+	}
+	err = models.BackfillPublishedAt(server.DB)
+	if err != nil {
+		log.Printf("Cannot backfill publication dates: %v", err)
+	}
+	err = search.Migrate(server.DB)
+	if err != nil {
+		log.Printf("Cannot create the search index: %v", err)
+	}
+	server.InitializeRouter()
+}
+
+// InitializeRouter creates the router and registers every route on it
+func (server *Server) InitializeRouter() {
 	server.Router = mux.NewRouter()
 	server.initializeRoutes()
 }
 
-func (server *Server) Run(address string) {
+// StartJobs runs the background jobs until ctx is done
+func (server *Server) StartJobs(ctx context.Context) {
+	jobs.Every(ctx, time.Minute, "publish scheduled posts", server.PublishDuePosts)
+	jobs.Every(ctx, 5*time.Second, "deliver webhooks", server.DeliverWebhooks)
+	jobs.Every(ctx, time.Hour, "prune webhook deliveries", func(ctx context.Context) error {
+		return models.PruneDeliveries(server.DB, time.Now().Add(-models.DeliveryRetention))
+	})
+	jobs.Every(ctx, time.Hour, "purge trash", func(ctx context.Context) error {
+		before := time.Now().Add(-models.TrashRetention)
+		unused, err := models.PurgeUserMedia(server.DB, before)
+		if err != nil {
+			return err
+		}
+		server.deleteBlobs(unused)
+		_, err = models.PurgeTrash(server.DB, before)
+		return err
+	})
+}
+
+// Run serves the API on address, and the gRPC API on GRPCAddress, until ctx
+// is done, then shuts down gracefully: the event streams and WebSockets are
+// ended and requests in flight get up to shutdownTimeout to finish.
+func (server *Server) Run(ctx context.Context, address string) {
+	httpServer := &http.Server{Addr: address, Handler: server.Router}
+	httpServer.RegisterOnShutdown(server.streamBroker().Close)
+	httpServer.RegisterOnShutdown(server.realtimeHub().Close)
+
+	grpcStopped := make(chan struct{})
+	if server.GRPCAddress == "" {
+		close(grpcStopped)
+	} else {
+		lis, err := net.Listen("tcp", server.GRPCAddress)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			defer close(grpcStopped)
+			err := server.ServeGRPC(ctx, lis)
+			if err != nil {
+				log.Printf("Cannot serve gRPC: %v", err)
+			}
+		}()
+		fmt.Printf("Serving gRPC on %s\n", server.GRPCAddress)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := httpServer.Shutdown(shutdownCtx)
+		if err != nil {
+			log.Printf("Cannot shut down gracefully: %v", err)
+		}
+	}()
+
 	fmt.Println("Listening to port 8090")
-	log.Fatal(http.ListenAndServe(address, server.Router))
+	err := httpServer.ListenAndServe()
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+	<-grpcStopped
 }
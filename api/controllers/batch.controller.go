@@ -0,0 +1,358 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+const (
+	// maxBatchItems is how many items a batch request may carry
+	maxBatchItems = 500
+	// maxBatchBytes is how large the body of a batch request may be
+	maxBatchBytes = 16 << 20
+)
+
+// Modes of batches
+const (
+	// batchAllOrNothing saves every item in one transaction, or none of
+	// them when one fails
+	batchAllOrNothing = "all_or_nothing"
+	// batchPartial saves every item on its own, whatever became of the others
+	batchPartial = "partial"
+)
+
+// Actions of batch items
+const (
+	batchCreate = "create"
+	batchUpdate = "update"
+	batchDelete = "delete"
+)
+
+var errRolledBack = errors.New("Rolled back, as another item of the batch failed")
+
+// batchRequest is the body of a batch request. Items are decoded one by one
+// so a malformed item fails on its own.
+type batchRequest struct {
+	Mode  string            `json:"mode"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// postBatchBody and categoryBatchBody document the bodies of the batch
+// endpoints, which are read as a batchRequest
+type postBatchBody struct {
+	// Mode is all_or_nothing (default) or partial
+	Mode  string          `json:"mode,omitempty"`
+	Items []postBatchItem `json:"items"`
+}
+
+type categoryBatchBody struct {
+	// Mode is all_or_nothing (default) or partial
+	Mode  string              `json:"mode,omitempty"`
+	Items []categoryBatchItem `json:"items"`
+}
+
+// batchResult is what became of the item at Index: the status it would have
+// had as a request of its own, the ID of its resource and its error
+type batchResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	ID     uint64 `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// batchResponse holds the results of a batch, in the order of its items
+type batchResponse struct {
+	Mode    string        `json:"mode"`
+	Results []batchResult `json:"results"`
+}
+
+// batchApply does one item of a batch with tx, returning the status and ID
+// of the resource it leaves
+type batchApply func(tx *Server, item json.RawMessage) (int, uint64, error)
+
+// inTransaction runs do with a server whose actions share one transaction,
+// committed when do succeeds. The events they publish are held back until
+// then, so nothing hears of changes that were rolled back.
+func (server *Server) inTransaction(do func(tx *Server) error) error {
+	pending := []events.Event{}
+	held := events.NewBus()
+	held.Subscribe(func(e events.Event) {
+		pending = append(pending, e)
+	})
+	tx := &Server{DB: server.DB.Begin(), Events: held}
+	if tx.DB.Error != nil {
+		return tx.DB.Error
+	}
+	// Keeps eventBus from subscribing the features to the held events
+	tx.eventsOnce.Do(func() {})
+
+	err := do(tx)
+	if err != nil {
+		tx.DB.Rollback()
+		return err
+	}
+	err = tx.DB.Commit().Error
+	if err != nil {
+		return err
+	}
+	for _, e := range pending {
+		server.eventBus().Publish(e)
+	}
+	return nil
+}
+
+// runBatch reads a batch from r, applies its items and writes their results.
+// The batch is answered with 200 when every item succeeded, 207 when some of
+// a partial batch failed and 422 when an all or nothing batch was rolled back.
+func (server *Server) runBatch(w http.ResponseWriter, r *http.Request, apply batchApply) {
+	tooLarge := fmt.Errorf("Batch Too Large, the limit is %d bytes", maxBatchBytes)
+	if r.ContentLength > maxBatchBytes {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBytes)
+	request := batchRequest{}
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid batch, expected a JSON body with mode and items"))
+		return
+	}
+
+	if request.Mode == "" {
+		request.Mode = batchAllOrNothing
+	}
+	if request.Mode != batchAllOrNothing && request.Mode != batchPartial {
+		responses.ERROR(w, http.StatusBadRequest, fmt.Errorf("mode must be %s or %s", batchAllOrNothing, batchPartial))
+		return
+	}
+	if len(request.Items) == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Required items"))
+		return
+	}
+	if len(request.Items) > maxBatchItems {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, fmt.Errorf("Batch Too Large, the limit is %d items", maxBatchItems))
+		return
+	}
+
+	results := make([]batchResult, len(request.Items))
+	record := func(i int, status int, id uint64, err error) {
+		results[i] = batchResult{Index: i, Status: status, ID: id}
+		if err != nil {
+			results[i] = batchResult{Index: i, Status: errorStatus(err), Error: err.Error()}
+		}
+	}
+
+	failed := false
+	if request.Mode == batchPartial {
+		for i, item := range request.Items {
+			var status int
+			var id uint64
+			err := server.inTransaction(func(tx *Server) (err error) {
+				status, id, err = apply(tx, item)
+				return err
+			})
+			record(i, status, id, err)
+			failed = failed || err != nil
+		}
+	} else {
+		// Every item is tried, so the errors of all of them are told at once.
+		// Each runs in a savepoint rolled back to when it fails, since some
+		// databases refuse any other statement in a transaction with an
+		// error.
+		err := server.inTransaction(func(tx *Server) error {
+			for i, item := range request.Items {
+				err := tx.DB.Exec("SAVEPOINT batch_item").Error
+				if err != nil {
+					return err
+				}
+				status, id, err := apply(tx, item)
+				record(i, status, id, err)
+				if err != nil {
+					failed = true
+					err = tx.DB.Exec("ROLLBACK TO SAVEPOINT batch_item").Error
+				} else {
+					err = tx.DB.Exec("RELEASE SAVEPOINT batch_item").Error
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if failed {
+				return errRolledBack
+			}
+			return nil
+		})
+		if err == errRolledBack {
+			for i := range results {
+				if results[i].Error == "" {
+					results[i] = batchResult{Index: i, Status: http.StatusFailedDependency, Error: err.Error()}
+				}
+			}
+		} else if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	status := http.StatusOK
+	if failed && request.Mode == batchPartial {
+		status = http.StatusMultiStatus
+	} else if failed {
+		status = http.StatusUnprocessableEntity
+	}
+	responses.JSON(w, status, batchResponse{Mode: request.Mode, Results: results})
+}
+
+// decodeBatchItem decodes item into v, with an error telling what is wrong
+// with it
+func decodeBatchItem(item json.RawMessage, v interface{}) error {
+	err := json.Unmarshal(item, v)
+	if err != nil {
+		return withStatus(http.StatusUnprocessableEntity, fmt.Errorf("Invalid item: %v", err))
+	}
+	return nil
+}
+
+// unknownBatchAction is the error of items whose action is none of those of
+// batches
+func unknownBatchAction(action string) error {
+	return withStatus(http.StatusUnprocessableEntity, fmt.Errorf("Unknown action: %s, expected %s, %s or %s", action, batchCreate, batchUpdate, batchDelete))
+}
+
+// postBatchItem is an item of POST /posts:batch. Posts are created for the
+// authenticated user, and their tags are left as they are when tags is
+// absent.
+type postBatchItem struct {
+	// Action is create (default), update or delete
+	Action string `json:"action,omitempty"`
+	// ID is the post to update or delete
+	ID uint64 `json:"id,omitempty"`
+	// Title, Content (Markdown) and CategoryID are needed to create and
+	// update posts
+	Title      string `json:"title,omitempty"`
+	Content    string `json:"content,omitempty"`
+	CategoryID uint32 `json:"category_id,omitempty"`
+	// Status is draft (default), published or scheduled; only on create
+	Status      string     `json:"status,omitempty"`
+	PublishedAt *time.Time `json:"published_at,omitempty"`
+	Tags        *[]string  `json:"tags,omitempty"`
+}
+
+// BatchPosts creates, updates and deletes the posts of the authenticated
+// user in one request
+func (server *Server) BatchPosts(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	server.runBatch(w, r, func(tx *Server, raw json.RawMessage) (int, uint64, error) {
+		item := postBatchItem{Action: batchCreate}
+		err := decodeBatchItem(raw, &item)
+		if err != nil {
+			return 0, 0, err
+		}
+		in := postInput{
+			Title:       item.Title,
+			Content:     item.Content,
+			AuthorID:    user.ID,
+			CategoryID:  item.CategoryID,
+			Status:      item.Status,
+			PublishedAt: item.PublishedAt,
+		}
+		if item.Tags != nil {
+			in.Tags, in.SetTags = *item.Tags, true
+		}
+
+		switch item.Action {
+		case batchCreate:
+			post, err := tx.createPost(user.ID, in, nil)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusCreated, post.ID, nil
+		case batchUpdate:
+			post, err := tx.updatePost(user.ID, item.ID, in, nil)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusOK, post.ID, nil
+		case batchDelete:
+			err := tx.deletePost(user.ID, item.ID)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusNoContent, item.ID, nil
+		}
+		return 0, 0, unknownBatchAction(item.Action)
+	})
+}
+
+// categoryBatchItem is an item of POST /category:batch. A parent_id of 0
+// makes a root category, and updates keep the parent when it is absent.
+type categoryBatchItem struct {
+	// Action is create (default), update or delete
+	Action string `json:"action,omitempty"`
+	// ID is the category to update or delete
+	ID uint32 `json:"id,omitempty"`
+	// Name is needed to create and update categories
+	Name     string  `json:"name,omitempty"`
+	ParentID *uint32 `json:"parent_id,omitempty"`
+}
+
+// BatchCategories creates, updates and deletes categories in one request.
+// As with their own endpoints, anyone may create categories but only
+// authenticated users change or delete them.
+func (server *Server) BatchCategories(w http.ResponseWriter, r *http.Request) {
+	uid := viewerID(r)
+	server.runBatch(w, r, func(tx *Server, raw json.RawMessage) (int, uint64, error) {
+		item := categoryBatchItem{Action: batchCreate}
+		err := decodeBatchItem(raw, &item)
+		if err != nil {
+			return 0, 0, err
+		}
+		in := categoryInput{Name: item.Name}
+		if item.ParentID != nil {
+			in.SetParent = true
+			if *item.ParentID != 0 {
+				in.ParentID = item.ParentID
+			}
+		}
+		if item.Action != batchCreate && uid == 0 {
+			return 0, 0, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+		}
+
+		switch item.Action {
+		case batchCreate:
+			category, err := tx.createCategory(uid, in)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusCreated, uint64(category.ID), nil
+		case batchUpdate:
+			category, err := tx.updateCategory(uid, item.ID, in)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusOK, uint64(category.ID), nil
+		case batchDelete:
+			err := tx.deleteCategory(uid, item.ID)
+			if err != nil {
+				return 0, 0, err
+			}
+			return http.StatusNoContent, uint64(item.ID), nil
+		}
+		return 0, 0, unknownBatchAction(item.Action)
+	})
+}
@@ -7,32 +7,86 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
 	"github.com/rizalreza/golang-restful/api/models"
 	"github.com/rizalreza/golang-restful/api/responses"
 	"github.com/rizalreza/golang-restful/api/utils/formaterror"
 )
 
-func (server *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
-	category := models.Category{}
+// formParentID reads the optional parent_id form field: empty or 0 for a
+// root category, absent to keep current
+func formParentID(r *http.Request, current *uint32) (*uint32, error) {
+	value := r.FormValue("parent_id")
+	if _, ok := r.Form["parent_id"]; !ok {
+		return current, nil
+	}
+	if value == "" || value == "0" {
+		return nil, nil
+	}
+	pid, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, errors.New("Invalid parent_id")
+	}
+	parentID := uint32(pid)
+	return &parentID, nil
+}
 
-	category.Name = r.FormValue("name")
+// categoryInput is a category as sent to create or update it
+type categoryInput struct {
+	Name string
+	// ParentID replaces the parent of the category when SetParent is true
+	ParentID  *uint32
+	SetParent bool
+}
+
+// formCategory reads a category from the form of r
+func formCategory(r *http.Request) (categoryInput, error) {
+	in := categoryInput{Name: r.FormValue("name")}
+	_, in.SetParent = r.Form["parent_id"]
+	var err error
+	in.ParentID, err = formParentID(r, nil)
+	return in, err
+}
+
+// createCategory saves a new category on behalf of user actor
+func (server *Server) createCategory(actor uint32, in categoryInput) (*models.Category, error) {
+	category := models.Category{}
+	category.Name = in.Name
+	category.ParentID = in.ParentID
 
 	category.Prepare()
 	err := category.Validate()
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
 	}
 
 	categoryCreated, err := category.SaveCategory(server.DB)
+	if err == models.ErrCategoryNotFound {
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
+	}
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return nil, formaterror.FormatError(err.Error())
+	}
+
+	server.eventBus().Publish(events.Event{Type: events.CategoryCreated, ActorID: actor, CategoryID: categoryCreated.ID, Data: categoryCreated})
+	return categoryCreated, nil
+}
+
+func (server *Server) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	in, err := formCategory(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
+	categoryCreated, err := server.createCategory(viewerID(r), in)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, categoryCreated.ID))
-	responses.JSON(w, http.StatusCreated, categoryCreated)
+	responses.SPARSE_JSON(w, r, http.StatusCreated, categoryCreated)
 }
 
 func (server *Server) GetCategories(w http.ResponseWriter, r *http.Request) {
@@ -43,88 +97,142 @@ func (server *Server) GetCategories(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, categories)
+	responses.SPARSE_JSON(w, r, http.StatusOK, categories)
 }
 
-func (server *Server) GetCategoryById(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+// GetCategoryTree returns the root categories with their subcategories
+// nested under children
+func (server *Server) GetCategoryTree(w http.ResponseWriter, r *http.Request) {
+	category := models.Category{}
+
+	tree, err := category.GetCategoryTree(server.DB)
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, tree)
+}
+
+// GetCategoryById looks the category up by ID or by slug, with the
+// breadcrumbs leading to it. An old slug redirects to the current one.
+func (server *Server) GetCategoryById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
 
 	category := models.Category{}
-	categoryRecieved, err := category.FindCategoryById(server.DB, uint32(cid))
+	var categoryRecieved *models.Category
+	if cid, err := strconv.ParseUint(vars["id"], 10, 32); err == nil {
+		categoryRecieved, err = category.FindCategoryById(server.DB, uint32(cid))
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		categoryRecieved, err = category.FindCategoryBySlug(server.DB, vars["id"])
+		if gorm.IsRecordNotFoundError(err) && server.redirectSlug(w, r, models.SlugCategory, vars["id"]) {
+			return
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusNotFound, errors.New("Category not found"))
+			return
+		}
+	}
+	err := categoryRecieved.LoadBreadcrumbs(server.DB)
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, categoryRecieved)
+	responses.SPARSE_JSON(w, r, http.StatusOK, categoryRecieved)
+}
+
+// updateCategory changes category cid on behalf of user actor
+func (server *Server) updateCategory(actor uint32, cid uint32, in categoryInput) (*models.Category, error) {
+	category := models.Category{}
+	err := server.DB.Debug().Model(models.Category{}).Where("id = ?", cid).Take(&category).Error
+	if err != nil {
+		return nil, withStatus(http.StatusNotFound, errors.New("Category not found"))
+	}
+
+	categoryUpdate := models.Category{}
+	categoryUpdate.Name = in.Name
+	categoryUpdate.ParentID = category.ParentID
+	if in.SetParent {
+		categoryUpdate.ParentID = in.ParentID
+	}
+
+	categoryUpdate.Prepare()
+	err = categoryUpdate.Validate()
+	if err != nil {
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
+	}
+
+	categoryUpdated, err := categoryUpdate.UpdateCategory(server.DB, cid)
+	if err == models.ErrCategoryCycle || err == models.ErrCategoryNotFound {
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
+	}
+	if err != nil {
+		return nil, formaterror.FormatError(err.Error())
+	}
+	categoryUpdated.ID = cid
+
+	server.eventBus().Publish(events.Event{Type: events.CategoryUpdated, ActorID: actor, CategoryID: categoryUpdated.ID, Data: categoryUpdated})
+	return categoryUpdated, nil
 }
 
 func (server *Server) UpdateCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
 	// Check if category id is valid
-	cid, err := strconv.ParseUint(vars["id"], 10, 64)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	category := models.Category{}
-	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", cid).Take(&category).Error
+	in, err := formCategory(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Category not found"))
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	categoryUpdate := models.Category{}
-	categoryUpdate.Name = r.FormValue("name")
-
-	categoryUpdate.Prepare()
-	err = categoryUpdate.Validate()
+	categoryUpdated, err := server.updateCategory(viewerID(r), uint32(cid), in)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		writeError(w, err)
 		return
 	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, categoryUpdated)
+}
 
-	categoryUpdated, err := categoryUpdate.UpdateCategory(server.DB, uint32(cid))
-	categoryUpdated.ID = uint32(cid)
-
+// deleteCategory moves category cid to the trash on behalf of user actor
+func (server *Server) deleteCategory(actor uint32, cid uint32) error {
+	category := models.Category{}
+	err := server.DB.Debug().Model(models.Category{}).Where("id = ?", cid).Take(&category).Error
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+		return withStatus(http.StatusNotFound, errors.New("Data not found"))
 	}
 
-	responses.JSON(w, http.StatusOK, categoryUpdated)
+	_, err = category.DeleteCategory(server.DB, cid)
+	if err != nil {
+		return withStatus(http.StatusBadRequest, err)
+	}
 
+	server.eventBus().Publish(events.Event{Type: events.CategoryDeleted, ActorID: actor, CategoryID: category.ID, Data: &category})
+	return nil
 }
 
 func (server *Server) DeleteCategory(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	cid, err := strconv.ParseUint(vars["id"], 10, 64)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	// Check if the post exist
-	category := models.Category{}
-	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", cid).Take(&category).Error
-	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Data not found"))
-		return
-	}
 
-	_, err = category.DeleteCategory(server.DB, uint32(cid))
+	err = server.deleteCategory(viewerID(r), uint32(cid))
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
+		writeError(w, err)
 		return
 	}
-
 	w.Header().Set("Entity", fmt.Sprintf("%d", cid))
 	responses.JSON(w, http.StatusNoContent, "")
 }
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/utils/formaterror"
+)
+
+func (server *Server) GetPostComments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(viewerID(r)) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+
+	comment := models.Comment{}
+	comments, err := comment.GetPostComments(server.DB, pid, viewerID(r))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, comments)
+}
+
+func (server *Server) CreateComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(user.ID) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+
+	comment := models.Comment{}
+	comment.Body = r.FormValue("body")
+
+	comment.Prepare()
+	comment.PostID = pid
+	comment.AuthorID = user.ID
+	comment.Status = models.InitialCommentStatus(user)
+
+	if parent := r.FormValue("parent_id"); parent != "" {
+		parentID, err := strconv.ParseUint(parent, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		comment.ParentID = &parentID
+	}
+
+	err = comment.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	commentCreated, err := comment.SaveComment(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishComment(commentCreated, post.AuthorID)
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, commentCreated.ID))
+	responses.SPARSE_JSON(w, r, http.StatusCreated, commentCreated)
+}
+
+func (server *Server) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	// Check if the comment exist
+	comment := models.Comment{}
+	err = server.DB.Debug().Model(models.Comment{}).Where("id = ?", cid).Take(&comment).Error
+	if err != nil || comment.Status == models.CommentDeleted {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Comment not found"))
+		return
+	}
+
+	// Only the author can edit a comment
+	if user.ID != comment.AuthorID {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	commentUpdate := models.Comment{}
+	commentUpdate.Body = r.FormValue("body")
+
+	commentUpdate.Prepare()
+	commentUpdate.ID = comment.ID
+	commentUpdate.PostID = comment.PostID
+	commentUpdate.AuthorID = comment.AuthorID
+	commentUpdate.Status = models.EditedCommentStatus(user, comment.Status)
+	err = commentUpdate.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	commentUpdated, err := commentUpdate.UpdateComment(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, commentUpdated)
+}
+
+func (server *Server) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	// Check if the comment exist
+	comment := models.Comment{}
+	err = server.DB.Debug().Model(models.Comment{}).Where("id = ?", cid).Take(&comment).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Comment not found"))
+		return
+	}
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", comment.PostID).Take(&post).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+
+	// The comment author, the post author and moderators can delete a comment
+	if user.ID != comment.AuthorID && user.ID != post.AuthorID && !user.IsModerator() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	_, err = comment.DeleteComment(server.DB, cid)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", cid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) GetPendingComments(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil || !user.IsModerator() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	comment := models.Comment{}
+	comments, err := comment.GetPendingComments(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, comments)
+}
+
+func (server *Server) ApproveComment(w http.ResponseWriter, r *http.Request) {
+	server.moderateComment(w, r, models.CommentApproved)
+}
+
+func (server *Server) RejectComment(w http.ResponseWriter, r *http.Request) {
+	server.moderateComment(w, r, models.CommentRejected)
+}
+
+// moderateComment lets a moderator decide on a pending comment
+func (server *Server) moderateComment(w http.ResponseWriter, r *http.Request, status string) {
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil || !user.IsModerator() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	comment := models.Comment{}
+	err = server.DB.Debug().Model(models.Comment{}).Where("id = ?", cid).Take(&comment).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Comment not found"))
+		return
+	}
+	if comment.Status != models.CommentPending {
+		responses.ERROR(w, http.StatusConflict, errors.New("Comment is not pending"))
+		return
+	}
+
+	commentModerated, err := comment.SetCommentStatus(server.DB, cid, status)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", commentModerated.PostID).Take(&post).Error
+	if err == nil {
+		server.publishComment(commentModerated, post.AuthorID)
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, commentModerated)
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/openapi"
+	"github.com/rizalreza/golang-restful/api/responses"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// swaggerUI renders /openapi.json with the Swagger UI bundle served by
+// DocsAsset, so the page needs nothing from other hosts
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+	<meta charset="utf-8">
+	<title>golang-restful API</title>
+	<link rel="stylesheet" href="/docs/swagger-ui.css">
+</head>
+<body>
+	<div id="swagger-ui"></div>
+	<script src="/docs/swagger-ui-bundle.js"></script>
+	<script>
+		window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+	</script>
+</body>
+</html>
+`
+
+// OpenAPIDocument describes every registered route: the v1 routes, their
+// deprecated unversioned aliases and the documentation routes
+func (server *Server) OpenAPIDocument() *openapi.Document {
+	builder := openapi.NewBuilder(openapi.Info{
+		Title:       "golang-restful",
+		Version:     "1",
+		Description: "Users, categories and posts. Request bodies are form-data.",
+	})
+	// Authors always encode as their public profile, see models.Author
+	builder.Alias(models.Author{}, models.PublicUser{})
+
+	for _, rt := range server.routes() {
+		doc := rt.Doc
+		doc.Method = rt.Method
+		doc.Path = "/api/v1" + rt.Path
+		builder.Add(doc)
+
+		doc.Path = rt.Path
+		doc.Deprecated = true
+		builder.Add(doc)
+	}
+	for _, rt := range server.docRoutes() {
+		doc := rt.Doc
+		doc.Method = rt.Method
+		doc.Path = rt.Path
+		builder.Add(doc)
+	}
+	return builder.Document()
+}
+
+func (server *Server) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	responses.JSON(w, http.StatusOK, server.OpenAPIDocument())
+}
+
+func (server *Server) Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, swaggerUI)
+}
+
+// docsAssets are the files of the Swagger UI distribution that /docs loads.
+// They are embedded in the binary by github.com/swaggo/files, whose version
+// in go.mod pins the one of Swagger UI.
+var docsAssets = map[string]bool{
+	"swagger-ui.css":       true,
+	"swagger-ui-bundle.js": true,
+}
+
+func (server *Server) DocsAsset(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	if !docsAssets[file] {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFileFS(w, r, swaggerFiles.FS, file)
+}
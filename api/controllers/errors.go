@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// statusError is an error of an action shared by the REST handlers and the
+// other APIs, with the HTTP status it stands for
+type statusError struct {
+	status int
+	err    error
+}
+
+func withStatus(status int, err error) error {
+	return &statusError{status: status, err: err}
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+// Extensions tells GraphQL clients the status of the error
+func (e *statusError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"status": e.status}
+}
+
+// errorStatus returns the HTTP status of err, 500 when it has none
+func errorStatus(err error) int {
+	if e, ok := err.(*statusError); ok {
+		return e.status
+	}
+	return http.StatusInternalServerError
+}
+
+// writeError writes err with its status
+func writeError(w http.ResponseWriter, err error) {
+	responses.ERROR(w, errorStatus(err), err)
+}
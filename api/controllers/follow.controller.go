@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+const (
+	pageLimit    = 20
+	maxPageLimit = 100
+)
+
+// pageParams reads the cursor and limit query parameters of a paginated list
+func pageParams(r *http.Request) (*models.Cursor, int, error) {
+	var cursor *models.Cursor
+	if value := r.URL.Query().Get("cursor"); value != "" {
+		var err error
+		cursor, err = models.ParseCursor(value)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	limit, err := queryUint(r, "limit", 32)
+	if err != nil {
+		return nil, 0, err
+	}
+	if limit == 0 || limit > maxPageLimit {
+		limit = pageLimit
+	}
+	return cursor, int(limit), nil
+}
+
+// pageLinks returns the meta and links of a page ending at next, which is
+// nil on the last page
+func pageLinks(r *http.Request, limit int, next *models.Cursor) (responses.Meta, responses.Links) {
+	meta := responses.Meta{"limit": limit, "next_cursor": nil}
+	links := responses.Links{"self": r.URL.RequestURI()}
+	if next != nil {
+		meta["next_cursor"] = next.String()
+		query := r.URL.Query()
+		query.Set("cursor", next.String())
+		links["next"] = r.URL.Path + "?" + query.Encode()
+	}
+	return meta, links
+}
+
+// followTarget parses vars["id"] and checks the client is logged in. It
+// writes the error otherwise.
+func (server *Server) followTarget(w http.ResponseWriter, r *http.Request) (uint32, *models.User, bool) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return 0, nil, false
+	}
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return 0, nil, false
+	}
+	return uint32(id), user, true
+}
+
+func (server *Server) FollowUser(w http.ResponseWriter, r *http.Request) {
+	uid, user, ok := server.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := models.FollowUser(server.DB, user.ID, uid)
+	if err == models.ErrFollowSelf {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if created {
+		server.eventBus().Publish(events.Event{Type: events.UserFollowed, ActorID: user.ID, UserID: uid})
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) UnfollowUser(w http.ResponseWriter, r *http.Request) {
+	uid, user, ok := server.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := models.UnfollowUser(server.DB, user.ID, uid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) FollowCategory(w http.ResponseWriter, r *http.Request) {
+	cid, user, ok := server.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := models.FollowCategory(server.DB, user.ID, cid)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Category not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) UnfollowCategory(w http.ResponseWriter, r *http.Request) {
+	cid, user, ok := server.followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	err := models.UnfollowCategory(server.DB, user.ID, cid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// followList serves a page of one of the follow lists of the user named by
+// vars["id"]
+func (server *Server) followList(w http.ResponseWriter, r *http.Request, list func(db *gorm.DB, uid uint32, cursor *models.Cursor, limit int) ([]models.User, *models.Cursor, error)) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := models.User{}
+	_, err = user.FindUserById(server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+
+	users, next, err := list(server.DB, uint32(uid), cursor, limit)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	meta, links := pageLinks(r, limit, next)
+	responses.ENVELOPE_JSON(w, r, http.StatusOK, models.UsersView(users, server.currentUser(r)), meta, links)
+}
+
+func (server *Server) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	server.followList(w, r, models.GetFollowers)
+}
+
+func (server *Server) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	server.followList(w, r, models.GetFollowing)
+}
+
+func (server *Server) GetFollowedCategories(w http.ResponseWriter, r *http.Request) {
+	uid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := models.User{}
+	_, err = user.FindUserById(server.DB, uint32(uid))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("User not found"))
+		return
+	}
+
+	categories, next, err := models.GetFollowedCategories(server.DB, uint32(uid), cursor, limit)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	meta, links := pageLinks(r, limit, next)
+	responses.ENVELOPE_JSON(w, r, http.StatusOK, categories, meta, links)
+}
+
+// GetFeed lists the published posts of the authors and categories the
+// client follows, newest first. Pages are cut with a cursor, so posts
+// published while paging don't shift the next page.
+func (server *Server) GetFeed(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	posts, next, err := models.GetFeed(server.DB, user.ID, cursor, limit, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.LoadReactions(server.DB, posts, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	meta, links := pageLinks(r, limit, next)
+	responses.ENVELOPE_JSON(w, r, http.StatusOK, posts, meta, links)
+}
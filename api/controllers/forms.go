@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/openapi"
+)
+
+// The form types below document the form-data fields each handler reads
+// with r.FormValue. They are only used to generate the OpenAPI document.
+
+type loginForm struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type userForm struct {
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type categoryForm struct {
+	Name string `json:"name"`
+	// ParentID nests the category, 0 makes it a root category
+	ParentID uint32 `json:"parent_id,omitempty"`
+}
+
+type postForm struct {
+	Title      string `json:"title"`
+	Content    string `json:"content"` // Markdown
+	AuthorID   uint32 `json:"author_id"`
+	CategoryID uint32 `json:"category_id"`
+	Tags       string `json:"tags,omitempty"` // comma separated, may be repeated
+	// Status is draft (default), published or scheduled; only on create
+	Status      string    `json:"status,omitempty"`
+	PublishedAt time.Time `json:"published_at,omitempty"`
+}
+
+type mediaForm struct {
+	File openapi.File `json:"file"`
+	// PostID attaches the upload to a post of yours
+	PostID uint64 `json:"post_id,omitempty"`
+}
+
+type readingListForm struct {
+	Name string `json:"name"`
+	// Public shares the list with anyone who has its share_url
+	Public bool `json:"public,omitempty"`
+}
+
+type readingListPostForm struct {
+	// Position moves the post there in the list, counted from 1; new posts
+	// go last by default
+	Position int `json:"position,omitempty"`
+}
+
+type notificationReadForm struct {
+	// IDs are the comma separated notifications to mark; all of them by
+	// default
+	IDs string `json:"ids,omitempty"`
+}
+
+type notificationPreferencesForm struct {
+	Follows   bool `json:"follows,omitempty"`
+	Comments  bool `json:"comments,omitempty"`
+	Reactions bool `json:"reactions,omitempty"`
+}
+
+type webhookForm struct {
+	URL string `json:"url"`
+	// Events are the comma separated types of events to send, e.g.
+	// post.created,user.created
+	Events string `json:"events"`
+	// Secret signs the deliveries; a random one by default
+	Secret string `json:"secret,omitempty"`
+}
+
+type publishForm struct {
+	// PublishedAt in the future schedules the post
+	PublishedAt time.Time `json:"published_at,omitempty"`
+}
+
+type commentForm struct {
+	Body     string `json:"body"`
+	ParentID uint64 `json:"parent_id,omitempty"`
+}
+
+type commentEditForm struct {
+	Body string `json:"body"`
+}
@@ -0,0 +1,838 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/graph"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// graphLimits bounds the queries of POST /graphql. Connections return
+// pageLimit items unless asked for more, and at most maxPageLimit.
+var graphLimits = graph.Limits{
+	MaxDepth:      10,
+	MaxComplexity: 5000,
+	DefaultFirst:  pageLimit,
+	MaxFirst:      maxPageLimit,
+}
+
+var (
+	graphSchema     graphql.Schema
+	graphSchemaErr  error
+	graphSchemaOnce sync.Once
+)
+
+type graphContextKey struct{}
+
+// graphRequest is what the resolvers of a request share: who is asking,
+// and the loaders batching the associations they look up
+type graphRequest struct {
+	server *Server
+	viewer *models.User
+	uid    uint32
+
+	users      *graph.Loader
+	categories *graph.Loader
+	tags       *graph.Loader
+	children   *graph.Loader
+}
+
+func (server *Server) newGraphRequest(r *http.Request) *graphRequest {
+	g := &graphRequest{server: server, viewer: server.currentUser(r)}
+	if g.viewer != nil {
+		g.uid = g.viewer.ID
+	}
+
+	g.users = graph.NewLoader(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		users, err := models.FindUsersByIds(server.DB, uint32Keys(keys))
+		values := map[interface{}]interface{}{}
+		for i := range users {
+			values[users[i].ID] = &users[i]
+		}
+		return values, err
+	})
+	g.categories = graph.NewLoader(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		categories, err := models.FindCategoriesByIds(server.DB, uint32Keys(keys))
+		values := map[interface{}]interface{}{}
+		for i := range categories {
+			values[categories[i].ID] = &categories[i]
+		}
+		return values, err
+	})
+	g.tags = graph.NewLoader(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		ids := make([]uint64, len(keys))
+		values := map[interface{}]interface{}{}
+		for i, key := range keys {
+			ids[i] = key.(uint64)
+			values[key] = []*models.Tag{}
+		}
+		post := models.Post{}
+		posts, err := post.FindPostsByIds(server.DB, ids, "Tags")
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range *posts {
+			tags := make([]*models.Tag, len(post.Tags))
+			for i := range post.Tags {
+				tags[i] = &post.Tags[i]
+			}
+			values[post.ID] = tags
+		}
+		return values, nil
+	})
+	g.children = graph.NewLoader(func(keys []interface{}) (map[interface{}]interface{}, error) {
+		values := map[interface{}]interface{}{}
+		for _, key := range keys {
+			values[key] = []*models.Category{}
+		}
+		categories, err := models.FindCategoryChildren(server.DB, uint32Keys(keys))
+		if err != nil {
+			return nil, err
+		}
+		for i := range categories {
+			parent := *categories[i].ParentID
+			values[parent] = append(values[parent].([]*models.Category), &categories[i])
+		}
+		return values, nil
+	})
+	return g
+}
+
+func uint32Keys(keys []interface{}) []uint32 {
+	ids := make([]uint32, len(keys))
+	for i, key := range keys {
+		ids[i] = key.(uint32)
+	}
+	return ids
+}
+
+func graphContext(p graphql.ResolveParams) *graphRequest {
+	return p.Context.Value(graphContextKey{}).(*graphRequest)
+}
+
+// argID reads the ID argument name, which fits in bits
+func argID(p graphql.ResolveParams, name string, bits int) (uint64, error) {
+	id, err := strconv.ParseUint(fmt.Sprint(p.Args[name]), 10, bits)
+	if err != nil {
+		return 0, withStatus(http.StatusBadRequest, fmt.Errorf("Invalid %s", name))
+	}
+	return id, nil
+}
+
+// argString reads the optional String argument name of args
+func argString(args map[string]interface{}, name string) string {
+	value, _ := args[name].(string)
+	return value
+}
+
+// graphEdge, graphPageInfo and graphConnection are the connections of
+// lists: a page of nodes with the cursors to go on from
+type graphEdge struct {
+	Cursor string
+	Node   interface{}
+}
+
+type graphPageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+type graphConnection struct {
+	Edges    []graphEdge
+	PageInfo graphPageInfo
+}
+
+func newConnection(nodes []interface{}, ids []uint64, next *models.Cursor) *graphConnection {
+	connection := &graphConnection{Edges: []graphEdge{}, PageInfo: graphPageInfo{HasNextPage: next != nil}}
+	for i, node := range nodes {
+		connection.Edges = append(connection.Edges, graphEdge{Cursor: models.Cursor{ID: ids[i]}.String(), Node: node})
+	}
+	if len(connection.Edges) > 0 {
+		connection.PageInfo.EndCursor = &connection.Edges[len(connection.Edges)-1].Cursor
+	}
+	return connection
+}
+
+// pageArgs reads the first and after arguments of a connection
+func pageArgs(p graphql.ResolveParams) (*models.Cursor, int, error) {
+	limit, ok := graph.PageSize(p.Args["first"], graphLimits)
+	if !ok {
+		return nil, 0, withStatus(http.StatusBadRequest, errors.New("Invalid first"))
+	}
+	var cursor *models.Cursor
+	if after := argString(p.Args, "after"); after != "" {
+		var err error
+		cursor, err = models.ParseCursor(after)
+		if err != nil {
+			return nil, 0, withStatus(http.StatusBadRequest, err)
+		}
+	}
+	return cursor, limit, nil
+}
+
+var connectionArgs = graphql.FieldConfigArgument{
+	"first": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Items per page, 20 by default and at most 100"},
+	"after": &graphql.ArgumentConfig{Type: graphql.String, Description: "Where to start, from pageInfo.endCursor of the previous page"},
+}
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"endCursor":   &graphql.Field{Type: graphql.String},
+	},
+})
+
+func connectionType(node *graphql.Object) *graphql.Object {
+	edge := graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Edge",
+		Fields: graphql.Fields{
+			"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"node":   &graphql.Field{Type: graphql.NewNonNull(node)},
+		},
+	})
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: node.Name() + "Connection",
+		Fields: graphql.Fields{
+			"edges":    &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(edge)))},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		},
+	})
+}
+
+// postConnection returns a page of the posts matching where that the client
+// may see
+func postConnection(p graphql.ResolveParams, where map[string]interface{}) (interface{}, error) {
+	g := graphContext(p)
+	cursor, limit, err := pageArgs(p)
+	if err != nil {
+		return nil, err
+	}
+	db := g.server.DB.Scopes(models.PostsVisibleTo(g.uid))
+	if len(where) > 0 {
+		db = db.Where(where)
+	}
+	posts, next, err := models.GetPostPage(db, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]interface{}, len(posts))
+	ids := make([]uint64, len(posts))
+	for i := range posts {
+		nodes[i], ids[i] = &posts[i], posts[i].ID
+	}
+	return newConnection(nodes, ids, next), nil
+}
+
+func buildGraphSchema() (graphql.Schema, error) {
+	var userType, postType, categoryType *graphql.Object
+	var userConnection, postConnectionType, categoryConnection *graphql.Object
+
+	tagType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Tag",
+		Fields: graphql.Fields{
+			"id":   &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"name": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"slug": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"username":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"email": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Only shown to the user and to admins",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						user := p.Source.(*models.User)
+						g := graphContext(p)
+						if g.viewer == nil || (g.viewer.ID != user.ID && !g.viewer.IsAdmin()) {
+							return nil, nil
+						}
+						return user.Email, nil
+					},
+				},
+				"role": &graphql.Field{
+					Type:        graphql.String,
+					Description: "Only shown to admins",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						g := graphContext(p)
+						if g.viewer == nil || !g.viewer.IsAdmin() {
+							return nil, nil
+						}
+						return p.Source.(*models.User).Role, nil
+					},
+				},
+				"posts": &graphql.Field{
+					Type:        graphql.NewNonNull(postConnectionType),
+					Description: "The posts of the user, newest first",
+					Args:        connectionArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						user := p.Source.(*models.User)
+						return postConnection(p, map[string]interface{}{"author_id": user.ID})
+					},
+				},
+			}
+		}),
+	})
+
+	postType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":            &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"title":         &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"slug":          &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"content":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"contentHtml":   &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"excerpt":       &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"status":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"publishedAt":   &graphql.Field{Type: graphql.DateTime},
+				"createdAt":     &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"updatedAt":     &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"reactionCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+				"author": &graphql.Field{
+					Type: userType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return graphContext(p).users.Load(p.Source.(*models.Post).AuthorID), nil
+					},
+				},
+				"category": &graphql.Field{
+					Type: categoryType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return graphContext(p).categories.Load(p.Source.(*models.Post).CategoryID), nil
+					},
+				},
+				"tags": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(tagType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return graphContext(p).tags.Load(p.Source.(*models.Post).ID), nil
+					},
+				},
+			}
+		}),
+	})
+
+	categoryType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Category",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":        &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"name":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"slug":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"createdAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"updatedAt": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"parent": &graphql.Field{
+					Type: categoryType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						category := p.Source.(*models.Category)
+						if category.ParentID == nil {
+							return nil, nil
+						}
+						return graphContext(p).categories.Load(*category.ParentID), nil
+					},
+				},
+				"children": &graphql.Field{
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(categoryType))),
+					Description: "The categories nested right under this one, by name",
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return graphContext(p).children.Load(p.Source.(*models.Category).ID), nil
+					},
+				},
+				"posts": &graphql.Field{
+					Type:        graphql.NewNonNull(postConnectionType),
+					Description: "The posts of the category, newest first",
+					Args:        connectionArgs,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						category := p.Source.(*models.Category)
+						return postConnection(p, map[string]interface{}{"category_id": category.ID})
+					},
+				},
+			}
+		}),
+	})
+
+	userConnection = connectionType(userType)
+	postConnectionType = connectionType(postType)
+	categoryConnection = connectionType(categoryType)
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"viewer": &graphql.Field{
+				Type:        userType,
+				Description: "The user of the token, null without one",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if viewer := graphContext(p).viewer; viewer != nil {
+						return viewer, nil
+					}
+					return nil, nil
+				},
+			},
+			"user": &graphql.Field{
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					uid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					return graphContext(p).users.Load(uint32(uid)), nil
+				},
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(userConnection),
+				Description: "Every user, oldest first",
+				Args:        connectionArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					cursor, limit, err := pageArgs(p)
+					if err != nil {
+						return nil, err
+					}
+					users, next, err := models.GetUserPage(graphContext(p).server.DB, cursor, limit)
+					if err != nil {
+						return nil, err
+					}
+					nodes := make([]interface{}, len(users))
+					ids := make([]uint64, len(users))
+					for i := range users {
+						nodes[i], ids[i] = &users[i], uint64(users[i].ID)
+					}
+					return newConnection(nodes, ids, next), nil
+				},
+			},
+			"post": &graphql.Field{
+				Type:        postType,
+				Description: "A post by id or by slug, null when not found or not visible",
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.ID},
+					"slug": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					post := models.Post{}
+					var found *models.Post
+					var err error
+					if _, ok := p.Args["id"]; ok {
+						var pid uint64
+						pid, err = argID(p, "id", 64)
+						if err != nil {
+							return nil, err
+						}
+						found, err = post.FindPostById(g.server.DB, pid)
+					} else if slug := argString(p.Args, "slug"); slug != "" {
+						found, err = post.FindPostBySlug(g.server.DB, slug)
+					} else {
+						return nil, withStatus(http.StatusBadRequest, errors.New("Post needs an id or a slug"))
+					}
+					if gorm.IsRecordNotFoundError(err) {
+						return nil, nil
+					}
+					if err != nil {
+						return nil, err
+					}
+					if !found.IsVisibleTo(g.uid) {
+						return nil, nil
+					}
+					return found, nil
+				},
+			},
+			"posts": &graphql.Field{
+				Type:        graphql.NewNonNull(postConnectionType),
+				Description: "The posts the client may see, newest first",
+				Args: graphql.FieldConfigArgument{
+					"first":      connectionArgs["first"],
+					"after":      connectionArgs["after"],
+					"categoryId": &graphql.ArgumentConfig{Type: graphql.ID, Description: "Only posts in this category"},
+					"authorId":   &graphql.ArgumentConfig{Type: graphql.ID, Description: "Only posts by this user"},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					where := map[string]interface{}{}
+					for arg, column := range map[string]string{"categoryId": "category_id", "authorId": "author_id"} {
+						if _, ok := p.Args[arg]; !ok {
+							continue
+						}
+						id, err := argID(p, arg, 32)
+						if err != nil {
+							return nil, err
+						}
+						where[column] = uint32(id)
+					}
+					return postConnection(p, where)
+				},
+			},
+			"category": &graphql.Field{
+				Type: categoryType,
+				Args: graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					cid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					return graphContext(p).categories.Load(uint32(cid)), nil
+				},
+			},
+			"categories": &graphql.Field{
+				Type:        graphql.NewNonNull(categoryConnection),
+				Description: "Every category, oldest first",
+				Args:        connectionArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					cursor, limit, err := pageArgs(p)
+					if err != nil {
+						return nil, err
+					}
+					categories, next, err := models.GetCategoryPage(graphContext(p).server.DB, cursor, limit)
+					if err != nil {
+						return nil, err
+					}
+					nodes := make([]interface{}, len(categories))
+					ids := make([]uint64, len(categories))
+					for i := range categories {
+						nodes[i], ids[i] = &categories[i], uint64(categories[i].ID)
+					}
+					return newConnection(nodes, ids, next), nil
+				},
+			},
+		},
+	})
+
+	postInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "PostInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"title":       &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"content":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"categoryId":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.ID)},
+			"status":      &graphql.InputObjectFieldConfig{Type: graphql.String, Description: "draft, scheduled or published; only read on create, draft by default"},
+			"publishedAt": &graphql.InputObjectFieldConfig{Type: graphql.DateTime, Description: "When a scheduled post goes out; only read on create"},
+			"tags":        &graphql.InputObjectFieldConfig{Type: graphql.NewList(graphql.NewNonNull(graphql.String)), Description: "Replaces the tags of the post when given"},
+		},
+	})
+	categoryInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CategoryInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"name":     &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"parentId": &graphql.InputObjectFieldConfig{Type: graphql.ID, Description: "The parent category, 0 or null for a root category; kept as it is on update when not given"},
+		},
+	})
+	userInputType := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "UserInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"username": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"email":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"password": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	idArgs := graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}}
+	inputArgs := func(input *graphql.InputObject) graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)}}
+	}
+	idInputArgs := func(input *graphql.InputObject) graphql.FieldConfigArgument {
+		return graphql.FieldConfigArgument{
+			"id":    idArgs["id"],
+			"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(input)},
+		}
+	}
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createPost": &graphql.Field{
+				Type:        graphql.NewNonNull(postType),
+				Description: "Write a post as the user of the token",
+				Args:        inputArgs(postInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					if g.uid == 0 {
+						return nil, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+					}
+					in, err := graphPostInput(p.Args["input"].(map[string]interface{}))
+					if err != nil {
+						return nil, err
+					}
+					in.AuthorID = g.uid
+					return g.server.createPost(g.uid, in, nil)
+				},
+			},
+			"updatePost": &graphql.Field{
+				Type: graphql.NewNonNull(postType),
+				Args: idInputArgs(postInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					pid, err := argID(p, "id", 64)
+					if err != nil {
+						return nil, err
+					}
+					in, err := graphPostInput(p.Args["input"].(map[string]interface{}))
+					if err != nil {
+						return nil, err
+					}
+					return g.server.updatePost(g.uid, pid, in, nil)
+				},
+			},
+			"deletePost": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Move a post to the trash",
+				Args:        idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					pid, err := argID(p, "id", 64)
+					if err != nil {
+						return nil, err
+					}
+					return true, g.server.deletePost(g.uid, pid)
+				},
+			},
+			"createCategory": &graphql.Field{
+				Type: graphql.NewNonNull(categoryType),
+				Args: inputArgs(categoryInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					in, err := graphCategoryInput(p.Args["input"].(map[string]interface{}))
+					if err != nil {
+						return nil, err
+					}
+					return g.server.createCategory(g.uid, in)
+				},
+			},
+			"updateCategory": &graphql.Field{
+				Type: graphql.NewNonNull(categoryType),
+				Args: idInputArgs(categoryInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					if g.uid == 0 {
+						return nil, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+					}
+					cid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					in, err := graphCategoryInput(p.Args["input"].(map[string]interface{}))
+					if err != nil {
+						return nil, err
+					}
+					return g.server.updateCategory(g.uid, uint32(cid), in)
+				},
+			},
+			"deleteCategory": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Move a category to the trash",
+				Args:        idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					if g.uid == 0 {
+						return nil, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+					}
+					cid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					return true, g.server.deleteCategory(g.uid, uint32(cid))
+				},
+			},
+			"createUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Sign up",
+				Args:        inputArgs(userInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return graphContext(p).server.createUser(graphUserInput(p.Args["input"].(map[string]interface{})))
+				},
+			},
+			"updateUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Update the account of the token",
+				Args:        idInputArgs(userInputType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					uid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					return g.server.updateUser(g.uid, uint32(uid), graphUserInput(p.Args["input"].(map[string]interface{})))
+				},
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Move the account of the token to the trash",
+				Args:        idArgs,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					g := graphContext(p)
+					uid, err := argID(p, "id", 32)
+					if err != nil {
+						return nil, err
+					}
+					return true, g.server.deleteUser(g.uid, uint32(uid))
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// graphPostInput reads a PostInput, leaving the author to the caller
+func graphPostInput(args map[string]interface{}) (postInput, error) {
+	cid, err := strconv.ParseUint(fmt.Sprint(args["categoryId"]), 10, 32)
+	if err != nil {
+		return postInput{}, withStatus(http.StatusUnprocessableEntity, errors.New("Invalid categoryId"))
+	}
+	in := postInput{
+		Title:      argString(args, "title"),
+		Content:    argString(args, "content"),
+		CategoryID: uint32(cid),
+		Status:     argString(args, "status"),
+	}
+	if publishedAt, ok := args["publishedAt"].(time.Time); ok {
+		in.PublishedAt = &publishedAt
+	}
+	if tags, ok := args["tags"].([]interface{}); ok {
+		in.SetTags = true
+		in.Tags = []string{}
+		for _, tag := range tags {
+			in.Tags = append(in.Tags, fmt.Sprint(tag))
+		}
+	}
+	return in, nil
+}
+
+// graphCategoryInput reads a CategoryInput
+func graphCategoryInput(args map[string]interface{}) (categoryInput, error) {
+	in := categoryInput{Name: argString(args, "name")}
+	value, ok := args["parentId"]
+	in.SetParent = ok
+	if !ok || value == nil || fmt.Sprint(value) == "0" {
+		return in, nil
+	}
+	pid, err := strconv.ParseUint(fmt.Sprint(value), 10, 32)
+	if err != nil {
+		return categoryInput{}, withStatus(http.StatusBadRequest, errors.New("Invalid parentId"))
+	}
+	parentID := uint32(pid)
+	in.ParentID = &parentID
+	return in, nil
+}
+
+// graphUserInput reads a UserInput
+func graphUserInput(args map[string]interface{}) userInput {
+	return userInput{
+		Username: argString(args, "username"),
+		Email:    argString(args, "email"),
+		Password: argString(args, "password"),
+	}
+}
+
+// graphqlParams is the body of a GraphQL request
+type graphqlParams struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlResult documents the response of a GraphQL request
+type graphqlResult struct {
+	Data   map[string]interface{}     `json:"data,omitempty"`
+	Errors []gqlerrors.FormattedError `json:"errors,omitempty"`
+}
+
+// readGraphqlParams reads a GraphQL request from a JSON body, or from the
+// query string of a GET
+func readGraphqlParams(r *http.Request) (graphqlParams, error) {
+	params := graphqlParams{}
+	if r.Method == http.MethodGet {
+		query := r.URL.Query()
+		params.Query = query.Get("query")
+		params.OperationName = query.Get("operationName")
+		if variables := query.Get("variables"); variables != "" {
+			err := json.Unmarshal([]byte(variables), &params.Variables)
+			if err != nil {
+				return params, errors.New("Invalid variables")
+			}
+		}
+		return params, nil
+	}
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		return params, errors.New("Invalid GraphQL request")
+	}
+	return params, nil
+}
+
+// graphqlErrors writes a request turned down before it ran
+func graphqlErrors(w http.ResponseWriter, status int, err error) {
+	responses.JSON(w, status, graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+}
+
+// ServeGraphQL runs a GraphQL query or mutation over users, posts and
+// categories. Queries too deep or too complex are turned down before they
+// run; errors of the fields run carry their HTTP status in extensions.
+func (server *Server) ServeGraphQL(w http.ResponseWriter, r *http.Request) {
+	graphSchemaOnce.Do(func() {
+		graphSchema, graphSchemaErr = buildGraphSchema()
+	})
+	if graphSchemaErr != nil {
+		graphqlErrors(w, http.StatusInternalServerError, graphSchemaErr)
+		return
+	}
+
+	params, err := readGraphqlParams(r)
+	if err != nil {
+		graphqlErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	if params.Query == "" {
+		graphqlErrors(w, http.StatusBadRequest, errors.New("Missing query"))
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(params.Query), Name: "GraphQL request"})})
+	if err != nil {
+		graphqlErrors(w, http.StatusBadRequest, err)
+		return
+	}
+	validation := graphql.ValidateDocument(&graphSchema, doc, nil)
+	if !validation.IsValid {
+		responses.JSON(w, http.StatusBadRequest, graphql.Result{Errors: validation.Errors})
+		return
+	}
+	// Links and images may send GET requests carrying a ?token=, so only
+	// POST requests change data
+	operation := graph.Operation(doc, params.OperationName)
+	if r.Method == http.MethodGet && operation != nil && operation.Operation == ast.OperationTypeMutation {
+		w.Header().Set("Allow", http.MethodPost)
+		graphqlErrors(w, http.StatusMethodNotAllowed, errors.New("Mutations must be sent with POST"))
+		return
+	}
+	err = graphLimits.Check(doc, params.OperationName, params.Variables)
+	if err != nil {
+		graphqlErrors(w, http.StatusBadRequest, err)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), graphContextKey{}, server.newGraphRequest(r))
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        graphSchema,
+		AST:           doc,
+		OperationName: params.OperationName,
+		Args:          params.Variables,
+		Context:       ctx,
+	})
+	responses.JSON(w, http.StatusOK, result)
+}
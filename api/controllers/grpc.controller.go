@@ -0,0 +1,412 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/auth"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/rpc"
+	"github.com/rizalreza/golang-restful/api/rpc/blogpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcProtected are the gRPC methods needing a token, those of the REST
+// routes behind SetMiddlewareAuthentication
+var grpcProtected = map[string]bool{
+	blogpb.UserService_UpdateUser_FullMethodName:         true,
+	blogpb.UserService_DeleteUser_FullMethodName:         true,
+	blogpb.PostService_CreatePost_FullMethodName:         true,
+	blogpb.PostService_UpdatePost_FullMethodName:         true,
+	blogpb.PostService_DeletePost_FullMethodName:         true,
+	blogpb.CategoryService_UpdateCategory_FullMethodName: true,
+	blogpb.CategoryService_DeleteCategory_FullMethodName: true,
+}
+
+// tokenUserID returns the id of the user token was issued to. As with
+// currentUser, the tokens of users in the trash are refused.
+func (server *Server) tokenUserID(token string) (uint32, error) {
+	uid, err := auth.ParseTokenID(token)
+	if err != nil {
+		return 0, err
+	}
+	user := models.User{}
+	err = server.DB.Debug().Model(models.User{}).Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// GRPCServer returns a gRPC server of the users, posts and categories,
+// with server reflection so tools like grpcurl can list its services
+func (server *Server) GRPCServer() *grpc.Server {
+	authenticate := rpc.Auth{Parse: server.tokenUserID, Protected: grpcProtected}
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(authenticate.Unary(), rpc.Errors(errorStatus)),
+		grpc.ChainStreamInterceptor(authenticate.Stream()),
+	)
+	blogpb.RegisterUserServiceServer(s, &userService{server: server})
+	blogpb.RegisterPostServiceServer(s, &postService{server: server})
+	blogpb.RegisterCategoryServiceServer(s, &categoryService{server: server})
+	reflection.Register(s)
+	return s
+}
+
+// ServeGRPC serves the gRPC API on lis until ctx is done, then stops
+// gracefully, giving calls in flight up to shutdownTimeout to finish
+func (server *Server) ServeGRPC(ctx context.Context, lis net.Listener) error {
+	s := server.GRPCServer()
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(lis)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case <-ctx.Done():
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		log.Printf("Cannot stop gRPC gracefully, dropping the calls in flight")
+		s.Stop()
+	}
+	return <-served
+}
+
+// grpcViewer returns the user of the token of the call, nil for anonymous
+// calls
+func (server *Server) grpcViewer(ctx context.Context) *models.User {
+	uid := rpc.UserID(ctx)
+	if uid == 0 {
+		return nil
+	}
+	user := models.User{}
+	err := server.DB.Debug().Model(models.User{}).Where("id = ?", uid).Take(&user).Error
+	if err != nil {
+		return nil
+	}
+	return &user
+}
+
+// grpcPage reads the page size and token of a list call
+func grpcPage(size int32, token string) (*models.Cursor, int, error) {
+	if size < 0 {
+		return nil, 0, withStatus(http.StatusBadRequest, errors.New("Invalid page_size"))
+	}
+	limit := int(size)
+	if limit == 0 {
+		limit = pageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	var cursor *models.Cursor
+	if token != "" {
+		var err error
+		cursor, err = models.ParseCursor(token)
+		if err != nil {
+			return nil, 0, withStatus(http.StatusBadRequest, err)
+		}
+	}
+	return cursor, limit, nil
+}
+
+// pageToken returns the token of the page after next, empty on the last page
+func pageToken(next *models.Cursor) string {
+	if next == nil {
+		return ""
+	}
+	return next.String()
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// userMessage returns what viewer may see of user, as View does
+func userMessage(user *models.User, viewer *models.User) *blogpb.User {
+	m := &blogpb.User{
+		Id:        user.ID,
+		Username:  user.Username,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+	if viewer != nil && (viewer.ID == user.ID || viewer.IsAdmin()) {
+		m.Email = user.Email
+		m.UpdatedAt = timestamppb.New(user.UpdatedAt)
+	}
+	if viewer != nil && viewer.IsAdmin() {
+		m.Role = user.Role
+	}
+	return m
+}
+
+func postMessage(post *models.Post) *blogpb.Post {
+	m := &blogpb.Post{
+		Id:            post.ID,
+		Title:         post.Title,
+		Slug:          post.Slug,
+		Content:       post.Content,
+		ContentHtml:   post.ContentHTML,
+		Excerpt:       post.Excerpt,
+		AuthorId:      post.AuthorID,
+		CategoryId:    post.CategoryID,
+		Status:        post.Status,
+		PublishedAt:   timestamp(post.PublishedAt),
+		CreatedAt:     timestamppb.New(post.CreatedAt),
+		UpdatedAt:     timestamppb.New(post.UpdatedAt),
+		ReactionCount: int64(post.ReactionCount),
+		Tags:          []*blogpb.Tag{},
+	}
+	for _, tag := range post.Tags {
+		m.Tags = append(m.Tags, &blogpb.Tag{Id: tag.ID, Name: tag.Name, Slug: tag.Slug})
+	}
+	return m
+}
+
+func categoryMessage(category *models.Category) *blogpb.Category {
+	return &blogpb.Category{
+		Id:        category.ID,
+		Name:      category.Name,
+		Slug:      category.Slug,
+		ParentId:  category.ParentID,
+		CreatedAt: timestamppb.New(category.CreatedAt),
+		UpdatedAt: timestamppb.New(category.UpdatedAt),
+	}
+}
+
+// grpcTags reads the tags of a post sent in a call
+func grpcTags(in *postInput, tags *blogpb.TagNames) {
+	if tags == nil {
+		return
+	}
+	in.SetTags = true
+	in.Tags = tags.GetNames()
+	if in.Tags == nil {
+		in.Tags = []string{}
+	}
+}
+
+// grpcParentID reads the parent of a category sent in a call: unset to
+// keep it, 0 for a root category
+func grpcParentID(in *categoryInput, parentID *uint32) {
+	in.SetParent = parentID != nil
+	if parentID != nil && *parentID != 0 {
+		in.ParentID = parentID
+	}
+}
+
+type userService struct {
+	blogpb.UnimplementedUserServiceServer
+	server *Server
+}
+
+func (s *userService) CreateUser(ctx context.Context, req *blogpb.CreateUserRequest) (*blogpb.User, error) {
+	user, err := s.server.createUser(userInput{Username: req.Username, Email: req.Email, Password: req.Password})
+	if err != nil {
+		return nil, err
+	}
+	return userMessage(user, user), nil
+}
+
+func (s *userService) GetUser(ctx context.Context, req *blogpb.GetUserRequest) (*blogpb.User, error) {
+	user := models.User{}
+	found, err := user.FindUserById(s.server.DB, req.Id)
+	if err != nil {
+		return nil, withStatus(http.StatusNotFound, errors.New("User not found"))
+	}
+	return userMessage(found, s.server.grpcViewer(ctx)), nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, req *blogpb.ListUsersRequest) (*blogpb.ListUsersResponse, error) {
+	cursor, limit, err := grpcPage(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	users, next, err := models.GetUserPage(s.server.DB, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	viewer := s.server.grpcViewer(ctx)
+	res := &blogpb.ListUsersResponse{NextPageToken: pageToken(next)}
+	for i := range users {
+		res.Users = append(res.Users, userMessage(&users[i], viewer))
+	}
+	return res, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, req *blogpb.UpdateUserRequest) (*blogpb.User, error) {
+	user, err := s.server.updateUser(rpc.UserID(ctx), req.Id, userInput{Username: req.Username, Email: req.Email, Password: req.Password})
+	if err != nil {
+		return nil, err
+	}
+	return userMessage(user, user), nil
+}
+
+func (s *userService) DeleteUser(ctx context.Context, req *blogpb.DeleteUserRequest) (*emptypb.Empty, error) {
+	err := s.server.deleteUser(rpc.UserID(ctx), req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+type postService struct {
+	blogpb.UnimplementedPostServiceServer
+	server *Server
+}
+
+func (s *postService) CreatePost(ctx context.Context, req *blogpb.CreatePostRequest) (*blogpb.Post, error) {
+	uid := rpc.UserID(ctx)
+	in := postInput{
+		Title:      req.Title,
+		Content:    req.Content,
+		AuthorID:   uid,
+		CategoryID: req.CategoryId,
+		Status:     req.Status,
+	}
+	if req.PublishedAt != nil {
+		publishedAt := req.PublishedAt.AsTime()
+		in.PublishedAt = &publishedAt
+	}
+	grpcTags(&in, req.Tags)
+	post, err := s.server.createPost(uid, in, []string{"Tags"})
+	if err != nil {
+		return nil, err
+	}
+	return postMessage(post), nil
+}
+
+func (s *postService) GetPost(ctx context.Context, req *blogpb.GetPostRequest) (*blogpb.Post, error) {
+	post := models.Post{}
+	var found *models.Post
+	var err error
+	switch key := req.Key.(type) {
+	case *blogpb.GetPostRequest_Id:
+		found, err = post.FindPostById(s.server.DB, key.Id, "Tags")
+	case *blogpb.GetPostRequest_Slug:
+		found, err = post.FindPostBySlug(s.server.DB, key.Slug, "Tags")
+	default:
+		return nil, withStatus(http.StatusBadRequest, errors.New("Post needs an id or a slug"))
+	}
+	if err != nil || !found.IsVisibleTo(rpc.UserID(ctx)) {
+		return nil, withStatus(http.StatusNotFound, errors.New("Post not found"))
+	}
+	return postMessage(found), nil
+}
+
+func (s *postService) ListPosts(ctx context.Context, req *blogpb.ListPostsRequest) (*blogpb.ListPostsResponse, error) {
+	cursor, limit, err := grpcPage(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	db := s.server.DB.Scopes(models.PostsVisibleTo(rpc.UserID(ctx))).Preload("Tags")
+	if req.CategoryId != 0 {
+		db = db.Where("posts.category_id = ?", req.CategoryId)
+	}
+	if req.AuthorId != 0 {
+		db = db.Where("posts.author_id = ?", req.AuthorId)
+	}
+	posts, next, err := models.GetPostPage(db, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &blogpb.ListPostsResponse{NextPageToken: pageToken(next)}
+	for i := range posts {
+		res.Posts = append(res.Posts, postMessage(&posts[i]))
+	}
+	return res, nil
+}
+
+func (s *postService) UpdatePost(ctx context.Context, req *blogpb.UpdatePostRequest) (*blogpb.Post, error) {
+	in := postInput{Title: req.Title, Content: req.Content, CategoryID: req.CategoryId}
+	grpcTags(&in, req.Tags)
+	post, err := s.server.updatePost(rpc.UserID(ctx), req.Id, in, []string{"Tags"})
+	if err != nil {
+		return nil, err
+	}
+	return postMessage(post), nil
+}
+
+func (s *postService) DeletePost(ctx context.Context, req *blogpb.DeletePostRequest) (*emptypb.Empty, error) {
+	err := s.server.deletePost(rpc.UserID(ctx), req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+type categoryService struct {
+	blogpb.UnimplementedCategoryServiceServer
+	server *Server
+}
+
+func (s *categoryService) CreateCategory(ctx context.Context, req *blogpb.CreateCategoryRequest) (*blogpb.Category, error) {
+	in := categoryInput{Name: req.Name}
+	grpcParentID(&in, req.ParentId)
+	category, err := s.server.createCategory(rpc.UserID(ctx), in)
+	if err != nil {
+		return nil, err
+	}
+	return categoryMessage(category), nil
+}
+
+func (s *categoryService) GetCategory(ctx context.Context, req *blogpb.GetCategoryRequest) (*blogpb.Category, error) {
+	category := models.Category{}
+	found, err := category.FindCategoryById(s.server.DB, req.Id)
+	if err != nil {
+		return nil, withStatus(http.StatusNotFound, errors.New("Category not found"))
+	}
+	return categoryMessage(found), nil
+}
+
+func (s *categoryService) ListCategories(ctx context.Context, req *blogpb.ListCategoriesRequest) (*blogpb.ListCategoriesResponse, error) {
+	cursor, limit, err := grpcPage(req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	categories, next, err := models.GetCategoryPage(s.server.DB, cursor, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &blogpb.ListCategoriesResponse{NextPageToken: pageToken(next)}
+	for i := range categories {
+		res.Categories = append(res.Categories, categoryMessage(&categories[i]))
+	}
+	return res, nil
+}
+
+func (s *categoryService) UpdateCategory(ctx context.Context, req *blogpb.UpdateCategoryRequest) (*blogpb.Category, error) {
+	in := categoryInput{Name: req.Name}
+	grpcParentID(&in, req.ParentId)
+	category, err := s.server.updateCategory(rpc.UserID(ctx), req.Id, in)
+	if err != nil {
+		return nil, err
+	}
+	return categoryMessage(category), nil
+}
+
+func (s *categoryService) DeleteCategory(ctx context.Context, req *blogpb.DeleteCategoryRequest) (*emptypb.Empty, error) {
+	err := s.server.deleteCategory(rpc.UserID(ctx), req.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
@@ -0,0 +1,430 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/storage"
+	"github.com/rizalreza/golang-restful/api/utils/imaging"
+)
+
+const (
+	// thumbnailSize is the largest side of a thumbnail, in pixels
+	thumbnailSize = 320
+	// multipartMemory is how much of an upload is held in memory before
+	// the rest goes to a temporary file
+	multipartMemory = 1 << 20
+	// multipartOverhead leaves room for the other fields and the part
+	// headers of an upload
+	multipartOverhead = 64 << 10
+)
+
+// blobStore returns the store uploads are kept in, files under ./media
+// unless another one was configured
+func (server *Server) blobStore() storage.BlobStore {
+	server.blobsOnce.Do(func() {
+		if server.Blobs == nil {
+			server.Blobs = storage.NewLocal("media")
+		}
+	})
+	return server.Blobs
+}
+
+// deleteBlobs removes blobs no media uses any more. Failures only leave
+// unreachable files behind, so they are logged.
+func (server *Server) deleteBlobs(keys []string) {
+	for _, key := range keys {
+		err := server.blobStore().Delete(key)
+		if err != nil {
+			log.Printf("Cannot delete blob %s: %v", key, err)
+		}
+	}
+}
+
+// mediaPost returns the post named by vars["id"] when the current user is
+// its author. It writes the error otherwise.
+func (server *Server) mediaPost(w http.ResponseWriter, r *http.Request) (*models.Post, bool) {
+	pid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return nil, false
+	}
+	if post.AuthorID != user.ID {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	return &post, true
+}
+
+// UploadMedia stores the file of a multipart upload. The content type is
+// sniffed from the bytes rather than trusted from the client. Images get
+// their dimensions and a thumbnail. With post_id, the media is attached to
+// that post of the uploader.
+func (server *Server) UploadMedia(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	tooLarge := fmt.Errorf("File Too Large, the limit is %d bytes", models.MaxMediaSize)
+	if r.ContentLength > models.MaxMediaSize+multipartOverhead {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxMediaSize+multipartOverhead)
+	err := r.ParseMultipartForm(multipartMemory)
+	if err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			responses.ERROR(w, http.StatusRequestEntityTooLarge, tooLarge)
+			return
+		}
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required file"))
+		return
+	}
+	defer file.Close()
+	if header.Size > models.MaxMediaSize {
+		responses.ERROR(w, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	if header.Size == 0 {
+		responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Empty file"))
+		return
+	}
+
+	var post *models.Post
+	if value := r.FormValue("post_id"); value != "" {
+		pid, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid post_id"))
+			return
+		}
+		post = &models.Post{}
+		err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(post).Error
+		if err != nil {
+			responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+			return
+		}
+		if post.AuthorID != user.ID {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	contentType := http.DetectContentType(head[:n])
+	if !models.MediaTypes[contentType] {
+		responses.ERROR(w, http.StatusUnsupportedMediaType, fmt.Errorf("Unsupported media type %s", contentType))
+		return
+	}
+
+	media := models.Media{
+		OwnerID:     user.ID,
+		Filename:    header.Filename,
+		ContentType: contentType,
+		Size:        header.Size,
+	}
+	media.Prepare()
+
+	if imaging.Decodable(contentType) {
+		_, err = file.Seek(0, io.SeekStart)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+		content, err := ioutil.ReadAll(file)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		media.Width, media.Height, err = imaging.Dimensions(content)
+		if err != nil {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid image"))
+			return
+		}
+		thumbnail, err := imaging.Thumbnail(content, thumbnailSize)
+		if err != nil && err != imaging.ErrTooLarge {
+			responses.ERROR(w, http.StatusUnprocessableEntity, errors.New("Invalid image"))
+			return
+		}
+		// Images too large to decode are kept, without a thumbnail
+		if thumbnail != nil {
+			media.ThumbnailKey, err = storage.Key(bytes.NewReader(thumbnail))
+			if err == nil {
+				err = server.blobStore().Put(media.ThumbnailKey, bytes.NewReader(thumbnail), int64(len(thumbnail)), http.DetectContentType(thumbnail))
+			}
+			if err != nil {
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err == nil {
+		media.BlobKey, err = storage.Key(file)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		err = server.blobStore().Put(media.BlobKey, file, header.Size, contentType)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	mediaCreated, err := media.SaveMedia(server.DB)
+	if err == nil && post != nil {
+		err = models.AttachMedia(server.DB, post.ID, mediaCreated.ID)
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, mediaCreated.ID))
+	responses.SPARSE_JSON(w, r, http.StatusCreated, mediaCreated)
+}
+
+// GetMedia serves the content of the media. Ranges and conditional
+// requests are answered; the content of a media never changes, so clients
+// may cache it for good when it is attached to a published post.
+func (server *Server) GetMedia(w http.ResponseWriter, r *http.Request) {
+	server.serveMedia(w, r, false)
+}
+
+// GetMediaThumbnail serves the thumbnail of an image, or the image itself
+// when it is already small
+func (server *Server) GetMediaThumbnail(w http.ResponseWriter, r *http.Request) {
+	server.serveMedia(w, r, true)
+}
+
+func (server *Server) serveMedia(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	mid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	media := models.Media{}
+	_, err = media.FindMediaById(server.DB, mid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Media not found"))
+		return
+	}
+
+	// Media is served to its owner and to those who may read a post it is
+	// attached to. Others are told it does not exist.
+	public, err := media.IsAttachedToPostVisibleTo(server.DB, 0)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	viewer := viewerID(r)
+	visible := public || (viewer != 0 && media.OwnerID == viewer)
+	if !visible && viewer != 0 {
+		visible, err = media.IsAttachedToPostVisibleTo(server.DB, viewer)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	if !visible {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Media not found"))
+		return
+	}
+
+	key, contentType := media.BlobKey, media.ContentType
+	if thumbnail {
+		if media.Width == 0 {
+			responses.ERROR(w, http.StatusNotFound, errors.New("Media has no thumbnail"))
+			return
+		}
+		if media.ThumbnailKey != "" {
+			// Sniffed by ServeContent, thumbnails are JPEG or PNG
+			key, contentType = media.ThumbnailKey, ""
+		}
+	}
+
+	blob, err := server.blobStore().Open(key)
+	if err == storage.ErrNotFound {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Media not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer blob.Close()
+
+	header := w.Header()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	header.Set("ETag", `"`+key+`"`)
+	if public {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// Shared caches must not keep it, and clients check they still may
+		// see it before using their copy
+		header.Set("Cache-Control", "private, no-cache")
+	}
+	header.Set("X-Content-Type-Options", "nosniff")
+	disposition := "attachment"
+	if strings.HasPrefix(media.ContentType, "image/") {
+		disposition = "inline"
+	}
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": media.Filename}); value != "" {
+		disposition = value
+	}
+	header.Set("Content-Disposition", disposition)
+	http.ServeContent(w, r, "", media.CreatedAt, blob)
+}
+
+// DeleteMedia deletes media of the current user, or any media for admins.
+// It is detached from its posts.
+func (server *Server) DeleteMedia(w http.ResponseWriter, r *http.Request) {
+	mid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	media := models.Media{}
+	_, err = media.FindMediaById(server.DB, mid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Media not found"))
+		return
+	}
+	if media.OwnerID != user.ID && !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	unused, err := media.DeleteMedia(server.DB, mid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.deleteBlobs(unused)
+
+	w.Header().Set("Entity", fmt.Sprintf("%d", mid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// GetPostMedia lists the media attached to a post the client may see
+func (server *Server) GetPostMedia(w http.ResponseWriter, r *http.Request) {
+	pid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(viewerID(r)) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+
+	media, err := models.GetPostMedia(server.DB, pid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, media)
+}
+
+// AttachMedia attaches media of the author to their post
+func (server *Server) AttachMedia(w http.ResponseWriter, r *http.Request) {
+	post, ok := server.mediaPost(w, r)
+	if !ok {
+		return
+	}
+	mid, err := strconv.ParseUint(mux.Vars(r)["mediaId"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.AttachMedia(server.DB, post.ID, mid)
+	if err == models.ErrMediaNotOwned {
+		responses.ERROR(w, http.StatusForbidden, err)
+		return
+	}
+	if gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Media not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	media, err := models.GetPostMedia(server.DB, post.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, media)
+}
+
+// DetachMedia removes media from a post of the author. The media itself is
+// kept.
+func (server *Server) DetachMedia(w http.ResponseWriter, r *http.Request) {
+	post, ok := server.mediaPost(w, r)
+	if !ok {
+		return
+	}
+	mid, err := strconv.ParseUint(mux.Vars(r)["mediaId"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.DetachMedia(server.DB, post.ID, mid)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// eventBus returns the bus the controllers publish to, with the
+// notifications, webhooks, event streams and rooms subscribed
+func (server *Server) eventBus() *events.Bus {
+	server.eventsOnce.Do(func() {
+		if server.Events == nil {
+			server.Events = events.NewBus()
+		}
+		server.Events.Subscribe(func(e events.Event) {
+			err := models.Notify(server.DB, e)
+			if err != nil {
+				log.Printf("Cannot notify of %s event: %v", e.Type, err)
+			}
+		})
+		server.Events.Subscribe(server.enqueueWebhooks)
+		server.Events.Subscribe(server.streamEvent)
+		server.Events.Subscribe(server.roomEvent)
+	})
+	return server.Events
+}
+
+// publishComment tells the author of the post a comment is on about it,
+// once the comment is approved
+func (server *Server) publishComment(comment *models.Comment, postAuthor uint32) {
+	if comment.Status != models.CommentApproved {
+		return
+	}
+	server.eventBus().Publish(events.Event{
+		Type: events.CommentCreated, ActorID: comment.AuthorID, UserID: postAuthor, PostID: comment.PostID, CommentID: comment.ID,
+		Data: comment,
+	})
+}
+
+// GetNotifications lists the notifications of the current user, latest
+// activity first, with the number of unread ones in the meta
+func (server *Server) GetNotifications(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	unread := false
+	if value := r.URL.Query().Get("unread"); value != "" {
+		unread, err = strconv.ParseBool(value)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid unread"))
+			return
+		}
+	}
+
+	notifications, next, err := models.GetNotifications(server.DB, user.ID, unread, cursor, limit)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	count, err := models.CountUnreadNotifications(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	meta, links := pageLinks(r, limit, next)
+	meta["unread_count"] = count
+	responses.ENVELOPE_JSON(w, r, http.StatusOK, notifications, meta, links)
+}
+
+// ReadNotifications marks the notifications given in ids as read, or all
+// of them when there are no ids. Activity on a read notification starts a
+// new one.
+func (server *Server) ReadNotifications(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	ids := []uint64{}
+	for _, value := range strings.Split(r.FormValue("ids"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid ids"))
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	err := models.MarkNotificationsRead(server.DB, user.ID, ids)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) GetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	preferences, err := models.GetNotificationPreferences(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, preferences)
+}
+
+// UpdateNotificationPreferences turns kinds of notifications on or off.
+// Kinds left out of the form keep their setting.
+func (server *Server) UpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	preferences, err := models.GetNotificationPreferences(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	for name, setting := range map[string]*bool{
+		"follows":   &preferences.Follows,
+		"comments":  &preferences.Comments,
+		"reactions": &preferences.Reactions,
+	} {
+		*setting, err = formBool(r, name, *setting)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	preferencesUpdated, err := preferences.SaveNotificationPreferences(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, preferencesUpdated)
+}
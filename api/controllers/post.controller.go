@@ -1,180 +1,429 @@
 package controllers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/rizalreza/golang-restful/api/auth"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
 	"github.com/rizalreza/golang-restful/api/models"
 	"github.com/rizalreza/golang-restful/api/responses"
 	"github.com/rizalreza/golang-restful/api/utils/formaterror"
+	"github.com/rizalreza/golang-restful/api/utils/slug"
 )
 
-func (server *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
+// postIncludes reads the include query parameter (e.g. ?include=author,category)
+// and returns the post associations to eager load. Every association is
+// loaded when the parameter is absent, and none when it is empty.
+func postIncludes(r *http.Request) ([]string, error) {
+	values, ok := r.URL.Query()["include"]
+	if !ok {
+		return []string{"Author", "Category", "Tags"}, nil
+	}
+
+	includes := []string{}
+	for _, name := range splitList(values) {
+		name = strings.ToLower(strings.TrimSpace(name))
+		include, ok := models.PostIncludes[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown include: %s", name)
+		}
+		includes = append(includes, include)
+	}
+	return includes, nil
+}
+
+// splitList reads a list parameter given either repeated (?tags=a&tags=b)
+// or comma separated (?tags=a,b), skipping blank entries
+func splitList(values []string) []string {
+	list := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// formTags returns the tag names sent in the tags form field, and whether
+// the field was sent at all
+func formTags(r *http.Request) ([]string, bool) {
+	r.FormValue("tags") // makes sure the form is parsed
+	values, ok := r.Form["tags"]
+	return splitList(values), ok
+}
+
+// formTime parses an optional RFC 3339 form field such as published_at
+func formTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.FormValue(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s, expected a date like 2006-01-02T15:04:05Z", name)
+	}
+	return &t, nil
+}
+
+// postInput is a post as sent to create or update it
+type postInput struct {
+	Title       string
+	Content     string
+	AuthorID    uint32
+	CategoryID  uint32
+	Status      string
+	PublishedAt *time.Time
+	// Tags replace those of the post when SetTags is true
+	Tags    []string
+	SetTags bool
+}
+
+// createPost saves a new post of user uid, a draft unless in says otherwise
+func (server *Server) createPost(uid uint32, in postInput, includes []string) (*models.Post, error) {
 	post := models.Post{}
 	category := models.Category{}
 
-	authorid, err := strconv.Atoi(r.FormValue("author_id"))
+	post.Title = in.Title
+	post.AuthorID = in.AuthorID
+	post.Content = in.Content
+	post.CategoryID = in.CategoryID
+
+	post.Prepare()
+
+	err := post.Validate()
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
 	}
 
-	categoryid, err := strconv.Atoi(r.FormValue("category_id"))
+	// New posts are drafts unless asked otherwise
+	status := in.Status
+	if status == "" {
+		status = models.PostDraft
+	}
+	err = post.SetStatus(status, in.PublishedAt)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
 	}
 
-	post.Title = r.FormValue("title")
-	post.AuthorID = uint32(authorid)
-	post.Content = r.FormValue("content")
-	post.CategoryID = uint32(categoryid)
+	if uid == 0 || uid != post.AuthorID {
+		return nil, withStatus(http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	}
 
-	post.Prepare()
+	// Check if category_id is valid data
+	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", post.CategoryID).Take(&category).Error
+	if err != nil {
+		return nil, withStatus(http.StatusNotFound, errors.New("Category ID not found on our data"))
+	}
 
-	err = post.Validate()
+	if in.SetTags {
+		post.Tags, err = models.FindOrCreateTags(server.DB, in.Tags)
+		if err != nil {
+			return nil, withStatus(http.StatusUnprocessableEntity, err)
+		}
+	}
+
+	postCreated, err := post.SavePost(server.DB, includes...)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return nil, formaterror.FormatError(err.Error())
+	}
+	server.eventBus().Publish(events.Event{Type: events.PostCreated, ActorID: postCreated.AuthorID, PostID: postCreated.ID, Data: postCreated})
+	return postCreated, nil
+}
+
+func (server *Server) CreatePost(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
 
-	uid, err := auth.ExtractTokenID(r)
+	includes, err := postIncludes(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	if uid != post.AuthorID {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	authorid, err := strconv.Atoi(r.FormValue("author_id"))
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	// Check if category_id is valid data
-	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", categoryid).Take(&category).Error
+	categoryid, err := strconv.Atoi(r.FormValue("category_id"))
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Category ID not found on our data"))
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
 
-	postCreated, err := post.SavePost(server.DB)
+	publishedAt, err := formTime(r, "published_at")
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	in := postInput{
+		Title:       r.FormValue("title"),
+		Content:     r.FormValue("content"),
+		AuthorID:    uint32(authorid),
+		CategoryID:  uint32(categoryid),
+		Status:      r.FormValue("status"),
+		PublishedAt: publishedAt,
+	}
+	in.Tags, in.SetTags = formTags(r)
+
+	postCreated, err := server.createPost(user.ID, in, includes)
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, postCreated.ID))
-	responses.JSON(w, http.StatusCreated, postCreated)
+	responses.SPARSE_JSON(w, r, http.StatusCreated, postCreated)
 }
 
 func (server *Server) GetPosts(w http.ResponseWriter, r *http.Request) {
 
 	post := models.Post{}
 
-	posts, err := post.GetAllPost(server.DB)
+	includes, err := postIncludes(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, posts)
-}
 
-func (server *Server) GetPostById(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	// Filter by tags, matching any of them unless tags_match=all
+	query := r.URL.Query()
+	match := query.Get("tags_match")
+	if match != "" && match != "any" && match != "all" {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("tags_match must be any or all"))
+		return
+	}
+	slugs := []string{}
+	for _, name := range splitList(query["tags"]) {
+		slugs = append(slugs, slug.Make(models.NormalizeTagName(name)))
+	}
+
+	// Only the author sees posts that are not published
+	db := server.DB.Scopes(models.PostsVisibleTo(viewerID(r)), models.PostsTagged(slugs, match == "all"))
+
+	// Filter by category, and optionally the categories nested under it
+	categoryID, err := queryUint(r, "category_id", 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
+	descendants := false
+	if value := query.Get("include_descendants"); value != "" {
+		descendants, err = strconv.ParseBool(value)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid include_descendants"))
+			return
+		}
+	}
+	if categoryID != 0 {
+		categories := []uint32{uint32(categoryID)}
+		if descendants {
+			categories, err = models.CategoryDescendants(server.DB, uint32(categoryID))
+			if err != nil {
+				responses.ERROR(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		db = db.Where("posts.category_id IN (?)", categories)
+	}
 
-	post := models.Post{}
-	postRecieved, err := post.FindPostById(server.DB, pid)
+	switch query.Get("sort") {
+	case "":
+	case "popular":
+		db = db.Scopes(models.PostsByPopularity)
+	default:
+		responses.ERROR(w, http.StatusBadRequest, errors.New("sort must be popular"))
+		return
+	}
+
+	posts, err := post.GetAllPost(db, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = models.LoadReactions(server.DB, *posts, viewerID(r))
 	if err != nil {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, postRecieved)
+	responses.SPARSE_JSON(w, r, http.StatusOK, posts)
 }
 
-func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
+// GetPostById looks the post up by ID or by slug. An old slug redirects to
+// the current one.
+func (server *Server) GetPostById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 
-	// Check if the post id is valid
-	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	includes, err := postIncludes(r)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	//CHeck if the auth token is valid and  get the user id from it
-	uid, err := auth.ExtractTokenID(r)
+	post := models.Post{}
+	var postRecieved *models.Post
+	if pid, err := strconv.ParseUint(vars["id"], 10, 64); err == nil {
+		postRecieved, err = post.FindPostById(server.DB, pid, includes...)
+		if err != nil {
+			responses.ERROR(w, http.StatusInternalServerError, err)
+			return
+		}
+	} else {
+		postRecieved, err = post.FindPostBySlug(server.DB, vars["id"], includes...)
+		if gorm.IsRecordNotFoundError(err) && server.redirectSlug(w, r, models.SlugPost, vars["id"]) {
+			return
+		}
+		if err != nil {
+			responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+			return
+		}
+	}
+	if !postRecieved.IsVisibleTo(viewerID(r)) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	posts := []models.Post{*postRecieved}
+	err = models.LoadReactions(server.DB, posts, viewerID(r))
 	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, posts[0])
+}
+
+// updatePost changes post pid of user uid. Its status is left as it is.
+func (server *Server) updatePost(uid uint32, pid uint64, in postInput, includes []string) (*models.Post, error) {
+	if uid == 0 {
+		return nil, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+	}
 
 	// Check if the post exist
 	post := models.Post{}
-	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	err := server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
-		return
+		return nil, withStatus(http.StatusNotFound, errors.New("Post not found"))
 	}
 
 	// If a user attempt to update a post not belonging to him
 	if uid != post.AuthorID {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
+		return nil, withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+	}
+
+	// Check if category_id is valid data
+	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", in.CategoryID).Take(&models.Category{}).Error
+	if err != nil {
+		return nil, withStatus(http.StatusNotFound, errors.New("Category ID not found on our data"))
 	}
 
-	// Start processing the request data
 	postUpdate := models.Post{}
+	postUpdate.Title = in.Title
+	postUpdate.AuthorID = uid
+	postUpdate.CategoryID = in.CategoryID
+	postUpdate.Content = in.Content
 
-	cid, err := strconv.Atoi(r.FormValue("category_id"))
+	postUpdate.Prepare()
+	err = postUpdate.Validate()
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
-		return
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
 	}
 
-	// Check if category_id is valid data
-	err = server.DB.Debug().Model(models.Category{}).Where("id = ?", cid).Take(&models.Category{}).Error
+	postUpdate.ID = post.ID //this is important to tell the model the post id to update, the other update field are set above
+
+	// Tags are only replaced when they are sent
+	if in.SetTags {
+		postUpdate.Tags, err = models.FindOrCreateTags(server.DB, in.Tags)
+		if err != nil {
+			return nil, withStatus(http.StatusUnprocessableEntity, err)
+		}
+	}
+
+	postUpdated, err := postUpdate.UpdatePost(server.DB, includes...)
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Category ID not found on our data"))
-		return
+		return nil, formaterror.FormatError(err.Error())
 	}
+	server.eventBus().Publish(events.Event{Type: events.PostUpdated, ActorID: uid, PostID: postUpdated.ID, Data: postUpdated})
+	return postUpdated, nil
+}
 
-	// Initial data from request form-data
-	postUpdate.Title = r.FormValue("title")
-	postUpdate.AuthorID = uid
-	postUpdate.CategoryID = uint32(cid)
-	postUpdate.Content = r.FormValue("content")
+func (server *Server) UpdatePost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	// Check if the post id is valid
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
 
-	//Also check if the request user id is equal to the one gotten from token
-	if uid != postUpdate.AuthorID {
+	user := server.currentUser(r)
+	if user == nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
 
-	postUpdate.Prepare()
-	err = postUpdate.Validate()
+	includes, err := postIncludes(r)
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
 
-	postUpdate.ID = post.ID //this is important to tell the model the post id to update, the other update field are set above
+	cid, err := strconv.Atoi(r.FormValue("category_id"))
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
 
-	postUpdated, err := postUpdate.UpdatePost(server.DB)
+	// Initial data from request form-data
+	in := postInput{
+		Title:      r.FormValue("title"),
+		Content:    r.FormValue("content"),
+		CategoryID: uint32(cid),
+	}
+	in.Tags, in.SetTags = formTags(r)
 
+	postUpdated, err := server.updatePost(user.ID, pid, in, includes)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		writeError(w, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, postUpdated)
+	responses.SPARSE_JSON(w, r, http.StatusOK, postUpdated)
+}
+
+// deletePost moves post pid of user uid to the trash
+func (server *Server) deletePost(uid uint32, pid uint64) error {
+	if uid == 0 {
+		return withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+	}
+
+	// Check if the post exist
+	post := models.Post{}
+	err := server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil {
+		return withStatus(http.StatusNotFound, errors.New("Data not found"))
+	}
+
+	// Is the authenticated user, the owner of this post?
+	if uid != post.AuthorID {
+		return withStatus(http.StatusUnauthorized, errors.New("Unauthorized"))
+	}
+	_, err = post.DeletePost(server.DB, pid, uid)
+	if err != nil {
+		return withStatus(http.StatusBadRequest, err)
+	}
+	server.eventBus().Publish(events.Event{Type: events.PostDeleted, ActorID: uid, PostID: pid, Data: &post})
+	return nil
 }
 
 func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
@@ -188,31 +437,96 @@ func (server *Server) DeletePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Is this user authenticated?
-	uid, err := auth.ExtractTokenID(r)
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	err = server.deletePost(user.ID, pid)
 	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", pid))
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+func (server *Server) PublishPost(w http.ResponseWriter, r *http.Request) {
+	server.setPostStatus(w, r, models.PostPublished)
+}
+
+func (server *Server) UnpublishPost(w http.ResponseWriter, r *http.Request) {
+	server.setPostStatus(w, r, models.PostDraft)
+}
+
+func (server *Server) ArchivePost(w http.ResponseWriter, r *http.Request) {
+	server.setPostStatus(w, r, models.PostArchived)
+}
+
+// PublishDuePosts publishes the scheduled posts whose time has come, telling
+// the features that react to post updates about each of them
+func (server *Server) PublishDuePosts(ctx context.Context) error {
+	published, err := models.PublishDuePosts(server.DB, time.Now())
+	for i := range published {
+		post := &published[i]
+		server.eventBus().Publish(events.Event{Type: events.PostUpdated, ActorID: post.AuthorID, PostID: post.ID, Data: post})
+	}
+	return err
+}
+
+// setPostStatus lets the author move a post through its lifecycle. Publishing
+// with a future published_at schedules the post.
+func (server *Server) setPostStatus(w http.ResponseWriter, r *http.Request, status string) {
+	vars := mux.Vars(r)
+
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
 
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
 	// Check if the post exist
 	post := models.Post{}
 	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
 	if err != nil {
-		responses.ERROR(w, http.StatusNotFound, errors.New("Data not found"))
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
 		return
 	}
 
-	// Is the authenticated user, the owner of this post?
-	if uid != post.AuthorID {
+	if user.ID != post.AuthorID {
 		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	_, err = post.DeletePost(server.DB, pid, uid)
+
+	publishedAt, err := formTime(r, "published_at")
 	if err != nil {
-		responses.ERROR(w, http.StatusBadRequest, err)
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", pid))
-	responses.JSON(w, http.StatusNoContent, "")
+	err = post.SetStatus(status, publishedAt)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	postUpdated, err := post.UpdatePostStatus(server.DB, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	server.eventBus().Publish(events.Event{Type: events.PostUpdated, ActorID: user.ID, PostID: postUpdated.ID, Data: postUpdated})
+	responses.SPARSE_JSON(w, r, http.StatusOK, postUpdated)
 }
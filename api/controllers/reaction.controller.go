@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// reactionPost returns the post named by vars["id"] when the current user
+// can read it, along with that user. It writes the error otherwise.
+func (server *Server) reactionPost(w http.ResponseWriter, r *http.Request) (*models.Post, *models.User, bool) {
+	pid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, nil, false
+	}
+	if !models.ValidReaction(mux.Vars(r)["type"]) {
+		responses.ERROR(w, http.StatusUnprocessableEntity,
+			fmt.Errorf("%s, use one of %s", models.ErrInvalidReaction, strings.Join(models.ReactionTypes, ", ")))
+		return nil, nil, false
+	}
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(user.ID) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return nil, nil, false
+	}
+	return &post, user, true
+}
+
+// PutReaction adds a reaction of the current user to a post. Reacting again
+// with the same type changes nothing.
+func (server *Server) PutReaction(w http.ResponseWriter, r *http.Request) {
+	post, user, ok := server.reactionPost(w, r)
+	if !ok {
+		return
+	}
+
+	reaction := mux.Vars(r)["type"]
+	added, err := models.React(server.DB, post.ID, user.ID, reaction)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	if added {
+		server.eventBus().Publish(events.Event{
+			Type: events.ReactionAdded, ActorID: user.ID, UserID: post.AuthorID, PostID: post.ID, Reaction: reaction,
+		})
+	}
+	summary, err := models.GetReactionSummary(server.DB, post.ID, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, summary)
+}
+
+// DeleteReaction takes a reaction of the current user off a post, if it
+// was there
+func (server *Server) DeleteReaction(w http.ResponseWriter, r *http.Request) {
+	post, user, ok := server.reactionPost(w, r)
+	if !ok {
+		return
+	}
+
+	err := models.Unreact(server.DB, post.ID, user.ID, mux.Vars(r)["type"])
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
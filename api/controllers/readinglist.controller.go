@@ -0,0 +1,277 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/utils/formaterror"
+)
+
+// formBool reads an optional boolean form field, returning current when it
+// is absent
+func formBool(r *http.Request, name string, current bool) (bool, error) {
+	if _, ok := r.Form[name]; !ok {
+		return current, nil
+	}
+	value, err := strconv.ParseBool(r.Form.Get(name))
+	if err != nil {
+		return false, fmt.Errorf("Invalid %s", name)
+	}
+	return value, nil
+}
+
+// readingList returns the reading list named by vars["id"] when it belongs
+// to the current user. It writes the error otherwise; the lists of others
+// are not found rather than forbidden, so their ids don't leak.
+func (server *Server) readingList(w http.ResponseWriter, r *http.Request) (*models.ReadingList, *models.User, bool) {
+	lid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, nil, false
+	}
+	list := models.ReadingList{}
+	_, err = list.FindReadingListById(server.DB, lid)
+	if err != nil || list.OwnerID != user.ID {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Reading list not found"))
+		return nil, nil, false
+	}
+	return &list, user, true
+}
+
+func (server *Server) GetReadingLists(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	lists, err := models.GetReadingLists(server.DB, user.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, lists)
+}
+
+func (server *Server) CreateReadingList(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	list := models.ReadingList{}
+	list.Name = r.FormValue("name")
+	public, err := formBool(r, "public", false)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	list.Prepare()
+	list.OwnerID = user.ID
+	err = list.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = list.SetPublic(public)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	listCreated, err := list.SaveReadingList(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, listCreated.ID))
+	responses.SPARSE_JSON(w, r, http.StatusCreated, listCreated)
+}
+
+// GetReadingList returns a list of the current user with its posts in
+// order. Posts deleted or unpublished since they were saved are flagged.
+func (server *Server) GetReadingList(w http.ResponseWriter, r *http.Request) {
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	list, user, ok := server.readingList(w, r)
+	if !ok {
+		return
+	}
+
+	err = list.LoadItems(server.DB, user.ID, false, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, list)
+}
+
+// UpdateReadingList renames the list or changes its sharing. Making a list
+// public creates its share link; making it private again revokes the link
+// for good.
+func (server *Server) UpdateReadingList(w http.ResponseWriter, r *http.Request) {
+	list, user, ok := server.readingList(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	public, err := formBool(r, "public", list.Public)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	update := models.ReadingList{Name: r.Form.Get("name")}
+	update.Prepare()
+	if _, ok := r.Form["name"]; !ok {
+		update.Name = list.Name
+	}
+	update.ID = list.ID
+	update.ShareToken = list.ShareToken
+	err = update.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = update.SetPublic(public)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	listUpdated, err := update.UpdateReadingList(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	err = listUpdated.LoadItems(server.DB, user.ID, false)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, listUpdated)
+}
+
+func (server *Server) DeleteReadingList(w http.ResponseWriter, r *http.Request) {
+	list, _, ok := server.readingList(w, r)
+	if !ok {
+		return
+	}
+
+	err := list.DeleteReadingList(server.DB, list.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// SaveToReadingList adds a post the current user can read to their list,
+// or moves it there when position is given
+func (server *Server) SaveToReadingList(w http.ResponseWriter, r *http.Request) {
+	list, user, ok := server.readingList(w, r)
+	if !ok {
+		return
+	}
+	pid, err := strconv.ParseUint(mux.Vars(r)["postId"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	position := 0
+	if value := r.FormValue("position"); value != "" {
+		n, err := strconv.ParseUint(value, 10, 31)
+		if err != nil || n == 0 {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid position"))
+			return
+		}
+		position = int(n)
+	}
+
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(user.ID) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+
+	err = models.SaveToReadingList(server.DB, list.ID, post.ID, position)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Reading list not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	err = list.LoadItems(server.DB, user.ID, false)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, list)
+}
+
+func (server *Server) RemoveFromReadingList(w http.ResponseWriter, r *http.Request) {
+	list, _, ok := server.readingList(w, r)
+	if !ok {
+		return
+	}
+	pid, err := strconv.ParseUint(mux.Vars(r)["postId"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = models.RemoveFromReadingList(server.DB, list.ID, pid)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// GetSharedReadingList serves a public list to anyone with its share link.
+// Only the posts that are still published are shown.
+func (server *Server) GetSharedReadingList(w http.ResponseWriter, r *http.Request) {
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	list := models.ReadingList{}
+	_, err = list.FindReadingListByShareToken(server.DB, mux.Vars(r)["token"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Reading list not found"))
+		return
+	}
+	err = list.LoadItems(server.DB, 0, true, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, list)
+}
@@ -0,0 +1,83 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/realtime"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// realtimeQueue is how many messages a connection may fall behind before it
+// is dropped
+const realtimeQueue = 64
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Connections are authenticated with a token rather than cookies, so
+	// other origins can't act for a user
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// realtimeHub returns the hub of the rooms of posts
+func (server *Server) realtimeHub() *realtime.Hub {
+	server.realtimeOnce.Do(func() {
+		if server.Realtime == nil {
+			server.Realtime = realtime.NewHub(realtime.NewLocalBroadcaster(), realtimeQueue)
+		}
+	})
+	return server.Realtime
+}
+
+// roomEvent sends the comments approved on a post to its room
+func (server *Server) roomEvent(e events.Event) {
+	if e.Type != events.CommentCreated {
+		return
+	}
+	comment, ok := e.Data.(*models.Comment)
+	if !ok {
+		return
+	}
+	body, err := json.Marshal(comment)
+	if err != nil {
+		log.Printf("Cannot send %s event to its room: %v", e.Type, err)
+		return
+	}
+	server.realtimeHub().Broadcast(comment.PostID, realtime.Comment, body)
+}
+
+// authorizeRoom lets users in the rooms of the posts they can see
+func (server *Server) authorizeRoom(member realtime.Member, postID uint64) error {
+	post := models.Post{}
+	err := server.DB.Debug().Model(models.Post{}).Where("id = ?", postID).Take(&post).Error
+	if err != nil || !post.IsVisibleTo(member.ID) {
+		return errors.New("Post not found")
+	}
+	return nil
+}
+
+// ConnectRealtime upgrades the request to a WebSocket joining the rooms of
+// posts: who is in them and typing, and the comments approved on them
+func (server *Server) ConnectRealtime(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	// The bus only feeds the rooms once it is up
+	server.eventBus()
+	hub := server.realtimeHub()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has written the error
+		return
+	}
+	hub.Serve(conn, realtime.Member{ID: user.ID, Username: user.Username}, server.authorizeRoom)
+}
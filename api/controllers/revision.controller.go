@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/utils/formaterror"
+)
+
+// revisionPost returns the post named in the URL when the current user may
+// see its history: its author, or a moderator. It writes the error otherwise.
+func (server *Server) revisionPost(w http.ResponseWriter, r *http.Request) (*models.Post, *models.User, bool) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, nil, false
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, nil, false
+	}
+
+	post := models.Post{}
+	err = server.DB.Debug().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return nil, nil, false
+	}
+	if post.AuthorID != user.ID && !user.IsModerator() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, nil, false
+	}
+	return &post, user, true
+}
+
+// findRevision loads revision number vars[name] of the post
+func (server *Server) findRevision(w http.ResponseWriter, r *http.Request, pid uint64, name string) (*models.PostRevision, bool) {
+	number, err := strconv.ParseUint(mux.Vars(r)[name], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	revision := models.PostRevision{}
+	revisionFound, err := revision.FindPostRevision(server.DB, pid, uint32(number))
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Revision not found"))
+		return nil, false
+	}
+	return revisionFound, true
+}
+
+func (server *Server) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	post, _, ok := server.revisionPost(w, r)
+	if !ok {
+		return
+	}
+
+	revision := models.PostRevision{}
+	revisions, err := revision.GetPostRevisions(server.DB, post.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, revisions)
+}
+
+func (server *Server) GetPostRevision(w http.ResponseWriter, r *http.Request) {
+	post, _, ok := server.revisionPost(w, r)
+	if !ok {
+		return
+	}
+
+	revision, ok := server.findRevision(w, r, post.ID, "rev")
+	if !ok {
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, revision)
+}
+
+// DiffPostRevisions compares revision {rev} with revision {other} line by line
+func (server *Server) DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	post, _, ok := server.revisionPost(w, r)
+	if !ok {
+		return
+	}
+
+	from, ok := server.findRevision(w, r, post.ID, "rev")
+	if !ok {
+		return
+	}
+	to, ok := server.findRevision(w, r, post.ID, "other")
+	if !ok {
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, models.DiffPostRevisions(from, to))
+}
+
+// RestorePostRevision puts an earlier revision back, recording a new revision
+func (server *Server) RestorePostRevision(w http.ResponseWriter, r *http.Request) {
+	post, user, ok := server.revisionPost(w, r)
+	if !ok {
+		return
+	}
+
+	// Moderators may read the history, only the author may rewrite the post
+	if post.AuthorID != user.ID {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	revision, ok := server.findRevision(w, r, post.ID, "rev")
+	if !ok {
+		return
+	}
+
+	postRestored, err := revision.RestorePostRevision(server.DB, user.ID, includes...)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, postRestored)
+}
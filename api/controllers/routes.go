@@ -1,34 +1,463 @@
 package controllers
 
-import "github.com/rizalreza/golang-restful/api/middlewares"
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/middlewares"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/openapi"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/search"
+)
+
+// route is an endpoint served by every API version. Doc describes it in the
+// OpenAPI document; its Method and Path are taken from the route.
+type route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	Doc     openapi.Endpoint
+}
+
+// Legacy unversioned routes are aliases of v1 and will be removed at legacySunset
+var (
+	legacyDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	legacySunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
+var (
+	includeParam = openapi.QueryParam{Name: "include", Description: "Comma separated associations to embed: author, category, tags, media"}
+	fieldsParam  = openapi.QueryParam{Name: "fields", Description: "Comma separated fields to return, e.g. id,title,author.username"}
+	cursorParam  = openapi.QueryParam{Name: "cursor", Description: "Where to start, from meta.next_cursor of the previous page"}
+	limitParam   = openapi.QueryParam{Name: "limit", Description: "Results per page, 20 by default and at most 100"}
+)
+
+func (s *Server) routes() []route {
+	return []route{
+		// Home Route
+		{"GET", "/", middlewares.SetMiddlewareJSON(s.Home), openapi.Endpoint{
+			Summary: "Welcome message", Tags: []string{"home"}, Response: "",
+		}},
+
+		// Login Route
+		{"POST", "/login", middlewares.SetMiddlewareJSON(s.Login), openapi.Endpoint{
+			Summary: "Log in and get an access token", Tags: []string{"auth"},
+			Form: loginForm{}, Response: responses.AuthResponse{User: models.SelfUser{}},
+		}},
+		{"POST", "/register", middlewares.SetMiddlewareJSON(s.Register), openapi.Endpoint{
+			Summary: "Create an account and get an access token", Tags: []string{"auth"},
+			Form: userForm{}, Status: http.StatusCreated, Response: responses.AuthResponse{User: models.SelfUser{}},
+		}},
+
+		//Users routes
+		{"POST", "/users", middlewares.SetMiddlewareJSON(s.CreateUser), openapi.Endpoint{
+			Summary: "Create a user", Tags: []string{"users"}, Query: []openapi.QueryParam{fieldsParam},
+			Form: userForm{}, Status: http.StatusCreated, Response: models.SelfUser{},
+		}},
+		{"GET", "/users", middlewares.SetMiddlewareJSON(s.GetUsers), openapi.Endpoint{
+			Summary: "List users", Tags: []string{"users"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.PublicUser{},
+		}},
+		{"GET", "/users/{id}", middlewares.SetMiddlewareJSON(s.GetUserById), openapi.Endpoint{
+			Summary: "Get a user, with email for themselves and admins", Tags: []string{"users"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.AdminUser{},
+		}},
+		{"PUT", "/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser)), openapi.Endpoint{
+			Summary: "Update your account", Tags: []string{"users"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: userForm{}, Response: models.SelfUser{},
+		}},
+		{"DELETE", "/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser), openapi.Endpoint{
+			Summary: "Delete your account", Tags: []string{"users"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"POST", "/users/{id}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RestoreUser)), openapi.Endpoint{
+			Summary: "Restore your deleted account, or any as an admin", Tags: []string{"trash"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.AdminUser{},
+		}},
+
+		//Category routes
+		{"POST", "/category", middlewares.SetMiddlewareJSON(s.CreateCategory), openapi.Endpoint{
+			Summary: "Create a category", Tags: []string{"categories"}, Query: []openapi.QueryParam{fieldsParam},
+			Form: categoryForm{}, Status: http.StatusCreated, Response: models.Category{},
+		}},
+		{"POST", "/category:batch", middlewares.SetMiddlewareJSON(s.BatchCategories), openapi.Endpoint{
+			Summary: "Create, update and delete up to 500 categories, with a result per item in their order",
+			Tags:    []string{"categories"}, Body: categoryBatchBody{}, Response: batchResponse{},
+		}},
+		{"GET", "/category", middlewares.SetMiddlewareJSON(s.GetCategories), openapi.Endpoint{
+			Summary: "List categories", Tags: []string{"categories"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Category{},
+		}},
+		{"GET", "/category/tree", middlewares.SetMiddlewareJSON(s.GetCategoryTree), openapi.Endpoint{
+			Summary: "Get the categories as a tree", Tags: []string{"categories"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Category{},
+		}},
+		{"GET", "/category/{id}", middlewares.SetMiddlewareJSON(s.GetCategoryById), openapi.Endpoint{
+			Summary: "Get a category by ID or slug with its breadcrumbs, old slugs redirect with a 301", Tags: []string{"categories"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Category{},
+		}},
+		{"PUT", "/category/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateCategory)), openapi.Endpoint{
+			Summary: "Update a category", Tags: []string{"categories"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: categoryForm{}, Response: models.Category{},
+		}},
+		{"DELETE", "/category/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteCategory), openapi.Endpoint{
+			Summary: "Delete a category", Tags: []string{"categories"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"POST", "/category/{id}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RestoreCategory)), openapi.Endpoint{
+			Summary: "Restore a deleted category and its posts, as an admin", Tags: []string{"trash"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Category{},
+		}},
+
+		//Posts routes
+		{"POST", "/posts", middlewares.SetMiddlewareJSON(s.CreatePost), openapi.Endpoint{
+			Summary: "Create a post", Tags: []string{"posts"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Form: postForm{}, Status: http.StatusCreated, Response: models.Post{},
+		}},
+		{"POST", "/posts:batch", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.BatchPosts)), openapi.Endpoint{
+			Summary: "Create, update and delete up to 500 of your posts, with a result per item in their order",
+			Tags:    []string{"posts"}, Auth: true, Body: postBatchBody{}, Response: batchResponse{},
+		}},
+		{"GET", "/posts", middlewares.SetMiddlewareJSON(s.GetPosts), openapi.Endpoint{
+			Summary: "List posts", Tags: []string{"posts"}, Query: []openapi.QueryParam{includeParam, fieldsParam,
+				{Name: "tags", Description: "Comma separated tags the posts must have"},
+				{Name: "tags_match", Description: "any (default) or all of the tags"},
+				{Name: "category_id", Description: "Only posts in this category"},
+				{Name: "include_descendants", Description: "true to include the posts of the categories nested under category_id"},
+				{Name: "sort", Description: "popular to list the most reacted to posts first"},
+			},
+			Response: []models.Post{},
+		}},
+		{"GET", "/posts/{id}", middlewares.SetMiddlewareJSON(s.GetPostById), openapi.Endpoint{
+			Summary: "Get a post by ID or slug, old slugs redirect with a 301", Tags: []string{"posts"}, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.Post{},
+		}},
+		{"PUT", "/posts/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePost)), openapi.Endpoint{
+			Summary: "Update your post", Tags: []string{"posts"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Form: postForm{}, Response: models.Post{},
+		}},
+		{"DELETE", "/posts/{id}", middlewares.SetMiddlewareAuthentication(s.DeletePost), openapi.Endpoint{
+			Summary: "Delete your post", Tags: []string{"posts"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"POST", "/posts/{id}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RestorePost)), openapi.Endpoint{
+			Summary: "Restore your deleted post", Tags: []string{"trash"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.Post{},
+		}},
+
+		{"POST", "/posts/{id}/publish", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.PublishPost)), openapi.Endpoint{
+			Summary: "Publish your post now, or schedule it with a future published_at", Tags: []string{"posts"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Form: publishForm{}, Response: models.Post{},
+		}},
+		{"POST", "/posts/{id}/unpublish", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UnpublishPost)), openapi.Endpoint{
+			Summary: "Turn your post back into a draft", Tags: []string{"posts"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.Post{},
+		}},
+		{"POST", "/posts/{id}/archive", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ArchivePost)), openapi.Endpoint{
+			Summary: "Archive your post", Tags: []string{"posts"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.Post{},
+		}},
+
+		//Search routes
+		{"GET", "/search", middlewares.SetMiddlewareJSON(s.SearchPosts), openapi.Endpoint{
+			Summary: "Search post titles and content, most relevant first", Tags: []string{"search"}, Query: []openapi.QueryParam{
+				{Name: "q", Description: "Words to search for"},
+				{Name: "category_id", Description: "Only posts in this category"},
+				{Name: "author_id", Description: "Only posts by this author"},
+				{Name: "from", Description: "Only posts published on or after this date, e.g. 2006-01-02"},
+				{Name: "to", Description: "Only posts published on or before this date"},
+				{Name: "limit", Description: "Results per page, 20 by default and at most 100"},
+				{Name: "offset", Description: "Results to skip"},
+				includeParam, fieldsParam,
+			},
+			Response: []search.Result{},
+		}},
+
+		//Trash routes
+		{"GET", "/trash", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetTrash)), openapi.Endpoint{
+			Summary: "List your deleted posts, or everything deleted as an admin", Tags: []string{"trash"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Trash{},
+		}},
+
+		//Revisions routes
+		{"GET", "/posts/{id}/revisions", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPostRevisions)), openapi.Endpoint{
+			Summary: "List the revisions of your post, newest first", Tags: []string{"revisions"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.PostRevision{},
+		}},
+		{"GET", "/posts/{id}/revisions/{rev}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPostRevision)), openapi.Endpoint{
+			Summary: "Get a revision of your post", Tags: []string{"revisions"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.PostRevision{},
+		}},
+		{"GET", "/posts/{id}/revisions/{rev}/diff/{other}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.DiffPostRevisions)), openapi.Endpoint{
+			Summary: "Line-level diff from revision rev to revision other", Tags: []string{"revisions"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.RevisionDiff{},
+		}},
+		{"POST", "/posts/{id}/revisions/{rev}/restore", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RestorePostRevision)), openapi.Endpoint{
+			Summary: "Restore a revision of your post as a new revision", Tags: []string{"revisions"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.Post{},
+		}},
+
+		//Media routes
+		{"POST", "/media", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UploadMedia)), openapi.Endpoint{
+			Summary: "Upload a file as multipart form-data, optionally attaching it to your post", Tags: []string{"media"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: mediaForm{}, Status: http.StatusCreated, Response: models.Media{},
+		}},
+		{"GET", "/media/{id}", s.GetMedia, openapi.Endpoint{
+			Summary: "Download your file or one attached to a post you may read, with Range and cache validation support", Tags: []string{"media"},
+			Response: openapi.File{}, ContentType: "application/octet-stream",
+		}},
+		{"GET", "/media/{id}/thumbnail", s.GetMediaThumbnail, openapi.Endpoint{
+			Summary: "Download the thumbnail of an image you may download", Tags: []string{"media"},
+			Response: openapi.File{}, ContentType: "image/*",
+		}},
+		{"DELETE", "/media/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteMedia), openapi.Endpoint{
+			Summary: "Delete your file, detaching it from your posts", Tags: []string{"media"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"GET", "/posts/{id}/media", middlewares.SetMiddlewareJSON(s.GetPostMedia), openapi.Endpoint{
+			Summary: "List the files attached to a post", Tags: []string{"media"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Media{},
+		}},
+		{"PUT", "/posts/{id}/media/{mediaId}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.AttachMedia)), openapi.Endpoint{
+			Summary: "Attach one of your files to your post", Tags: []string{"media"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Media{},
+		}},
+		{"DELETE", "/posts/{id}/media/{mediaId}", middlewares.SetMiddlewareAuthentication(s.DetachMedia), openapi.Endpoint{
+			Summary: "Detach a file from your post", Tags: []string{"media"}, Auth: true, Status: http.StatusNoContent,
+		}},
+
+		//Reactions routes
+		{"PUT", "/posts/{id}/reactions/{type}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.PutReaction)), openapi.Endpoint{
+			Summary: "React to a post with like, love, laugh, wow, sad or angry", Tags: []string{"reactions"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.ReactionSummary{},
+		}},
+		{"DELETE", "/posts/{id}/reactions/{type}", middlewares.SetMiddlewareAuthentication(s.DeleteReaction), openapi.Endpoint{
+			Summary: "Take your reaction off a post", Tags: []string{"reactions"}, Auth: true, Status: http.StatusNoContent,
+		}},
+
+		//Follows routes
+		{"POST", "/users/{id}/follow", middlewares.SetMiddlewareAuthentication(s.FollowUser), openapi.Endpoint{
+			Summary: "Follow the posts of an author", Tags: []string{"follows"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"DELETE", "/users/{id}/follow", middlewares.SetMiddlewareAuthentication(s.UnfollowUser), openapi.Endpoint{
+			Summary: "Stop following an author", Tags: []string{"follows"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"GET", "/users/{id}/followers", middlewares.SetMiddlewareJSON(s.GetFollowers), openapi.Endpoint{
+			Summary: "List the followers of a user, latest first", Tags: []string{"follows"}, Query: []openapi.QueryParam{cursorParam, limitParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.PublicUser{}},
+		}},
+		{"GET", "/users/{id}/following", middlewares.SetMiddlewareJSON(s.GetFollowing), openapi.Endpoint{
+			Summary: "List the authors a user follows, latest first", Tags: []string{"follows"}, Query: []openapi.QueryParam{cursorParam, limitParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.PublicUser{}},
+		}},
+		{"GET", "/users/{id}/following/categories", middlewares.SetMiddlewareJSON(s.GetFollowedCategories), openapi.Endpoint{
+			Summary: "List the categories a user follows, latest first", Tags: []string{"follows"}, Query: []openapi.QueryParam{cursorParam, limitParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.Category{}},
+		}},
+		{"POST", "/category/{id}/follow", middlewares.SetMiddlewareAuthentication(s.FollowCategory), openapi.Endpoint{
+			Summary: "Follow the posts of a category", Tags: []string{"follows"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"DELETE", "/category/{id}/follow", middlewares.SetMiddlewareAuthentication(s.UnfollowCategory), openapi.Endpoint{
+			Summary: "Stop following a category", Tags: []string{"follows"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"GET", "/feed", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetFeed)), openapi.Endpoint{
+			Summary: "Published posts of the authors and categories you follow, newest first", Tags: []string{"follows"}, Auth: true, Query: []openapi.QueryParam{cursorParam, limitParam, includeParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.Post{}},
+		}},
+
+		//Reading lists routes
+		{"GET", "/me/lists", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetReadingLists)), openapi.Endpoint{
+			Summary: "List your reading lists", Tags: []string{"reading lists"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.ReadingList{},
+		}},
+		{"POST", "/me/lists", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateReadingList)), openapi.Endpoint{
+			Summary: "Create a reading list", Tags: []string{"reading lists"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: readingListForm{}, Status: http.StatusCreated, Response: models.ReadingList{},
+		}},
+		{"GET", "/me/lists/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetReadingList)), openapi.Endpoint{
+			Summary: "Get your reading list with its posts, flagging those no longer available", Tags: []string{"reading lists"}, Auth: true, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.ReadingList{},
+		}},
+		{"PUT", "/me/lists/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateReadingList)), openapi.Endpoint{
+			Summary: "Rename your reading list or share it, making it private revokes its link", Tags: []string{"reading lists"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: readingListForm{}, Response: models.ReadingList{},
+		}},
+		{"DELETE", "/me/lists/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteReadingList), openapi.Endpoint{
+			Summary: "Delete your reading list", Tags: []string{"reading lists"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"PUT", "/me/lists/{id}/posts/{postId}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.SaveToReadingList)), openapi.Endpoint{
+			Summary: "Save a post to your reading list, or move it", Tags: []string{"reading lists"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: readingListPostForm{}, Response: models.ReadingList{},
+		}},
+		{"DELETE", "/me/lists/{id}/posts/{postId}", middlewares.SetMiddlewareAuthentication(s.RemoveFromReadingList), openapi.Endpoint{
+			Summary: "Take a post off your reading list", Tags: []string{"reading lists"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"GET", "/lists/shared/{token}", middlewares.SetMiddlewareJSON(s.GetSharedReadingList), openapi.Endpoint{
+			Summary: "Read a shared reading list", Tags: []string{"reading lists"}, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: models.ReadingList{},
+		}},
+
+		//Notifications routes
+		{"GET", "/me/notifications", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetNotifications)), openapi.Endpoint{
+			Summary: "List your notifications, latest activity first, with the unread count in meta", Tags: []string{"notifications"}, Auth: true,
+			Query:    []openapi.QueryParam{{Name: "unread", Description: "true to list only unread notifications"}, cursorParam, limitParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.Notification{}},
+		}},
+		{"POST", "/me/notifications/read", middlewares.SetMiddlewareAuthentication(s.ReadNotifications), openapi.Endpoint{
+			Summary: "Mark your notifications as read", Tags: []string{"notifications"}, Auth: true,
+			Form: notificationReadForm{}, Status: http.StatusNoContent,
+		}},
+		{"GET", "/me/notifications/preferences", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetNotificationPreferences)), openapi.Endpoint{
+			Summary: "Get the kinds of notifications you get", Tags: []string{"notifications"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.NotificationPreferences{},
+		}},
+		{"PUT", "/me/notifications/preferences", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateNotificationPreferences)), openapi.Endpoint{
+			Summary: "Turn kinds of notifications on or off", Tags: []string{"notifications"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: notificationPreferencesForm{}, Response: models.NotificationPreferences{},
+		}},
+
+		//Webhooks routes
+		{"GET", "/webhooks", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWebhooks)), openapi.Endpoint{
+			Summary: "List the webhooks, as an admin", Tags: []string{"webhooks"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Webhook{},
+		}},
+		{"POST", "/webhooks", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateWebhook)), openapi.Endpoint{
+			Summary: "Subscribe a URL to events, as an admin; the signing secret is only shown here", Tags: []string{"webhooks"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: webhookForm{}, Status: http.StatusCreated, Response: models.Webhook{},
+		}},
+		{"GET", "/webhooks/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWebhook)), openapi.Endpoint{
+			Summary: "Get a webhook, as an admin", Tags: []string{"webhooks"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Webhook{},
+		}},
+		{"DELETE", "/webhooks/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteWebhook), openapi.Endpoint{
+			Summary: "Delete a webhook and its deliveries, as an admin", Tags: []string{"webhooks"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"GET", "/webhooks/{id}/deliveries", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWebhookDeliveries)), openapi.Endpoint{
+			Summary: "The delivery log of a webhook, newest first, as an admin", Tags: []string{"webhooks"}, Auth: true, Query: []openapi.QueryParam{cursorParam, limitParam, fieldsParam},
+			Response: responses.Envelope{Data: []models.WebhookDelivery{}},
+		}},
+		{"POST", "/webhooks/{id}/deliveries/{deliveryId}/redeliver", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RedeliverWebhook)), openapi.Endpoint{
+			Summary: "Send a delivery again, as an admin", Tags: []string{"webhooks"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Status: http.StatusAccepted, Response: models.WebhookDelivery{},
+		}},
+
+		//Events routes
+		{"GET", "/events", s.GetEvents, openapi.Endpoint{
+			Summary: "Server-sent events of posts and categories created, updated or deleted; resumes after the Last-Event-ID header", Tags: []string{"events"},
+			Query: []openapi.QueryParam{
+				{Name: "category", Description: "Only the events of this category and its posts"},
+				{Name: "author", Description: "Only the events of the posts of this author"},
+			},
+			Response: "", ContentType: "text/event-stream",
+		}},
+
+		//Realtime routes
+		{"GET", "/live", middlewares.SetMiddlewareAuthentication(s.ConnectRealtime), openapi.Endpoint{
+			Summary: "WebSocket of the rooms of posts: join, leave and typing messages naming a post_id, answered with presence, joins, leaves, typing and comments",
+			Tags:    []string{"realtime"}, Auth: true, Status: http.StatusSwitchingProtocols,
+		}},
+
+		//GraphQL routes
+		{"POST", "/graphql", middlewares.SetMiddlewareJSON(s.ServeGraphQL), openapi.Endpoint{
+			Summary: "Run a GraphQL query or mutation over users, posts and categories, sent as a JSON body",
+			Tags:    []string{"graphql"}, Response: graphqlResult{},
+		}},
+		{"GET", "/graphql", middlewares.SetMiddlewareJSON(s.ServeGraphQL), openapi.Endpoint{
+			Summary: "Run a GraphQL query over users, posts and categories, mutations are refused with a 405 and must be sent with POST",
+			Tags:    []string{"graphql"},
+			Query: []openapi.QueryParam{
+				{Name: "query", Description: "The GraphQL document"},
+				{Name: "operationName", Description: "The operation of the document to run, when it has several"},
+				{Name: "variables", Description: "The variables of the operation as a JSON object"},
+			},
+			Response: graphqlResult{},
+		}},
+
+		//Comments routes
+		{"GET", "/posts/{id}/comments", middlewares.SetMiddlewareJSON(s.GetPostComments), openapi.Endpoint{
+			Summary: "List the comment threads of a post", Tags: []string{"comments"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Comment{},
+		}},
+		{"POST", "/posts/{id}/comments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateComment)), openapi.Endpoint{
+			Summary: "Comment on a post, held for moderation for new accounts", Tags: []string{"comments"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: commentForm{}, Status: http.StatusCreated, Response: models.Comment{},
+		}},
+		{"GET", "/comments/pending", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPendingComments)), openapi.Endpoint{
+			Summary: "Moderation queue", Tags: []string{"comments"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Comment{},
+		}},
+		{"PUT", "/comments/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateComment)), openapi.Endpoint{
+			Summary: "Edit your comment", Tags: []string{"comments"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Form: commentEditForm{}, Response: models.Comment{},
+		}},
+		{"DELETE", "/comments/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteComment), openapi.Endpoint{
+			Summary: "Delete a comment as its author, the post author or a moderator", Tags: []string{"comments"}, Auth: true, Status: http.StatusNoContent,
+		}},
+		{"POST", "/comments/{id}/approve", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ApproveComment)), openapi.Endpoint{
+			Summary: "Publish a pending comment", Tags: []string{"comments"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Comment{},
+		}},
+		{"POST", "/comments/{id}/reject", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RejectComment)), openapi.Endpoint{
+			Summary: "Reject a pending comment", Tags: []string{"comments"}, Auth: true, Query: []openapi.QueryParam{fieldsParam},
+			Response: models.Comment{},
+		}},
+
+		//Tags routes
+		{"GET", "/tags", middlewares.SetMiddlewareJSON(s.GetTags), openapi.Endpoint{
+			Summary: "List tags with their post counts", Tags: []string{"tags"}, Query: []openapi.QueryParam{fieldsParam},
+			Response: []models.Tag{},
+		}},
+		{"GET", "/tags/{slug}/posts", middlewares.SetMiddlewareJSON(s.GetTagPosts), openapi.Endpoint{
+			Summary: "List the posts with a tag", Tags: []string{"tags"}, Query: []openapi.QueryParam{includeParam, fieldsParam},
+			Response: []models.Post{},
+		}},
+	}
+}
+
+// docRoutes serve the API description itself and are not versioned
+func (s *Server) docRoutes() []route {
+	return []route{
+		{"GET", "/openapi.json", middlewares.SetMiddlewareJSON(s.OpenAPI), openapi.Endpoint{
+			Summary: "This OpenAPI document", Tags: []string{"docs"}, Response: map[string]interface{}{},
+		}},
+		{"GET", "/docs", s.Docs, openapi.Endpoint{
+			Summary: "Swagger UI for this API", Tags: []string{"docs"}, Response: "", ContentType: "text/html",
+		}},
+		{"GET", "/docs/{file}", s.DocsAsset, openapi.Endpoint{
+			Summary: "A stylesheet or script of the Swagger UI", Tags: []string{"docs"},
+		}},
+	}
+}
+
+// v1Overrides replaces the shared handler of a route in /api/v1 only. Keys
+// are "METHOD /path" as written in routes.
+func (s *Server) v1Overrides() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{}
+}
+
+// handleRoutes registers routes on router, preferring the handler in
+// overrides when there is one for the route
+func handleRoutes(router *mux.Router, routes []route, overrides map[string]http.HandlerFunc, wrap func(http.HandlerFunc) http.HandlerFunc) {
+	for _, rt := range routes {
+		handler := rt.Handler
+		if override, ok := overrides[rt.Method+" "+rt.Path]; ok {
+			handler = override
+		}
+		if wrap != nil {
+			handler = wrap(handler)
+		}
+		router.HandleFunc(rt.Path, handler).Methods(rt.Method)
+	}
+}
 
 func (s *Server) initializeRoutes() {
+	routes := s.routes()
+
+	v1 := s.Router.PathPrefix("/api/v1").Subrouter()
+	handleRoutes(v1, routes, s.v1Overrides(), nil)
+
+	// Legacy unversioned aliases of v1
+	handleRoutes(s.Router, routes, s.v1Overrides(), func(next http.HandlerFunc) http.HandlerFunc {
+		return middlewares.SetMiddlewareDeprecation(next, legacyDeprecatedAt, legacySunset, "/api/v1")
+	})
 
-	// Home Route
-	s.Router.HandleFunc("/", middlewares.SetMiddlewareJSON(s.Home)).Methods("GET")
-
-	// Login Route
-	s.Router.HandleFunc("/login", middlewares.SetMiddlewareJSON(s.Login)).Methods("POST")
-	s.Router.HandleFunc("/register", middlewares.SetMiddlewareJSON(s.Register)).Methods("POST")
-
-	//Users routes
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.CreateUser)).Methods("POST")
-	s.Router.HandleFunc("/users", middlewares.SetMiddlewareJSON(s.GetUsers)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(s.GetUserById)).Methods("GET")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateUser))).Methods("PUT")
-	s.Router.HandleFunc("/users/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteUser)).Methods("DELETE")
-
-	//Category routes
-	s.Router.HandleFunc("/category", middlewares.SetMiddlewareJSON(s.CreateCategory)).Methods("POST")
-	s.Router.HandleFunc("/category", middlewares.SetMiddlewareJSON(s.GetCategories)).Methods("GET")
-	s.Router.HandleFunc("/category/{id}", middlewares.SetMiddlewareJSON(s.GetCategoryById)).Methods("GET")
-	s.Router.HandleFunc("/category/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateCategory))).Methods("PUT")
-	s.Router.HandleFunc("/category/{id}", middlewares.SetMiddlewareAuthentication(s.DeleteCategory)).Methods("DELETE")
-
-	//Posts routes
-	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.CreatePost)).Methods("POST")
-	s.Router.HandleFunc("/posts", middlewares.SetMiddlewareJSON(s.GetPosts)).Methods("GET")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareJSON(s.GetPostById)).Methods("GET")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePost))).Methods("PUT")
-	s.Router.HandleFunc("/posts/{id}", middlewares.SetMiddlewareAuthentication(s.DeletePost)).Methods("DELETE")
+	handleRoutes(s.Router, s.docRoutes(), nil, nil)
 }
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/search"
+	"github.com/rizalreza/golang-restful/api/utils/markdown"
+)
+
+const (
+	searchLimit    = 20
+	maxSearchLimit = 100
+	snippetWidth   = 160
+)
+
+func (server *Server) searchEngine() search.Engine {
+	server.searchOnce.Do(func() {
+		if server.Search == nil {
+			server.Search = search.ForDialect(server.DB.Dialect().GetName())
+		}
+	})
+	return server.Search
+}
+
+// queryUint parses an optional numeric query parameter
+func queryUint(r *http.Request, name string, bits int) (uint64, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseUint(value, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s", name)
+	}
+	return n, nil
+}
+
+// queryDate parses an optional date (2006-01-02) or time (RFC 3339) query
+// parameter. A date given as the end of a range includes the whole day.
+func queryDate(r *http.Request, name string, end bool) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s, expected a date like 2006-01-02", name)
+	}
+	if end {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+	return &t, nil
+}
+
+// SearchPosts finds the posts matching ?q= in their title or content, most
+// relevant first, with a highlighted snippet of each
+func (server *Server) SearchPosts(w http.ResponseWriter, r *http.Request) {
+	text := strings.TrimSpace(r.URL.Query().Get("q"))
+	if text == "" {
+		responses.ERROR(w, http.StatusBadRequest, errors.New("Required q"))
+		return
+	}
+
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	categoryID, err := queryUint(r, "category_id", 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	authorID, err := queryUint(r, "author_id", 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	from, err := queryDate(r, "from", false)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	to, err := queryDate(r, "to", true)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	limit, err := queryUint(r, "limit", 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+	if limit == 0 || limit > maxSearchLimit {
+		limit = searchLimit
+	}
+	offset, err := queryUint(r, "offset", 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	viewer := viewerID(r)
+	filter := func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(models.PostsVisibleTo(viewer))
+		if categoryID != 0 {
+			db = db.Where("posts.category_id = ?", categoryID)
+		}
+		if authorID != 0 {
+			db = db.Where("posts.author_id = ?", authorID)
+		}
+		if from != nil {
+			db = db.Where("posts.published_at >= ?", *from)
+		}
+		if to != nil {
+			db = db.Where("posts.published_at <= ?", *to)
+		}
+		return db
+	}
+
+	matches, err := server.searchEngine().Search(server.DB, text, filter, int(limit), int(offset))
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	ids := make([]uint64, len(matches))
+	for i, match := range matches {
+		ids[i] = match.PostID
+	}
+	post := models.Post{}
+	posts, err := post.FindPostsByIds(server.DB, ids, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	found := map[uint64]*models.Post{}
+	for i := range *posts {
+		found[(*posts)[i].ID] = &(*posts)[i]
+	}
+
+	results := []search.Result{}
+	for _, match := range matches {
+		p, ok := found[match.PostID]
+		if !ok {
+			continue
+		}
+		results = append(results, search.Result{
+			Post:    p,
+			Score:   match.Score,
+			Snippet: search.Snippet(markdown.PlainText(p.ContentHTML), text, snippetWidth),
+		})
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, results)
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rizalreza/golang-restful/api/models"
+)
+
+// redirectSlug answers a request for an old slug of the kind with a 301 to
+// the same URL using the current slug. It reports whether it did.
+func (server *Server) redirectSlug(w http.ResponseWriter, r *http.Request, kind string, old string) bool {
+	current, err := models.FindSlugRedirect(server.DB, kind, old)
+	if err != nil {
+		return false
+	}
+
+	target := *r.URL
+	target.Path = strings.TrimSuffix(r.URL.Path, old) + current
+	target.RawPath = ""
+	http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	return true
+}
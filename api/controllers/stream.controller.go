@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/sse"
+)
+
+const (
+	// streamReplay is how many events are kept for streams resuming with
+	// Last-Event-ID
+	streamReplay = 1000
+	// streamQueue is how many events a stream may fall behind before it is
+	// dropped
+	streamQueue = 64
+	// streamRetry is how long clients wait before reconnecting
+	streamRetry = 3 * time.Second
+)
+
+// streamBroker returns the broker of the event streams
+func (server *Server) streamBroker() *sse.Broker {
+	server.streamOnce.Do(func() {
+		if server.Stream == nil {
+			server.Stream = sse.NewBroker(streamReplay, streamQueue)
+		}
+	})
+	return server.Stream
+}
+
+// streamEvent sends the post and category events of the bus to the
+// streams. Only published posts are streamed; a post leaving public view is
+// streamed as deleted.
+func (server *Server) streamEvent(e events.Event) {
+	name := e.Type
+	var data interface{}
+	labels := map[string]string{}
+	switch e.Type {
+	case events.PostCreated, events.PostUpdated, events.PostDeleted:
+		post, ok := e.Data.(*models.Post)
+		if !ok {
+			return
+		}
+		labels["category"] = fmt.Sprint(post.CategoryID)
+		labels["author"] = fmt.Sprint(post.AuthorID)
+		data = post
+		if e.Type != events.PostDeleted && !post.IsVisibleTo(0) {
+			if e.Type == events.PostCreated {
+				return
+			}
+			name = events.PostDeleted
+		}
+		if name == events.PostDeleted {
+			data = map[string]uint64{"id": post.ID}
+		}
+	case events.CategoryCreated, events.CategoryUpdated, events.CategoryDeleted:
+		category, ok := e.Data.(*models.Category)
+		if !ok {
+			return
+		}
+		labels["category"] = fmt.Sprint(category.ID)
+		data = category
+		if e.Type == events.CategoryDeleted {
+			data = map[string]uint32{"id": category.ID}
+		}
+	default:
+		return
+	}
+
+	body, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Cannot stream %s event: %v", e.Type, err)
+		return
+	}
+	server.streamBroker().Publish(name, body, labels)
+}
+
+// GetEvents streams the changes to posts and categories as server-sent
+// events, optionally only those of a category or an author. A client
+// reconnecting with Last-Event-ID gets the events it missed first, or a
+// resync event when they are no longer kept. A client that can't keep up is
+// disconnected so it resumes from there.
+func (server *Server) GetEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		responses.ERROR(w, http.StatusInternalServerError, errors.New("Streaming unsupported"))
+		return
+	}
+	filter := sse.Filter{}
+	for _, name := range []string{"category", "author"} {
+		id, err := queryUint(r, name, 32)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, err)
+			return
+		}
+		if id > 0 {
+			filter[name] = strconv.FormatUint(id, 10)
+		}
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	var last uint64
+	if lastID != "" {
+		var err error
+		last, err = strconv.ParseUint(lastID, 10, 64)
+		if err != nil {
+			responses.ERROR(w, http.StatusBadRequest, errors.New("Invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	// The bus only feeds the streams once it is up
+	server.eventBus()
+	client, complete := server.streamBroker().Subscribe(filter, last)
+	defer server.streamBroker().Unsubscribe(client)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", streamRetry/time.Millisecond)
+	if !complete {
+		fmt.Fprintf(w, "event: resync\ndata: {}\n\n")
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sse.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case m, ok := <-client.C:
+			if !ok {
+				return
+			}
+			if sse.WriteMessage(w, m) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if sse.WriteComment(w, "heartbeat") != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
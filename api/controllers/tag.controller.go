@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+func (server *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+	tag := models.Tag{}
+
+	tags, err := tag.GetAllTags(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, tags)
+}
+
+func (server *Server) GetTagPosts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tag := models.Tag{}
+	_, err = tag.FindTagBySlug(server.DB, vars["slug"])
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Tag not found"))
+		return
+	}
+
+	post := models.Post{}
+	db := server.DB.Scopes(models.PostsVisibleTo(viewerID(r)), models.PostsTagged([]string{tag.Slug}, false))
+	posts, err := post.GetAllPost(db, includes...)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, posts)
+}
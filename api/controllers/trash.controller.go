@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/auth"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+)
+
+// GetTrash lists the deleted posts of the current user, or every deleted
+// user, post and category for admins
+func (server *Server) GetTrash(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	trash, err := models.GetTrash(server.DB, user)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, trash)
+}
+
+// RestoreUser brings back a deleted account. Its owner may still hold a
+// valid token, so they can undo the deletion themselves.
+func (server *Server) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	uid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if tokenID != uint32(uid) {
+		admin := server.currentUser(r)
+		if admin == nil || !admin.IsAdmin() {
+			responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+	}
+
+	user := models.User{}
+	userRestored, err := user.RestoreUser(server.DB, uint32(uid))
+	if err != nil {
+		restoreError(w, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, userRestored.View(server.currentUser(r)))
+}
+
+// RestorePost brings back a deleted post, for its author or an admin
+func (server *Server) RestorePost(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	pid, err := strconv.ParseUint(vars["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	includes, err := postIncludes(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	post := models.Post{}
+	err = server.DB.Debug().Unscoped().Model(models.Post{}).Where("id = ?", pid).Take(&post).Error
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Post not found"))
+		return
+	}
+	if post.AuthorID != user.ID && !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	postRestored, err := post.RestorePost(server.DB, pid, includes...)
+	if err != nil {
+		restoreError(w, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, postRestored)
+}
+
+// RestoreCategory brings back a deleted category and its posts, for admins
+func (server *Server) RestoreCategory(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	cid, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	user := server.currentUser(r)
+	if user == nil || !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	category := models.Category{}
+	categoryRestored, err := category.RestoreCategory(server.DB, uint32(cid))
+	if err != nil {
+		restoreError(w, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, categoryRestored)
+}
+
+func restoreError(w http.ResponseWriter, err error) {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		responses.ERROR(w, http.StatusNotFound, errors.New("Not found in the trash"))
+	case err == models.ErrParentTrashed:
+		responses.ERROR(w, http.StatusConflict, err)
+	default:
+		responses.ERROR(w, http.StatusInternalServerError, err)
+	}
+}
@@ -7,34 +7,58 @@ import (
 	"strconv"
 
 	"github.com/gorilla/mux"
-	"github.com/rizalreza/golang-restful/api/auth"
+	"github.com/rizalreza/golang-restful/api/events"
 	"github.com/rizalreza/golang-restful/api/models"
 	"github.com/rizalreza/golang-restful/api/responses"
 	"github.com/rizalreza/golang-restful/api/utils/formaterror"
 )
 
-func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+// userInput is an account as sent to create or update it
+type userInput struct {
+	Username string
+	Email    string
+	Password string
+}
+
+// formUser reads an account from the form of r
+func formUser(r *http.Request) userInput {
+	return userInput{
+		Username: r.FormValue("username"),
+		Email:    r.FormValue("email"),
+		Password: r.FormValue("password"),
+	}
+}
+
+// createUser signs a new user up
+func (server *Server) createUser(in userInput) (*models.User, error) {
 	user := models.User{}
 
-	user.Username = r.FormValue("username")
-	user.Email = r.FormValue("email")
-	user.Password = r.FormValue("password")
+	user.Username = in.Username
+	user.Email = in.Email
+	user.Password = in.Password
 
 	user.Prepare()
 	err := user.Validate("")
 	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
 	}
 
 	userCreated, err := user.SaveUser(server.DB)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
+		return nil, formaterror.FormatError(err.Error())
+	}
+	server.eventBus().Publish(events.Event{Type: events.UserCreated, ActorID: userCreated.ID, UserID: userCreated.ID, Data: userCreated.SelfView()})
+	return userCreated, nil
+}
+
+func (server *Server) CreateUser(w http.ResponseWriter, r *http.Request) {
+	userCreated, err := server.createUser(formUser(r))
+	if err != nil {
+		writeError(w, err)
 		return
 	}
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, userCreated.ID))
-	responses.JSON(w, http.StatusCreated, userCreated)
+	responses.SPARSE_JSON(w, r, http.StatusCreated, userCreated.SelfView())
 }
 
 func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
@@ -44,7 +68,7 @@ func (server *Server) GetUsers(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusInternalServerError, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, users)
+	responses.SPARSE_JSON(w, r, http.StatusOK, models.UsersView(*users, server.currentUser(r)))
 }
 
 func (server *Server) GetUserById(w http.ResponseWriter, r *http.Request) {
@@ -61,7 +85,31 @@ func (server *Server) GetUserById(w http.ResponseWriter, r *http.Request) {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	responses.JSON(w, http.StatusOK, userGotten)
+	responses.SPARSE_JSON(w, r, http.StatusOK, userGotten.View(server.currentUser(r)))
+}
+
+// updateUser changes the account uid of user tokenID, which must be theirs
+func (server *Server) updateUser(tokenID uint32, uid uint32, in userInput) (*models.User, error) {
+	if tokenID == 0 || tokenID != uid {
+		return nil, withStatus(http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+	}
+
+	user := models.User{}
+	user.Username = in.Username
+	user.Email = in.Email
+	user.Password = in.Password
+
+	user.Prepare()
+	err := user.Validate("update")
+	if err != nil {
+		return nil, withStatus(http.StatusUnprocessableEntity, err)
+	}
+	updatedUser, err := user.UpdateUser(server.DB, uid)
+	if err != nil {
+		return nil, formaterror.FormatError(err.Error())
+	}
+	server.eventBus().Publish(events.Event{Type: events.UserUpdated, ActorID: tokenID, UserID: updatedUser.ID, Data: updatedUser.SelfView()})
+	return updatedUser, nil
 }
 
 func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
@@ -72,59 +120,40 @@ func (server *Server) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user := models.User{}
-
-	tokenID, err := auth.ExtractTokenID(r)
+	updatedUser, err := server.updateUser(viewerID(r), uint32(uid), formUser(r))
 	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-	if tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
+		writeError(w, err)
 		return
 	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, updatedUser.SelfView())
+}
 
-	// Initial data from request form-data
-	user.Username = r.FormValue("username")
-	user.Email = r.FormValue("email")
-	user.Password = r.FormValue("password")
-
-	user.Prepare()
-	err = user.Validate("update")
-	if err != nil {
-		responses.ERROR(w, http.StatusUnprocessableEntity, err)
-		return
+// deleteUser moves the account uid of user tokenID, which must be theirs,
+// to the trash
+func (server *Server) deleteUser(tokenID uint32, uid uint32) error {
+	if tokenID == 0 || tokenID != uid {
+		return withStatus(http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 	}
-	updatedUser, err := user.UpdateUser(server.DB, uint32(uid))
+	user := models.User{}
+	_, err := user.DeleteUser(server.DB, uid)
 	if err != nil {
-		formattedError := formaterror.FormatError(err.Error())
-		responses.ERROR(w, http.StatusInternalServerError, formattedError)
-		return
+		return err
 	}
-	responses.JSON(w, http.StatusOK, updatedUser)
+	server.eventBus().Publish(events.Event{Type: events.UserDeleted, ActorID: tokenID, UserID: uid})
+	return nil
 }
 
 func (server *Server) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	user := models.User{}
 
 	uid, err := strconv.ParseUint(vars["id"], 10, 32)
 	if err != nil {
 		responses.ERROR(w, http.StatusBadRequest, err)
 		return
 	}
-	tokenID, err := auth.ExtractTokenID(r)
-	if err != nil {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-	if tokenID != 0 && tokenID != uint32(uid) {
-		responses.ERROR(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
-		return
-	}
-	_, err = user.DeleteUser(server.DB, uint32(uid))
+	err = server.deleteUser(viewerID(r), uint32(uid))
 	if err != nil {
-		responses.ERROR(w, http.StatusInternalServerError, err)
+		writeError(w, err)
 		return
 	}
 	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/responses"
+	"github.com/rizalreza/golang-restful/api/webhooks"
+)
+
+// deliveryBatch is how many deliveries a worker claims at once
+const deliveryBatch = 50
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (server *Server) webhookClient() *http.Client {
+	if server.WebhookClient != nil {
+		return server.WebhookClient
+	}
+	return defaultWebhookClient
+}
+
+// enqueueWebhooks queues e for the webhooks subscribed to its type. The
+// worker sends it from there, so a slow receiver never holds up a request.
+func (server *Server) enqueueWebhooks(e events.Event) {
+	body, err := json.Marshal(e)
+	if err == nil {
+		err = models.EnqueueDeliveries(server.DB, e.Type, body)
+	}
+	if err != nil {
+		log.Printf("Cannot queue webhooks of %s event: %v", e.Type, err)
+	}
+}
+
+// DeliverWebhooks sends the deliveries that are due, until none are left
+// or ctx is done. Failed deliveries are rescheduled with a backoff.
+func (server *Server) DeliverWebhooks(ctx context.Context) error {
+	for ctx.Err() == nil {
+		deliveries, err := models.ClaimDeliveries(server.DB, time.Now(), deliveryBatch)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		hooks := map[uint64]*models.Webhook{}
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			hook, ok := hooks[delivery.WebhookID]
+			if !ok {
+				hook = &models.Webhook{}
+				_, err = hook.FindWebhookById(server.DB, delivery.WebhookID)
+				if gorm.IsRecordNotFoundError(err) {
+					// Deleted while the delivery was in flight
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				hooks[delivery.WebhookID] = hook
+			}
+
+			code, sendErr := webhooks.Send(ctx, server.webhookClient(), hook.URL, hook.Secret,
+				delivery.Event, strconv.FormatUint(delivery.ID, 10), []byte(delivery.Body))
+			err = delivery.RecordAttempt(server.DB, code, sendErr, time.Now())
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// webhook returns the webhook named by vars["id"] when the current user is
+// an admin. It writes the error otherwise.
+func (server *Server) webhook(w http.ResponseWriter, r *http.Request) (*models.Webhook, bool) {
+	wid, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+	user := server.currentUser(r)
+	if user == nil || !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return nil, false
+	}
+	hook := models.Webhook{}
+	_, err = hook.FindWebhookById(server.DB, wid)
+	if err != nil {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Webhook not found"))
+		return nil, false
+	}
+	return &hook, true
+}
+
+func (server *Server) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil || !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	hooks, err := models.GetWebhooks(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, hooks)
+}
+
+// CreateWebhook subscribes a URL to the given types of events. The signing
+// secret is generated unless given, and only shown in this response.
+func (server *Server) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	user := server.currentUser(r)
+	if user == nil || !user.IsAdmin() {
+		responses.ERROR(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	hook := models.Webhook{}
+	hook.URL = r.FormValue("url")
+	hook.SigningSecret = r.FormValue("secret")
+	hook.EventTypes = splitList(r.Form["events"])
+	hook.Prepare()
+	err := hook.Validate()
+	if err != nil {
+		responses.ERROR(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	hookCreated, err := hook.SaveWebhook(server.DB)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.URL.Path, hookCreated.ID))
+	responses.SPARSE_JSON(w, r, http.StatusCreated, hookCreated)
+}
+
+func (server *Server) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := server.webhook(w, r)
+	if !ok {
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusOK, hook)
+}
+
+func (server *Server) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := server.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := hook.DeleteWebhook(server.DB, hook.ID)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.JSON(w, http.StatusNoContent, "")
+}
+
+// GetWebhookDeliveries is the delivery log of a webhook, newest first
+func (server *Server) GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := server.webhook(w, r)
+	if !ok {
+		return
+	}
+	cursor, limit, err := pageParams(r)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	deliveries, next, err := models.GetDeliveries(server.DB, hook.ID, cursor, limit)
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	meta, links := pageLinks(r, limit, next)
+	responses.ENVELOPE_JSON(w, r, http.StatusOK, deliveries, meta, links)
+}
+
+// RedeliverWebhook queues a delivery again, as a new delivery sent as soon
+// as the worker gets to it
+func (server *Server) RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := server.webhook(w, r)
+	if !ok {
+		return
+	}
+	did, err := strconv.ParseUint(mux.Vars(r)["deliveryId"], 10, 64)
+	if err != nil {
+		responses.ERROR(w, http.StatusBadRequest, err)
+		return
+	}
+
+	delivery, err := models.Redeliver(server.DB, hook.ID, did)
+	if gorm.IsRecordNotFoundError(err) {
+		responses.ERROR(w, http.StatusNotFound, errors.New("Delivery not found"))
+		return
+	}
+	if err != nil {
+		responses.ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	responses.SPARSE_JSON(w, r, http.StatusAccepted, delivery)
+}
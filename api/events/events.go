@@ -0,0 +1,115 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of events
+const (
+	PostCreated     = "post.created"
+	PostUpdated     = "post.updated"
+	PostDeleted     = "post.deleted"
+	CategoryCreated = "category.created"
+	CategoryUpdated = "category.updated"
+	CategoryDeleted = "category.deleted"
+	UserCreated     = "user.created"
+	UserUpdated     = "user.updated"
+	UserDeleted     = "user.deleted"
+	UserFollowed    = "user.followed"
+	CommentCreated  = "comment.created"
+	ReactionAdded   = "reaction.added"
+)
+
+// Types lists every type of event
+var Types = []string{
+	PostCreated, PostUpdated, PostDeleted,
+	CategoryCreated, CategoryUpdated, CategoryDeleted,
+	UserCreated, UserUpdated, UserDeleted, UserFollowed,
+	CommentCreated, ReactionAdded,
+}
+
+// ValidType tells whether name is one of Types
+func ValidType(name string) bool {
+	for _, t := range Types {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is something a user did. UserID is the user it happened to: the
+// user created, changed or followed, or the author of the post commented
+// on or reacted to. Data is the resource as it is after the event, or as it
+// was before it was deleted.
+type Event struct {
+	Type       string      `json:"type"`
+	ActorID    uint32      `json:"actor_id"`
+	UserID     uint32      `json:"user_id,omitempty"`
+	PostID     uint64      `json:"post_id,omitempty"`
+	CategoryID uint32      `json:"category_id,omitempty"`
+	CommentID  uint64      `json:"comment_id,omitempty"`
+	Reaction   string      `json:"reaction,omitempty"`
+	Data       interface{} `json:"data,omitempty"`
+	At         time.Time   `json:"at"`
+}
+
+// Handler is called with every event published. Handlers run in the
+// goroutine of the publisher, one after the other, so they should hand
+// anything slow off to another goroutine.
+type Handler func(e Event)
+
+// Bus delivers events within the process. The controllers publish what
+// happened once it is saved, and features such as notifications react to it
+// without those code paths knowing about them.
+type Bus struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: map[int]Handler{}}
+}
+
+// Subscribe calls handler with the events published from now on, until the
+// returned function is called
+func (b *Bus) Subscribe(handler Handler) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish hands e to every handler, dated now unless it has a date. A
+// handler that panics is logged and doesn't keep e from the others.
+func (b *Bus) Publish(e Event) {
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	b.mu.RLock()
+	handlers := make([]Handler, 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("Handler of %s event panicked: %v", e.Type, r)
+				}
+			}()
+			handler(e)
+		}()
+	}
+}
@@ -0,0 +1,159 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bounds the cost of a query, so it is turned down before it runs
+// rather than after it has loaded half the database
+type Limits struct {
+	// MaxDepth is how deep fields may be nested
+	MaxDepth int
+	// MaxComplexity is how many fields a query may resolve. The selections
+	// of a field taking a first argument count first times, as they are
+	// resolved for every item of the page.
+	MaxComplexity int
+	// DefaultFirst is the page size of fields given no first argument, and
+	// MaxFirst the largest they return
+	DefaultFirst int
+	MaxFirst     int
+}
+
+// Operation returns the operation of doc that runs for operationName, the
+// first one when it is empty, and nil when there is none
+func Operation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	for _, definition := range doc.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if operationName == "" || (operation.Name != nil && operation.Name.Value == operationName) {
+			return operation
+		}
+	}
+	return nil
+}
+
+// Check measures the operation of doc that would run, which should have
+// been validated so its fragments don't form cycles
+func (l Limits) Check(doc *ast.Document, operationName string, variables map[string]interface{}) error {
+	m := measure{limits: l, fragments: map[string]*ast.FragmentDefinition{}, variables: variables}
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			m.fragments[fragment.Name.Value] = fragment
+		}
+	}
+	operation := Operation(doc, operationName)
+	if operation == nil {
+		// Left to the executor to report
+		return nil
+	}
+
+	depth, complexity := m.selections(operation.SelectionSet, 0)
+	if depth > l.MaxDepth {
+		return fmt.Errorf("Query is nested %d levels deep, more than the %d allowed", depth, l.MaxDepth)
+	}
+	if complexity > l.MaxComplexity {
+		return fmt.Errorf("Query has a complexity over %d", l.MaxComplexity)
+	}
+	return nil
+}
+
+type measure struct {
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+}
+
+// selections returns the depth reached under set, which is at depth, and
+// its complexity. The complexity stops counting past the limit, so huge
+// pages nested deep don't overflow it.
+func (m *measure) selections(set *ast.SelectionSet, depth int) (int, int) {
+	reached, complexity := depth, 0
+	if set == nil {
+		return reached, complexity
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				// Introspection is cheap whatever its shape
+				continue
+			}
+			d, c = m.selections(selection.SelectionSet, depth+1)
+			c = 1 + m.first(selection)*c
+		case *ast.InlineFragment:
+			d, c = m.selections(selection.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			if fragment, ok := m.fragments[selection.Name.Value]; ok {
+				d, c = m.selections(fragment.SelectionSet, depth)
+			}
+		}
+		if d > reached {
+			reached = d
+		}
+		complexity += c
+		if complexity > m.limits.MaxComplexity {
+			complexity = m.limits.MaxComplexity + 1
+		}
+	}
+	return reached, complexity
+}
+
+// first returns how many times the selections of field are resolved: its
+// page size when it has a first argument, once otherwise
+func (m *measure) first(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		var value interface{}
+		switch v := argument.Value.(type) {
+		case *ast.IntValue:
+			value = v.Value
+		case *ast.Variable:
+			value = m.variables[v.Name.Value]
+		}
+		first, ok := PageSize(value, m.limits)
+		if !ok {
+			return m.limits.DefaultFirst
+		}
+		return first
+	}
+	return 1
+}
+
+// PageSize reads a first argument, as an int, a float from JSON variables
+// or a literal. It is DefaultFirst when not given, capped at MaxFirst, and
+// ok is false when it isn't a positive number.
+func PageSize(value interface{}, l Limits) (int, bool) {
+	var first int
+	switch v := value.(type) {
+	case nil:
+		return l.DefaultFirst, true
+	case int:
+		first = v
+	case float64:
+		first = int(v)
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, false
+		}
+		first = n
+	default:
+		return 0, false
+	}
+	if first <= 0 {
+		return 0, false
+	}
+	if first > l.MaxFirst {
+		first = l.MaxFirst
+	}
+	return first, true
+}
@@ -0,0 +1,74 @@
+package graph
+
+import (
+	"sync"
+)
+
+// BatchFunc fetches the values of keys at once. Keys it returns no value
+// for resolve to nil.
+type BatchFunc func(keys []interface{}) (map[interface{}]interface{}, error)
+
+// Loader batches the loads of a request: the keys asked for until one of
+// them is needed are fetched with a single call of its BatchFunc. The
+// executor resolves a whole level of a query before calling the thunks
+// returned by Load, so the authors of a page of posts cost one query rather
+// than one per post. Values are kept for the life of the loader, which
+// should be that of the request.
+type Loader struct {
+	batch BatchFunc
+
+	mu      sync.Mutex
+	pending []interface{}
+	queued  map[interface{}]bool
+	values  map[interface{}]interface{}
+	errs    map[interface{}]error
+}
+
+func NewLoader(batch BatchFunc) *Loader {
+	return &Loader{
+		batch:  batch,
+		queued: map[interface{}]bool{},
+		values: map[interface{}]interface{}{},
+		errs:   map[interface{}]error{},
+	}
+}
+
+// Load queues key for the next batch and returns a thunk giving its value,
+// as resolvers may return
+func (l *Loader) Load(key interface{}) func() (interface{}, error) {
+	l.mu.Lock()
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (interface{}, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, done := l.values[key]; !done && l.errs[key] == nil {
+			l.dispatch()
+		}
+		if err := l.errs[key]; err != nil {
+			return nil, err
+		}
+		return l.values[key], nil
+	}
+}
+
+// dispatch fetches the pending keys. The caller holds l.mu.
+func (l *Loader) dispatch() {
+	keys := l.pending
+	l.pending = nil
+	if len(keys) == 0 {
+		return
+	}
+	values, err := l.batch(keys)
+	for _, key := range keys {
+		if err != nil {
+			l.errs[key] = err
+			continue
+		}
+		l.values[key] = values[key]
+	}
+}
@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every runs job every interval until ctx is done. Errors are logged and the
+// job is tried again on the next tick.
+func Every(ctx context.Context, interval time.Duration, name string, job func(ctx context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := job(ctx)
+				if err != nil {
+					log.Printf("Job %s failed: %v", name, err)
+				}
+			}
+		}
+	}()
+}
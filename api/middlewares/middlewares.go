@@ -2,7 +2,9 @@ package middlewares
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/rizalreza/golang-restful/api/auth"
 	"github.com/rizalreza/golang-restful/api/responses"
@@ -25,3 +27,14 @@ func SetMiddlewareAuthentication(next http.HandlerFunc) http.HandlerFunc {
 		next(w, r)
 	}
 }
+
+// SetMiddlewareDeprecation marks a route as deprecated since deprecatedAt and
+// due for removal at sunset, linking to the same path under successorPrefix
+func SetMiddlewareDeprecation(next http.HandlerFunc, deprecatedAt, sunset time.Time, successorPrefix string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecatedAt.Unix()))
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+		w.Header().Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", successorPrefix, r.URL.Path))
+		next(w, r)
+	}
+}
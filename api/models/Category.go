@@ -9,20 +9,52 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
+var (
+	ErrCategoryCycle    = errors.New("Category Cannot Be Nested Under Itself")
+	ErrCategoryNotFound = errors.New("Parent Category Not Found")
+)
+
 type Category struct {
 	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
-	Name      string    `grom:"size:100;no null;unique" json:"name"`
+	Name      string    `gorm:"size:100;not null;unique" json:"name"`
+	Slug      string    `gorm:"size:100;unique_index" json:"slug"`
+	ParentID  *uint32   `gorm:"index" json:"parent_id"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	// DeletedAt is set while the category is in the trash
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+
+	// Children is only filled in the category tree
+	Children []Category `gorm:"-" json:"children,omitempty"`
+	// Breadcrumbs are the ancestors of the category, root first
+	Breadcrumbs []Breadcrumb `gorm:"-" json:"breadcrumbs,omitempty"`
+}
+
+// Breadcrumb is an ancestor of a category
+type Breadcrumb struct {
+	ID   uint32 `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
 }
 
 func (c *Category) Prepare() {
 	c.ID = 0
 	c.Name = html.EscapeString(strings.TrimSpace(c.Name))
+	c.Slug = ""
 	c.CreatedAt = time.Now()
 	c.UpdatedAt = time.Now()
 }
 
+// BeforeCreate gives the category a unique slug made from its name
+func (c *Category) BeforeCreate(tx *gorm.DB) error {
+	if c.Slug != "" {
+		return nil
+	}
+	var err error
+	c.Slug, err = uniqueSlug(tx, SlugCategory, c.Name, 0)
+	return err
+}
+
 func (c *Category) Validate() error {
 	if c.Name == "" {
 		return errors.New("Required Name")
@@ -32,7 +64,13 @@ func (c *Category) Validate() error {
 
 func (c *Category) SaveCategory(db *gorm.DB) (*Category, error) {
 	var err error
-	err = db.Debug().Model(&Category{}).Create(&c).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := checkParent(tx, 0, c.ParentID)
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&Category{}).Create(&c).Error
+	})
 	if err != nil {
 		return &Category{}, err
 	}
@@ -66,10 +104,44 @@ func (c *Category) FindCategoryById(db *gorm.DB, cid uint32) (*Category, error)
 
 }
 
+func (c *Category) FindCategoryBySlug(db *gorm.DB, slug string) (*Category, error) {
+	var err error
+	err = db.Debug().Model(Category{}).Where("slug = ?", slug).Take(&c).Error
+	if err != nil {
+		return &Category{}, err
+	}
+	return c, nil
+}
+
+// UpdateCategory renames the category, giving it a new slug, and moves it
+// under c.ParentID, or to the root when that is nil
 func (c *Category) UpdateCategory(db *gorm.DB, cid uint32) (*Category, error) {
 	var err error
 
-	err = db.Debug().Model(&Category{}).Where("id = ?", cid).Updates(Category{Name: c.Name, UpdatedAt: time.Now()}).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		current := Category{}
+		err := tx.Debug().Model(&Category{}).Where("id = ?", cid).Take(&current).Error
+		if err != nil {
+			return err
+		}
+		err = checkParent(tx, cid, c.ParentID)
+		if err != nil {
+			return err
+		}
+		err = tx.Debug().Model(&Category{}).Where("id = ?", cid).Updates(map[string]interface{}{
+			"name":       c.Name,
+			"parent_id":  c.ParentID,
+			"updated_at": time.Now(),
+		}).Error
+		if err != nil {
+			return err
+		}
+		c.Slug = current.Slug
+		if current.Name != c.Name || current.Slug == "" {
+			c.Slug, err = renameSlug(tx, SlugCategory, uint64(cid), current.Slug, c.Name)
+		}
+		return err
+	})
 
 	if err != nil {
 		return &Category{}, err
@@ -78,10 +150,199 @@ func (c *Category) UpdateCategory(db *gorm.DB, cid uint32) (*Category, error) {
 	return c, nil
 }
 
+// DeleteCategory moves the category to the trash along with its posts
 func (c *Category) DeleteCategory(db *gorm.DB, cid uint32) (int64, error) {
-	db = db.Debug().Model(&Category{}).Where("id = ?", cid).Take(&Category{}).Delete(&Category{})
-	if db.Error != nil {
-		return 0, db.Error
+	return trash(db, &Category{}, cid, "category_id")
+}
+
+// RestoreCategory takes the category out of the trash, with the posts that
+// were trashed along with it
+func (c *Category) RestoreCategory(db *gorm.DB, cid uint32) (*Category, error) {
+	err := restore(db, &Category{}, cid, "category_id")
+	if err != nil {
+		return &Category{}, err
+	}
+	return c.FindCategoryById(db, cid)
+}
+
+// checkParent makes sure the parent exists and that putting category cid
+// under it doesn't make the category its own ancestor. Trashed categories
+// count, since restoring them could close the loop.
+func checkParent(db *gorm.DB, cid uint32, parentID *uint32) error {
+	if parentID == nil {
+		return nil
+	}
+	links, err := categoryLinks(db)
+	if err != nil {
+		return err
+	}
+	if link, ok := links[*parentID]; !ok || link.Trashed {
+		return ErrCategoryNotFound
+	}
+	seen := map[uint32]bool{}
+	for id := parentID; id != nil && !seen[*id]; id = links[*id].ParentID {
+		if *id == cid {
+			return ErrCategoryCycle
+		}
+		seen[*id] = true
+	}
+	return nil
+}
+
+type categoryLink struct {
+	ParentID *uint32
+	Trashed  bool
+}
+
+// categoryLinks maps the id of every category, trashed or not, to the id of
+// its parent
+func categoryLinks(db *gorm.DB) (map[uint32]categoryLink, error) {
+	rows := []struct {
+		ID        uint32
+		ParentID  *uint32
+		DeletedAt *time.Time
+	}{}
+	err := db.Debug().Unscoped().Model(&Category{}).Select("id, parent_id, deleted_at").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	links := map[uint32]categoryLink{}
+	for _, row := range rows {
+		links[row.ID] = categoryLink{ParentID: row.ParentID, Trashed: row.DeletedAt != nil}
+	}
+	return links, nil
+}
+
+// LoadBreadcrumbs fills the Breadcrumbs of the category
+func (c *Category) LoadBreadcrumbs(db *gorm.DB) error {
+	ancestors := []Breadcrumb{}
+	seen := map[uint32]bool{c.ID: true}
+	for id := c.ParentID; id != nil && !seen[*id]; {
+		seen[*id] = true
+		parent := Category{}
+		err := db.Debug().Model(&Category{}).Where("id = ?", *id).Take(&parent).Error
+		if gorm.IsRecordNotFoundError(err) {
+			// The parent is in the trash
+			break
+		}
+		if err != nil {
+			return err
+		}
+		ancestors = append(ancestors, Breadcrumb{ID: parent.ID, Name: parent.Name, Slug: parent.Slug})
+		id = parent.ParentID
+	}
+
+	c.Breadcrumbs = make([]Breadcrumb, 0, len(ancestors))
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		c.Breadcrumbs = append(c.Breadcrumbs, ancestors[i])
+	}
+	return nil
+}
+
+// GetCategoryTree returns the root categories with their children nested
+// in them, in name order. Categories whose parent is in the trash show up
+// as roots until it is restored.
+func (c *Category) GetCategoryTree(db *gorm.DB) (*[]Category, error) {
+	categories := []Category{}
+	err := db.Debug().Model(&Category{}).Order("name").Find(&categories).Error
+	if err != nil {
+		return &[]Category{}, err
+	}
+
+	children := map[uint32][]int{}
+	exists := map[uint32]bool{}
+	for _, category := range categories {
+		exists[category.ID] = true
+	}
+	roots := []int{}
+	for i, category := range categories {
+		if category.ParentID == nil || !exists[*category.ParentID] {
+			roots = append(roots, i)
+			continue
+		}
+		children[*category.ParentID] = append(children[*category.ParentID], i)
+	}
+
+	var build func(i int) Category
+	build = func(i int) Category {
+		category := categories[i]
+		for _, child := range children[category.ID] {
+			category.Children = append(category.Children, build(child))
+		}
+		return category
+	}
+	tree := make([]Category, 0, len(roots))
+	for _, i := range roots {
+		tree = append(tree, build(i))
+	}
+	return &tree, nil
+}
+
+// FindCategoriesByIds loads the categories with the given ids, in no
+// particular order
+func FindCategoriesByIds(db *gorm.DB, ids []uint32) ([]Category, error) {
+	categories := []Category{}
+	err := db.Debug().Model(&Category{}).Where("id IN (?)", ids).Find(&categories).Error
+	if err != nil {
+		return []Category{}, err
+	}
+	return categories, nil
+}
+
+// FindCategoryChildren loads the categories nested right under those with
+// the given ids, by name
+func FindCategoryChildren(db *gorm.DB, ids []uint32) ([]Category, error) {
+	categories := []Category{}
+	err := db.Debug().Model(&Category{}).Where("parent_id IN (?)", ids).Order("name").Find(&categories).Error
+	if err != nil {
+		return []Category{}, err
+	}
+	return categories, nil
+}
+
+// GetCategoryPage returns up to limit categories after cursor, oldest
+// first. The returned cursor is nil on the last page.
+func GetCategoryPage(db *gorm.DB, cursor *Cursor, limit int) ([]Category, *Cursor, error) {
+	query := db.Debug().Model(&Category{})
+	if cursor != nil {
+		query = query.Where("id > ?", cursor.ID)
+	}
+	categories := []Category{}
+	err := query.Order("id").Limit(limit + 1).Find(&categories).Error
+	if err != nil {
+		return []Category{}, nil, err
+	}
+	var next *Cursor
+	if len(categories) > limit {
+		categories = categories[:limit]
+		next = &Cursor{ID: uint64(categories[limit-1].ID)}
+	}
+	return categories, next, nil
+}
+
+// CategoryDescendants returns the ids of category cid and of every category
+// nested under it, stopping at the ones in the trash
+func CategoryDescendants(db *gorm.DB, cid uint32) ([]uint32, error) {
+	links, err := categoryLinks(db)
+	if err != nil {
+		return nil, err
+	}
+	children := map[uint32][]uint32{}
+	for id, link := range links {
+		if link.ParentID != nil && !link.Trashed {
+			children[*link.ParentID] = append(children[*link.ParentID], id)
+		}
+	}
+
+	ids := []uint32{cid}
+	seen := map[uint32]bool{cid: true}
+	for i := 0; i < len(ids); i++ {
+		for _, child := range children[ids[i]] {
+			if !seen[child] {
+				seen[child] = true
+				ids = append(ids, child)
+			}
+		}
 	}
-	return db.RowsAffected, nil
+	return ids, nil
 }
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+	CommentDeleted  = "deleted"
+)
+
+// NewAccountAge is how old an account must be before its comments are
+// published without waiting for a moderator
+var NewAccountAge = 24 * time.Hour
+
+const maxCommentLength = 5000
+
+type Comment struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PostID    uint64    `gorm:"not null;index" json:"post_id"`
+	AuthorID  uint32    `gorm:"not null;" json:"author_id"`
+	ParentID  *uint64   `gorm:"index" json:"parent_id"`
+	Body      string    `gorm:"type:text;not null;" json:"body"`
+	Status    string    `gorm:"size:20;not null;default:'approved'" json:"status"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Author    *Author   `gorm:"foreignkey:AuthorID;association_autoupdate:false;association_autocreate:false" json:"author,omitempty"`
+	Replies   []Comment `gorm:"-" json:"replies,omitempty"`
+}
+
+func (c *Comment) Prepare() {
+	c.ID = 0
+	c.Body = strings.TrimSpace(c.Body)
+	c.CreatedAt = time.Now()
+	c.UpdatedAt = time.Now()
+	c.Author = nil
+	c.Replies = nil
+}
+
+func (c *Comment) Validate() error {
+	if c.Body == "" {
+		return errors.New("Required Body")
+	}
+	if len(c.Body) > maxCommentLength {
+		return errors.New("Body Too Long")
+	}
+	if c.PostID < 1 {
+		return errors.New("Required Post")
+	}
+	if c.AuthorID < 1 {
+		return errors.New("Required Author")
+	}
+	return nil
+}
+
+// InitialCommentStatus holds comments from accounts younger than
+// NewAccountAge for moderation, unless the author is a moderator
+func InitialCommentStatus(author *User) string {
+	if !author.IsModerator() && time.Since(author.CreatedAt) < NewAccountAge {
+		return CommentPending
+	}
+	return CommentApproved
+}
+
+// EditedCommentStatus is the status of a comment with status once its author
+// edits it. Edits are held for moderation as new comments are, and an edit
+// does not publish a rejected comment but sends it back to the moderators.
+func EditedCommentStatus(author *User, status string) string {
+	if status == CommentRejected && !author.IsModerator() {
+		return CommentPending
+	}
+	return InitialCommentStatus(author)
+}
+
+func (c *Comment) SaveComment(db *gorm.DB) (*Comment, error) {
+	var err error
+	if c.ParentID != nil {
+		parent := Comment{}
+		err = db.Debug().Model(&Comment{}).Where("id = ? AND post_id = ? AND status = ?", *c.ParentID, c.PostID, CommentApproved).Take(&parent).Error
+		if err != nil {
+			return &Comment{}, errors.New("Parent comment not found")
+		}
+	}
+
+	err = db.Debug().Model(&Comment{}).Create(&c).Error
+	if err != nil {
+		return &Comment{}, err
+	}
+	err = db.Debug().Preload("Author").Model(&Comment{}).Where("id = ?", c.ID).Take(&c).Error
+	if err != nil {
+		return &Comment{}, err
+	}
+	return c, nil
+}
+
+func (c *Comment) FindCommentById(db *gorm.DB, cid uint64) (*Comment, error) {
+	var err error
+	err = db.Debug().Preload("Author").Model(&Comment{}).Where("id = ?", cid).Take(&c).Error
+	if err != nil {
+		return &Comment{}, err
+	}
+	return c, nil
+}
+
+// GetPostComments returns the comment threads of a post. Everyone sees the
+// approved comments and the placeholders of deleted ones, and viewerID also
+// sees their own comments awaiting moderation. Placeholders don't tell who
+// wrote the comment they replace.
+func (c *Comment) GetPostComments(db *gorm.DB, pid uint64, viewerID uint32) (*[]Comment, error) {
+	var err error
+	comments := []Comment{}
+	err = db.Debug().Preload("Author").Model(&Comment{}).
+		Where("post_id = ?", pid).
+		Where("status IN (?) OR (status = ? AND author_id = ?)", []string{CommentApproved, CommentDeleted}, CommentPending, viewerID).
+		Order("created_at, id").
+		Find(&comments).Error
+	if err != nil {
+		return &[]Comment{}, err
+	}
+	for i := range comments {
+		if comments[i].Status == CommentDeleted {
+			comments[i].AuthorID = 0
+			comments[i].Author = nil
+		}
+	}
+	threads := CommentThreads(comments)
+	return &threads, nil
+}
+
+// CommentThreads nests comments under their parents and returns the top
+// level ones. Replies whose parent is not in comments are dropped.
+func CommentThreads(comments []Comment) []Comment {
+	children := map[uint64][]Comment{}
+	roots := []Comment{}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+		} else {
+			children[*comment.ParentID] = append(children[*comment.ParentID], comment)
+		}
+	}
+
+	var attach func(list []Comment) []Comment
+	attach = func(list []Comment) []Comment {
+		for i := range list {
+			list[i].Replies = attach(children[list[i].ID])
+		}
+		return list
+	}
+	return attach(roots)
+}
+
+// UpdateComment saves the body of a comment with its status, which edits may
+// send back to moderation, see EditedCommentStatus
+func (c *Comment) UpdateComment(db *gorm.DB) (*Comment, error) {
+	var err error
+	err = db.Debug().Model(&Comment{}).Where("id = ?", c.ID).Updates(Comment{Body: c.Body, Status: c.Status, UpdatedAt: time.Now()}).Error
+	if err != nil {
+		return &Comment{}, err
+	}
+	return c.FindCommentById(db, c.ID)
+}
+
+// SetCommentStatus moves a comment through moderation
+func (c *Comment) SetCommentStatus(db *gorm.DB, cid uint64, status string) (*Comment, error) {
+	var err error
+	err = db.Debug().Model(&Comment{}).Where("id = ?", cid).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return &Comment{}, err
+	}
+	return c.FindCommentById(db, cid)
+}
+
+// DeleteComment removes a comment. A comment that has replies is blanked
+// and kept as a placeholder so its thread stays intact.
+func (c *Comment) DeleteComment(db *gorm.DB, cid uint64) (int64, error) {
+	var replies int
+	err := db.Debug().Model(&Comment{}).Where("parent_id = ?", cid).Count(&replies).Error
+	if err != nil {
+		return 0, err
+	}
+
+	if replies > 0 {
+		db = db.Debug().Model(&Comment{}).Where("id = ?", cid).Updates(map[string]interface{}{
+			"body":       "",
+			"status":     CommentDeleted,
+			"updated_at": time.Now(),
+		})
+	} else {
+		db = db.Debug().Model(&Comment{}).Where("id = ?", cid).Delete(&Comment{})
+	}
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// GetPendingComments is the moderation queue, oldest first
+func (c *Comment) GetPendingComments(db *gorm.DB) (*[]Comment, error) {
+	var err error
+	comments := []Comment{}
+	err = db.Debug().Preload("Author").Model(&Comment{}).Where("status = ?", CommentPending).Order("created_at, id").Limit(100).Find(&comments).Error
+	if err != nil {
+		return &[]Comment{}, err
+	}
+	return &comments, nil
+}
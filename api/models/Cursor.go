@@ -0,0 +1,45 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("Invalid Cursor")
+
+// Cursor marks where a page of a list ended, so the next page starts right
+// after it even when rows are added meanwhile. Lists ordered by ID alone
+// leave At zero.
+type Cursor struct {
+	At time.Time
+	ID uint64
+}
+
+// String encodes the cursor for clients, who should treat it as opaque
+func (c Cursor) String() string {
+	var at int64
+	if !c.At.IsZero() {
+		at = c.At.UnixNano()
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d.%d", at, c.ID)))
+}
+
+// ParseCursor decodes a cursor made by String
+func ParseCursor(value string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var at int64
+	c := Cursor{}
+	_, err = fmt.Sscanf(string(raw), "%d.%d", &at, &c.ID)
+	if err != nil || c.ID == 0 {
+		return nil, ErrInvalidCursor
+	}
+	if at != 0 {
+		c.At = time.Unix(0, at)
+	}
+	return &c, nil
+}
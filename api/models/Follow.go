@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var ErrFollowSelf = errors.New("You Cannot Follow Yourself")
+
+// Follow is a user following the posts of an author
+type Follow struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	FollowerID uint32    `gorm:"not null;unique_index:idx_follow" json:"follower_id"`
+	FolloweeID uint32    `gorm:"not null;unique_index:idx_follow;index" json:"followee_id"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// CategoryFollow is a user following the posts of a category
+type CategoryFollow struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32    `gorm:"not null;unique_index:idx_category_follow" json:"user_id"`
+	CategoryID uint32    `gorm:"not null;unique_index:idx_category_follow;index" json:"category_id"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// FollowUser makes user follower follow user followee, and tells whether
+// the follow is new. Following twice changes nothing.
+func FollowUser(db *gorm.DB, follower uint32, followee uint32) (bool, error) {
+	if follower == followee {
+		return false, ErrFollowSelf
+	}
+	err := db.Debug().Model(&User{}).Where("id = ?", followee).Take(&User{}).Error
+	if err != nil {
+		return false, err
+	}
+	return follow(db, &Follow{FollowerID: follower, FolloweeID: followee, CreatedAt: time.Now()},
+		"follower_id = ? AND followee_id = ?", follower, followee)
+}
+
+func UnfollowUser(db *gorm.DB, follower uint32, followee uint32) error {
+	return db.Debug().Where("follower_id = ? AND followee_id = ?", follower, followee).Delete(&Follow{}).Error
+}
+
+// FollowCategory makes user uid follow category cid, and tells whether the
+// follow is new. Following twice changes nothing.
+func FollowCategory(db *gorm.DB, uid uint32, cid uint32) (bool, error) {
+	err := db.Debug().Model(&Category{}).Where("id = ?", cid).Take(&Category{}).Error
+	if err != nil {
+		return false, err
+	}
+	return follow(db, &CategoryFollow{UserID: uid, CategoryID: cid, CreatedAt: time.Now()},
+		"user_id = ? AND category_id = ?", uid, cid)
+}
+
+func UnfollowCategory(db *gorm.DB, uid uint32, cid uint32) error {
+	return db.Debug().Where("user_id = ? AND category_id = ?", uid, cid).Delete(&CategoryFollow{}).Error
+}
+
+// follow creates row unless a row matching query already exists, and tells
+// whether it did
+func follow(db *gorm.DB, row interface{}, query string, args ...interface{}) (bool, error) {
+	count := 0
+	err := db.Debug().Model(row).Where(query, args...).Count(&count).Error
+	if err != nil || count > 0 {
+		return false, err
+	}
+	err = db.Debug().Create(row).Error
+	if err != nil {
+		// A concurrent follow may have won the race on the unique index
+		db.Debug().Model(row).Where(query, args...).Count(&count)
+		if count > 0 {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+type followRow struct {
+	ID  uint64
+	Ref uint32
+}
+
+// followPage runs query, which selects the id of follows and the id they
+// refer to as ref, for up to limit follows after cursor, newest first. It
+// returns the referred ids and the cursor of the next page, nil on the last.
+func followPage(query *gorm.DB, cursor *Cursor, limit int) ([]uint32, *Cursor, error) {
+	if cursor != nil {
+		query = query.Where("f.id < ?", cursor.ID)
+	}
+	rows := []followRow{}
+	err := query.Order("f.id DESC").Limit(limit + 1).Scan(&rows).Error
+	if err != nil {
+		return []uint32{}, nil, err
+	}
+	var next *Cursor
+	if len(rows) > limit {
+		rows = rows[:limit]
+		next = &Cursor{ID: rows[limit-1].ID}
+	}
+	ids := make([]uint32, len(rows))
+	for i, row := range rows {
+		ids[i] = row.Ref
+	}
+	return ids, next, nil
+}
+
+// GetFollowers lists the users following user uid, latest follow first.
+// Users in the trash are left out.
+func GetFollowers(db *gorm.DB, uid uint32, cursor *Cursor, limit int) ([]User, *Cursor, error) {
+	ids, next, err := followPage(db.Debug().Table("follows f").Select("f.id, f.follower_id AS ref").
+		Joins("JOIN users u ON u.id = f.follower_id AND u.deleted_at IS NULL").
+		Where("f.followee_id = ?", uid), cursor, limit)
+	if err != nil {
+		return []User{}, nil, err
+	}
+	users, err := usersByIds(db, ids)
+	return users, next, err
+}
+
+// GetFollowing lists the users user uid follows, latest follow first.
+// Users in the trash are left out.
+func GetFollowing(db *gorm.DB, uid uint32, cursor *Cursor, limit int) ([]User, *Cursor, error) {
+	ids, next, err := followPage(db.Debug().Table("follows f").Select("f.id, f.followee_id AS ref").
+		Joins("JOIN users u ON u.id = f.followee_id AND u.deleted_at IS NULL").
+		Where("f.follower_id = ?", uid), cursor, limit)
+	if err != nil {
+		return []User{}, nil, err
+	}
+	users, err := usersByIds(db, ids)
+	return users, next, err
+}
+
+// GetFollowedCategories lists the categories user uid follows, latest
+// follow first. Categories in the trash are left out.
+func GetFollowedCategories(db *gorm.DB, uid uint32, cursor *Cursor, limit int) ([]Category, *Cursor, error) {
+	ids, next, err := followPage(db.Debug().Table("category_follows f").Select("f.id, f.category_id AS ref").
+		Joins("JOIN categories c ON c.id = f.category_id AND c.deleted_at IS NULL").
+		Where("f.user_id = ?", uid), cursor, limit)
+	if err != nil {
+		return []Category{}, nil, err
+	}
+	categories := []Category{}
+	err = db.Debug().Model(&Category{}).Where("id IN (?)", ids).Find(&categories).Error
+	if err != nil {
+		return []Category{}, nil, err
+	}
+	byID := map[uint32]Category{}
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	ordered := make([]Category, 0, len(ids))
+	for _, id := range ids {
+		if category, ok := byID[id]; ok {
+			ordered = append(ordered, category)
+		}
+	}
+	return ordered, next, nil
+}
+
+// usersByIds loads the users with the given ids, in the order of ids
+func usersByIds(db *gorm.DB, ids []uint32) ([]User, error) {
+	users := []User{}
+	err := db.Debug().Model(&User{}).Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return []User{}, err
+	}
+	byID := map[uint32]User{}
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	ordered := make([]User, 0, len(ids))
+	for _, id := range ids {
+		if user, ok := byID[id]; ok {
+			ordered = append(ordered, user)
+		}
+	}
+	return ordered, nil
+}
+
+// GetFeed returns up to limit published posts by the authors or in the
+// categories user uid follows, newest first, starting after cursor. The
+// follows are read in subqueries rather than spelled out in the query, so
+// following thousands of authors costs about the same as following a few.
+// The returned cursor is nil on the last page.
+func GetFeed(db *gorm.DB, uid uint32, cursor *Cursor, limit int, includes ...string) ([]Post, *Cursor, error) {
+	authors := db.New().Model(&Follow{}).Select("followee_id").Where("follower_id = ?", uid).SubQuery()
+	categories := db.New().Model(&CategoryFollow{}).Select("category_id").Where("user_id = ?", uid).SubQuery()
+
+	query := preloadPost(db.Debug(), includes).Model(&Post{}).
+		Where("posts.status = ? AND posts.published_at IS NOT NULL", PostPublished).
+		Where("posts.author_id IN ? OR posts.category_id IN ?", authors, categories)
+	if cursor != nil {
+		// Ties on the date are broken by id, so no post is skipped or repeated
+		query = query.Where("posts.published_at < ? OR (posts.published_at = ? AND posts.id < ?)", cursor.At, cursor.At, cursor.ID)
+	}
+	posts := []Post{}
+	err := query.Order("posts.published_at DESC").Order("posts.id DESC").Limit(limit + 1).Find(&posts).Error
+	if err != nil {
+		return []Post{}, nil, err
+	}
+	var next *Cursor
+	if len(posts) > limit {
+		posts = posts[:limit]
+		last := posts[limit-1]
+		next = &Cursor{At: *last.PublishedAt, ID: last.ID}
+	}
+	return posts, next, nil
+}
+
+// purgeFollows deletes the follows from and of the users in the users
+// subquery, and those of the categories in the categories subquery
+func purgeFollows(db *gorm.DB, users interface{}, categories interface{}) error {
+	err := db.Debug().Where("follower_id IN ? OR followee_id IN ?", users, users).Delete(&Follow{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Where("user_id IN ? OR category_id IN ?", users, categories).Delete(&CategoryFollow{}).Error
+}
@@ -0,0 +1,240 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MaxMediaSize is the largest upload accepted, in bytes
+var MaxMediaSize int64 = 10 << 20
+
+// MediaTypes are the content types uploads may have, as sniffed by
+// http.DetectContentType
+var MediaTypes = map[string]bool{
+	"image/jpeg":                true,
+	"image/png":                 true,
+	"image/gif":                 true,
+	"image/webp":                true,
+	"application/pdf":           true,
+	"text/plain; charset=utf-8": true,
+}
+
+var ErrMediaNotOwned = errors.New("Media Belongs To Another User")
+
+// Media is an uploaded file. Its content is a blob stored under BlobKey,
+// shared by every upload of the same bytes. Images have their dimensions
+// and, when they are larger than a thumbnail, a scaled down copy under
+// ThumbnailKey.
+type Media struct {
+	ID           uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	OwnerID      uint32    `gorm:"not null;index" json:"owner_id"`
+	BlobKey      string    `gorm:"size:64;not null;index" json:"sha256"`
+	Filename     string    `gorm:"size:255;not null" json:"filename"`
+	ContentType  string    `gorm:"size:100;not null" json:"content_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	Width        int       `json:"width,omitempty"`
+	Height       int       `json:"height,omitempty"`
+	ThumbnailKey string    `gorm:"size:64;index" json:"-"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+
+	URL          string `gorm:"-" json:"url"`
+	ThumbnailURL string `gorm:"-" json:"thumbnail_url,omitempty"`
+}
+
+// TableName keeps gorm from pluralizing media into medias
+func (Media) TableName() string {
+	return "media"
+}
+
+func (m *Media) Prepare() {
+	m.ID = 0
+	// Keep the name of the file, not the path of the client's copy
+	name := filepath.Base(strings.ReplaceAll(m.Filename, "\\", "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	m.Filename = name
+	m.CreatedAt = time.Now()
+}
+
+// AfterFind fills the URLs the media is served at
+func (m *Media) AfterFind() error {
+	m.URL = fmt.Sprintf("/api/v1/media/%d", m.ID)
+	m.ThumbnailURL = ""
+	if m.Width > 0 {
+		m.ThumbnailURL = m.URL + "/thumbnail"
+	}
+	return nil
+}
+
+func (m *Media) SaveMedia(db *gorm.DB) (*Media, error) {
+	var err error
+	err = db.Debug().Model(&Media{}).Create(&m).Error
+	if err != nil {
+		return &Media{}, err
+	}
+	return m, m.AfterFind()
+}
+
+func (m *Media) FindMediaById(db *gorm.DB, mid uint64) (*Media, error) {
+	var err error
+	err = db.Debug().Model(&Media{}).Where("id = ?", mid).Take(&m).Error
+	if err != nil {
+		return &Media{}, err
+	}
+	return m, nil
+}
+
+// DeleteMedia deletes the media and detaches it from its posts. It returns
+// the blob keys no other media uses any more, for the caller to delete.
+func (m *Media) DeleteMedia(db *gorm.DB, mid uint64) ([]string, error) {
+	unused := []string{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		media := Media{}
+		err := tx.Debug().Model(&Media{}).Where("id = ?", mid).Take(&media).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Debug().Exec("DELETE FROM post_media WHERE media_id = ?", mid).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Debug().Where("id = ?", mid).Delete(&Media{}).Error
+		if err != nil {
+			return err
+		}
+		unused, err = unusedBlobs(tx, media.BlobKey, media.ThumbnailKey)
+		return err
+	})
+	if err != nil {
+		return []string{}, err
+	}
+	return unused, nil
+}
+
+// PurgeUserMedia deletes the media of the users trashed before before,
+// ahead of PurgeTrash removing the users themselves. It returns the blob
+// keys no other media uses any more, for the caller to delete.
+func PurgeUserMedia(db *gorm.DB, before time.Time) ([]string, error) {
+	unused := []string{}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		users := tx.New().Unscoped().Model(&User{}).Select("id").Where("deleted_at < ?", before).SubQuery()
+		media := []Media{}
+		err := tx.Debug().Model(&Media{}).Where("owner_id IN ?", users).Find(&media).Error
+		if err != nil || len(media) == 0 {
+			return err
+		}
+
+		ids := []uint64{}
+		keys := []string{}
+		for _, m := range media {
+			ids = append(ids, m.ID)
+			keys = append(keys, m.BlobKey, m.ThumbnailKey)
+		}
+		err = tx.Debug().Exec("DELETE FROM post_media WHERE media_id IN (?)", ids).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Debug().Where("id IN (?)", ids).Delete(&Media{}).Error
+		if err != nil {
+			return err
+		}
+		unused, err = unusedBlobs(tx, keys...)
+		return err
+	})
+	if err != nil {
+		return []string{}, err
+	}
+	return unused, nil
+}
+
+// unusedBlobs returns the keys among keys that no media refers to
+func unusedBlobs(db *gorm.DB, keys ...string) ([]string, error) {
+	unused := []string{}
+	seen := map[string]bool{}
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		count := 0
+		err := db.Debug().Model(&Media{}).Where("blob_key = ? OR thumbnail_key = ?", key, key).Count(&count).Error
+		if err != nil {
+			return []string{}, err
+		}
+		if count == 0 {
+			unused = append(unused, key)
+		}
+	}
+	return unused, nil
+}
+
+// AttachMedia links media mid to post pid. Only the media of the author of
+// the post can be attached.
+func AttachMedia(db *gorm.DB, pid uint64, mid uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		post := Post{}
+		err := tx.Debug().Model(&Post{}).Where("id = ?", pid).Take(&post).Error
+		if err != nil {
+			return err
+		}
+		media := Media{}
+		err = tx.Debug().Model(&Media{}).Where("id = ?", mid).Take(&media).Error
+		if err != nil {
+			return err
+		}
+		if media.OwnerID != post.AuthorID {
+			return ErrMediaNotOwned
+		}
+		return tx.Debug().Model(&post).Association("Media").Append(&media).Error
+	})
+}
+
+// IsAttachedToPostVisibleTo tells whether the media is attached to at least
+// one post the user viewerID may read. Media attached to a published post
+// is so visible to everyone.
+func (m *Media) IsAttachedToPostVisibleTo(db *gorm.DB, viewerID uint32) (bool, error) {
+	var count int
+	err := db.Debug().Model(&Post{}).
+		Joins("JOIN post_media ON post_media.post_id = posts.id").
+		Where("post_media.media_id = ?", m.ID).
+		Scopes(PostsVisibleTo(viewerID)).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// DetachMedia unlinks media mid from post pid
+func DetachMedia(db *gorm.DB, pid uint64, mid uint64) error {
+	return db.Debug().Exec("DELETE FROM post_media WHERE post_id = ? AND media_id = ?", pid, mid).Error
+}
+
+// GetPostMedia lists the media attached to post pid, oldest first
+func GetPostMedia(db *gorm.DB, pid uint64) (*[]Media, error) {
+	media := []Media{}
+	err := db.Debug().Model(&Media{}).
+		Joins("JOIN post_media ON post_media.media_id = media.id").
+		Where("post_media.post_id = ?", pid).
+		Order("media.id").Find(&media).Error
+	if err != nil {
+		return &[]Media{}, err
+	}
+	return &media, nil
+}
@@ -0,0 +1,312 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
+)
+
+// Kinds of notifications
+const (
+	NotifyFollow   = "follow"
+	NotifyComment  = "comment"
+	NotifyReaction = "reaction"
+)
+
+// notificationKinds maps the events users are notified of to the kind of
+// notification they make
+var notificationKinds = map[string]string{
+	events.UserFollowed:   NotifyFollow,
+	events.CommentCreated: NotifyComment,
+	events.ReactionAdded:  NotifyReaction,
+}
+
+// notificationActors is how many of the actors of a notification are
+// listed with it
+const notificationActors = 3
+
+// Notification tells a user that others did something to them or their
+// post. Events of the same kind about the same post are grouped in one
+// notification while it is unread, counting each actor once.
+type Notification struct {
+	ID         uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	UserID     uint32     `gorm:"not null;index:idx_notification_user" json:"-"`
+	Kind       string     `gorm:"size:20;not null" json:"kind"`
+	PostID     uint64     `gorm:"not null;default:0;index" json:"post_id,omitempty"`
+	ActorCount int        `gorm:"not null;default:0" json:"actor_count"`
+	ReadAt     *time.Time `gorm:"index" json:"read_at"`
+	CreatedAt  time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	// UpdatedAt is when the last actor joined
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP;index:idx_notification_user" json:"updated_at"`
+
+	Actors  []PublicUser `gorm:"-" json:"actors"`
+	Message string       `gorm:"-" json:"message"`
+}
+
+// NotificationActor is a user counted in a notification
+type NotificationActor struct {
+	NotificationID uint64    `gorm:"primary_key;auto_increment:false"`
+	ActorID        uint32    `gorm:"primary_key;auto_increment:false;index"`
+	CreatedAt      time.Time `gorm:"default:CURRENT_TIMESTAMP"`
+}
+
+// NotificationPreferences are the kinds of notifications a user gets. Users
+// without a row get every kind.
+type NotificationPreferences struct {
+	UserID    uint32 `gorm:"primary_key;auto_increment:false" json:"-"`
+	Follows   bool   `gorm:"not null" json:"follows"`
+	Comments  bool   `gorm:"not null" json:"comments"`
+	Reactions bool   `gorm:"not null" json:"reactions"`
+}
+
+// Wants tells whether notifications of kind are enabled
+func (p *NotificationPreferences) Wants(kind string) bool {
+	switch kind {
+	case NotifyFollow:
+		return p.Follows
+	case NotifyComment:
+		return p.Comments
+	case NotifyReaction:
+		return p.Reactions
+	}
+	return false
+}
+
+func GetNotificationPreferences(db *gorm.DB, uid uint32) (*NotificationPreferences, error) {
+	preferences := NotificationPreferences{}
+	err := db.Debug().Model(&NotificationPreferences{}).Where("user_id = ?", uid).Take(&preferences).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &NotificationPreferences{UserID: uid, Follows: true, Comments: true, Reactions: true}, nil
+	}
+	if err != nil {
+		return &NotificationPreferences{}, err
+	}
+	return &preferences, nil
+}
+
+// SaveNotificationPreferences stores the preferences of p.UserID
+func (p *NotificationPreferences) SaveNotificationPreferences(db *gorm.DB) (*NotificationPreferences, error) {
+	err := db.Debug().Save(p).Error
+	if err != nil {
+		return &NotificationPreferences{}, err
+	}
+	return p, nil
+}
+
+// Notify records the notification event e makes, if any. Users aren't
+// notified of what they did themselves, nor of the kinds they turned off.
+func Notify(db *gorm.DB, e events.Event) error {
+	kind, ok := notificationKinds[e.Type]
+	if !ok || e.UserID == 0 || e.UserID == e.ActorID {
+		return nil
+	}
+	preferences, err := GetNotificationPreferences(db, e.UserID)
+	if err != nil || !preferences.Wants(kind) {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		notification := Notification{}
+		err := tx.Debug().Model(&Notification{}).
+			Where("user_id = ? AND kind = ? AND post_id = ? AND read_at IS NULL", e.UserID, kind, e.PostID).
+			Order("id DESC").Take(&notification).Error
+		if gorm.IsRecordNotFoundError(err) {
+			notification = Notification{UserID: e.UserID, Kind: kind, PostID: e.PostID, CreatedAt: e.At, UpdatedAt: e.At}
+			err = tx.Debug().Create(&notification).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// Someone reacting twice is still one person
+		count := 0
+		err = tx.Debug().Model(&NotificationActor{}).Where("notification_id = ? AND actor_id = ?", notification.ID, e.ActorID).Count(&count).Error
+		if err != nil || count > 0 {
+			return err
+		}
+		err = tx.Debug().Create(&NotificationActor{NotificationID: notification.ID, ActorID: e.ActorID, CreatedAt: e.At}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Model(&Notification{}).Where("id = ?", notification.ID).UpdateColumns(map[string]interface{}{
+			"actor_count": gorm.Expr("actor_count + 1"),
+			"updated_at":  e.At,
+		}).Error
+	})
+}
+
+// GetNotifications returns up to limit notifications of user uid after
+// cursor, latest activity first, with their actors and message. The
+// returned cursor is nil on the last page.
+func GetNotifications(db *gorm.DB, uid uint32, unreadOnly bool, cursor *Cursor, limit int) ([]Notification, *Cursor, error) {
+	query := db.Debug().Model(&Notification{}).Where("user_id = ?", uid)
+	if unreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if cursor != nil {
+		query = query.Where("updated_at < ? OR (updated_at = ? AND id < ?)", cursor.At, cursor.At, cursor.ID)
+	}
+	notifications := []Notification{}
+	err := query.Order("updated_at DESC").Order("id DESC").Limit(limit + 1).Find(&notifications).Error
+	if err != nil {
+		return []Notification{}, nil, err
+	}
+	var next *Cursor
+	if len(notifications) > limit {
+		notifications = notifications[:limit]
+		last := notifications[limit-1]
+		next = &Cursor{At: last.UpdatedAt, ID: last.ID}
+	}
+	return notifications, next, loadNotificationActors(db, notifications)
+}
+
+// loadNotificationActors fills the latest Actors of the notifications and
+// their Message. Actors in the trash are counted but not shown.
+func loadNotificationActors(db *gorm.DB, notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(notifications))
+	for i := range notifications {
+		ids[i] = notifications[i].ID
+	}
+	actors := []NotificationActor{}
+	err := db.Debug().Model(&NotificationActor{}).Where("notification_id IN (?)", ids).Order("created_at DESC").Find(&actors).Error
+	if err != nil {
+		return err
+	}
+	uids := []uint32{}
+	for _, actor := range actors {
+		uids = append(uids, actor.ActorID)
+	}
+	users := []User{}
+	if len(uids) > 0 {
+		err = db.Debug().Model(&User{}).Where("id IN (?)", uids).Find(&users).Error
+		if err != nil {
+			return err
+		}
+	}
+	byID := map[uint32]User{}
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	byNotification := map[uint64]*Notification{}
+	for i := range notifications {
+		notifications[i].Actors = []PublicUser{}
+		byNotification[notifications[i].ID] = &notifications[i]
+	}
+	for _, actor := range actors {
+		notification := byNotification[actor.NotificationID]
+		user, ok := byID[actor.ActorID]
+		if ok && len(notification.Actors) < notificationActors {
+			notification.Actors = append(notification.Actors, user.PublicView())
+		}
+	}
+	for i := range notifications {
+		notifications[i].Message = notifications[i].message()
+	}
+	return nil
+}
+
+// message describes the notification, e.g. "ana and 2 others reacted to
+// your post"
+func (n *Notification) message() string {
+	who := "Someone"
+	if len(n.Actors) > 0 {
+		who = n.Actors[0].Username
+	}
+	switch {
+	case n.ActorCount == 2 && len(n.Actors) > 1:
+		who = fmt.Sprintf("%s and %s", who, n.Actors[1].Username)
+	case n.ActorCount == 2:
+		who += " and 1 other"
+	case n.ActorCount > 2:
+		who = fmt.Sprintf("%s and %d others", who, n.ActorCount-1)
+	}
+	switch n.Kind {
+	case NotifyFollow:
+		return who + " started following you"
+	case NotifyComment:
+		return who + " commented on your post"
+	case NotifyReaction:
+		return who + " reacted to your post"
+	}
+	return who
+}
+
+// CountUnreadNotifications counts the unread notifications of user uid
+func CountUnreadNotifications(db *gorm.DB, uid uint32) (int, error) {
+	count := 0
+	err := db.Debug().Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", uid).Count(&count).Error
+	return count, err
+}
+
+// MarkNotificationsRead marks the notifications of user uid with the given
+// ids as read, or all of them when ids is empty
+func MarkNotificationsRead(db *gorm.DB, uid uint32, ids []uint64) error {
+	query := db.Debug().Model(&Notification{}).Where("user_id = ? AND read_at IS NULL", uid)
+	if len(ids) > 0 {
+		query = query.Where("id IN (?)", ids)
+	}
+	return query.UpdateColumn("read_at", time.Now()).Error
+}
+
+// purgeNotifications deletes the notifications of the users in the users
+// subquery, and counts them out of those of others. Notifications left
+// without actors go too.
+func purgeNotifications(db *gorm.DB, users interface{}) error {
+	rows, err := db.Debug().Model(&NotificationActor{}).Select("notification_id, COUNT(*)").
+		Where("actor_id IN ?", users).Group("notification_id").Rows()
+	if err != nil {
+		return err
+	}
+	counts := map[uint64]int{}
+	for rows.Next() {
+		var id uint64
+		var count int
+		err = rows.Scan(&id, &count)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		counts[id] = count
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	affected := []uint64{}
+	for id, count := range counts {
+		err = db.Debug().Model(&Notification{}).Where("id = ?", id).
+			UpdateColumn("actor_count", gorm.Expr("actor_count - ?", count)).Error
+		if err != nil {
+			return err
+		}
+		affected = append(affected, id)
+	}
+
+	notifications := db.New().Model(&Notification{}).Select("id").Where("user_id IN ?", users).SubQuery()
+	err = db.Debug().Where("notification_id IN ? OR actor_id IN ?", notifications, users).Delete(&NotificationActor{}).Error
+	if err != nil {
+		return err
+	}
+	err = db.Debug().Where("user_id IN ? OR (id IN (?) AND actor_count <= 0)", users, affected).Delete(&Notification{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Where("user_id IN ?", users).Delete(&NotificationPreferences{}).Error
+}
+
+// purgePostNotifications deletes the notifications about posts pids
+func purgePostNotifications(db *gorm.DB, pids []uint64) error {
+	notifications := db.New().Model(&Notification{}).Select("id").Where("post_id IN (?)", pids).SubQuery()
+	err := db.Debug().Where("notification_id IN ?", notifications).Delete(&NotificationActor{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Where("post_id IN (?)", pids).Delete(&Notification{}).Error
+}
@@ -7,28 +7,111 @@ import (
 	"time"
 
 	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/utils/markdown"
 )
 
+const (
+	PostDraft     = "draft"
+	PostScheduled = "scheduled"
+	PostPublished = "published"
+	PostArchived  = "archived"
+)
+
+const (
+	// maxContentLength fits the content in a MySQL TEXT column
+	maxContentLength = 65535
+	excerptLength    = 280
+)
+
+// Posts stored before statuses existed default to published so they stay public
 type Post struct {
-	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
-	Title      string    `gorm:"size:255;not null;unique" json:"title"`
-	Content    string    `gorm:"size:255;not null;" json:"content"`
-	AuthorID   uint32    `gorm:"not null;" json:"author_id"`
-	CategoryID uint32    `gorm:"not null;" json:"category_id"`
-	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
-	Author     User      `json:"author"`
-	Category   Category  `json:"category"`
+	ID          uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	Title       string     `gorm:"size:255;not null;unique" json:"title"`
+	Slug        string     `gorm:"size:100;unique_index" json:"slug"`
+	Content     string     `gorm:"type:text;not null;" json:"content"`
+	ContentHTML string     `gorm:"type:text" json:"content_html"`
+	Excerpt     string     `gorm:"size:300" json:"excerpt"`
+	AuthorID    uint32     `gorm:"not null;index" json:"author_id"`
+	CategoryID  uint32     `gorm:"not null;index" json:"category_id"`
+	Status      string     `gorm:"size:20;not null;default:'published';index" json:"status"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	DeletedAt   *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+	Author      *Author    `gorm:"foreignkey:AuthorID;association_autoupdate:false;association_autocreate:false" json:"author,omitempty"`
+	Category    *Category  `gorm:"foreignkey:CategoryID;association_autoupdate:false;association_autocreate:false" json:"category,omitempty"`
+	Tags        []Tag      `gorm:"many2many:post_tags;association_autoupdate:false;association_autocreate:false" json:"tags,omitempty"`
+	Media       []Media    `gorm:"many2many:post_media;association_autoupdate:false;association_autocreate:false" json:"media,omitempty"`
+
+	// ReactionCount is the number of reactions of every type. Reactions
+	// counts them by type and Reacted lists those of the client; both are
+	// only filled by LoadReactions.
+	ReactionCount int            `gorm:"not null;default:0;index" json:"reaction_count"`
+	Reactions     map[string]int `gorm:"-" json:"reactions,omitempty"`
+	Reacted       []string       `gorm:"-" json:"reacted,omitempty"`
+}
+
+// PostIncludes maps the names accepted by the include query parameter to
+// the post associations they eager load.
+var PostIncludes = map[string]string{
+	"author":   "Author",
+	"category": "Category",
+	"tags":     "Tags",
+	"media":    "Media",
+}
+
+// preloadPost adds a Preload for every requested association, so a list of
+// posts costs one query per association instead of one per post.
+func preloadPost(db *gorm.DB, includes []string) *gorm.DB {
+	for _, include := range includes {
+		db = db.Preload(include)
+	}
+	return db
 }
 
 func (p *Post) Prepare() {
 	p.ID = 0
 	p.Title = html.EscapeString(strings.TrimSpace(p.Title))
-	p.Content = html.EscapeString(strings.TrimSpace(p.Content))
+	p.Slug = ""
+	p.Content = strings.TrimSpace(p.Content)
 	p.CreatedAt = time.Now()
 	p.UpdatedAt = time.Now()
-	p.Author = User{}
-	p.Category = Category{}
+	p.Author = nil
+	p.Category = nil
+	p.Tags = nil
+	p.Media = nil
+	p.ReactionCount = 0
+	p.Reactions = nil
+	p.Reacted = nil
+}
+
+// BeforeCreate dates a post created published without a date, renders the
+// content and gives the post a unique slug made from its title
+func (p *Post) BeforeCreate(tx *gorm.DB) error {
+	if (p.Status == "" || p.Status == PostPublished) && p.PublishedAt == nil {
+		publishedAt := p.CreatedAt
+		if publishedAt.IsZero() {
+			publishedAt = time.Now()
+		}
+		p.PublishedAt = &publishedAt
+	}
+	err := p.Render()
+	if err != nil || p.Slug != "" {
+		return err
+	}
+	p.Slug, err = uniqueSlug(tx, SlugPost, p.Title, 0)
+	return err
+}
+
+// Render caches the sanitized HTML and the excerpt of the Markdown content
+func (p *Post) Render() error {
+	var err error
+	p.ContentHTML, err = markdown.Render(p.Content)
+	if err != nil {
+		return err
+	}
+	p.Excerpt = markdown.Excerpt(p.ContentHTML, excerptLength)
+	return nil
 }
 
 func (p *Post) Validate() error {
@@ -38,6 +121,9 @@ func (p *Post) Validate() error {
 	if p.Content == "" {
 		return errors.New("Required Content")
 	}
+	if len(p.Content) > maxContentLength {
+		return errors.New("Content Too Long")
+	}
 	if p.AuthorID < 1 {
 		return errors.New("Required Author")
 	}
@@ -47,18 +133,154 @@ func (p *Post) Validate() error {
 	return nil
 }
 
-func (p *Post) SavePost(db *gorm.DB) (*Post, error) {
+// SetStatus moves the post to status. Publishing with a future publishedAt
+// schedules the post instead, and publishing without one publishes it now.
+func (p *Post) SetStatus(status string, publishedAt *time.Time) error {
+	now := time.Now()
+	switch status {
+	case PostDraft, PostArchived:
+		p.Status = status
+		if status == PostDraft {
+			p.PublishedAt = nil
+		}
+	case PostPublished, PostScheduled:
+		if publishedAt != nil && publishedAt.After(now) {
+			p.Status = PostScheduled
+			p.PublishedAt = publishedAt
+			return nil
+		}
+		if status == PostScheduled {
+			return errors.New("Scheduled posts need a future published_at")
+		}
+		p.Status = PostPublished
+		p.PublishedAt = &now
+	default:
+		return errors.New("Invalid Status")
+	}
+	return nil
+}
+
+// IsVisibleTo tells whether the user viewerID may read the post. Posts that
+// are not published are only visible to their author.
+func (p *Post) IsVisibleTo(viewerID uint32) bool {
+	return p.Status == PostPublished || (viewerID != 0 && p.AuthorID == viewerID)
+}
+
+// PostsVisibleTo is a scope limiting a post query to what IsVisibleTo allows
+func PostsVisibleTo(viewerID uint32) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewerID == 0 {
+			return db.Where("posts.status = ?", PostPublished)
+		}
+		return db.Where("posts.status = ? OR posts.author_id = ?", PostPublished, viewerID)
+	}
+}
+
+// UpdatePostStatus saves the Status and PublishedAt of the post
+func (p *Post) UpdatePostStatus(db *gorm.DB, includes ...string) (*Post, error) {
 	var err error
-	err = db.Debug().Model(&Post{}).Create(&p).Error
+	err = db.Debug().Model(&Post{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"status":       p.Status,
+		"published_at": p.PublishedAt,
+		"updated_at":   time.Now(),
+	}).Error
 	if err != nil {
 		return &Post{}, err
 	}
-	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
+	return p.FindPostById(db, p.ID, includes...)
+}
+
+// MigratePostContent widens the content column of existing databases to
+// TEXT and renders the posts stored before Markdown support. Their content
+// was saved HTML-escaped, so it is unescaped first.
+func MigratePostContent(db *gorm.DB) error {
+	narrow := 0
+	err := db.Debug().Table("information_schema.columns").
+		Where("table_name = ? AND column_name = ? AND data_type IN (?)", "posts", "content", []string{"varchar", "character varying"}).
+		Count(&narrow).Error
+	if err != nil {
+		return err
+	}
+	if narrow > 0 {
+		err = db.Debug().Model(&Post{}).ModifyColumn("content", "text").Error
 		if err != nil {
-			return &Post{}, err
+			return err
+		}
+	}
+
+	posts := []Post{}
+	err = db.Debug().Unscoped().Model(&Post{}).Where("content_html IS NULL").Find(&posts).Error
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Content = html.UnescapeString(post.Content)
+		err = post.Render()
+		if err != nil {
+			return err
 		}
-		err = db.Debug().Model(&Category{}).Where("id = ?", p.CategoryID).Take(&p.Category).Error
+		err = db.Debug().Unscoped().Model(&Post{}).Where("id = ?", post.ID).UpdateColumns(map[string]interface{}{
+			"content":      post.Content,
+			"content_html": post.ContentHTML,
+			"excerpt":      post.Excerpt,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BackfillPublishedAt dates the published posts stored before statuses
+// existed by their creation, so they take their place in the feed
+func BackfillPublishedAt(db *gorm.DB) error {
+	return db.Debug().Unscoped().Model(&Post{}).
+		Where("status = ? AND published_at IS NULL", PostPublished).
+		UpdateColumn("published_at", gorm.Expr("created_at")).Error
+}
+
+// PublishDuePosts publishes the scheduled posts whose PublishedAt has come
+// and returns them. Each post is claimed with a conditional update, so when
+// several instances run this at once every post is published exactly once.
+func PublishDuePosts(db *gorm.DB, now time.Time) ([]Post, error) {
+	due := []Post{}
+	err := db.Debug().Model(&Post{}).Where("status = ? AND published_at <= ?", PostScheduled, now).Limit(100).Find(&due).Error
+	if err != nil {
+		return []Post{}, err
+	}
+
+	published := []Post{}
+	for _, post := range due {
+		claim := db.Debug().Model(&Post{}).Where("id = ? AND status = ?", post.ID, PostScheduled).Updates(map[string]interface{}{
+			"status":     PostPublished,
+			"updated_at": now,
+		})
+		if claim.Error != nil {
+			return published, claim.Error
+		}
+		if claim.RowsAffected == 1 {
+			post.Status = PostPublished
+			published = append(published, post)
+		}
+	}
+	return published, nil
+}
+
+// SavePost creates the post along with its first revision
+func (p *Post) SavePost(db *gorm.DB, includes ...string) (*Post, error) {
+	var err error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Model(&Post{}).Create(&p).Error
+		if err != nil {
+			return err
+		}
+		return recordRevision(tx, p, p.AuthorID, nil)
+	})
+	if err != nil {
+		return &Post{}, err
+	}
+	if p.ID != 0 && len(includes) > 0 {
+		err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("id = ?", p.ID).Take(&p).Error
 		if err != nil {
 			return &Post{}, err
 		}
@@ -66,80 +288,212 @@ func (p *Post) SavePost(db *gorm.DB) (*Post, error) {
 	return p, nil
 }
 
-func (p *Post) GetAllPost(db *gorm.DB) (*[]Post, error) {
+func (p *Post) GetAllPost(db *gorm.DB, includes ...string) (*[]Post, error) {
 	var err error
 	posts := []Post{}
-	err = db.Debug().Model(&Post{}).Limit(100).Find(&posts).Error
+	err = preloadPost(db.Debug(), includes).Model(&Post{}).Limit(100).Find(&posts).Error
 	if err != nil {
 		return &[]Post{}, err
 	}
-
-	if len(posts) > 0 {
-		for i, _ := range posts {
-			err := db.Debug().Model(&User{}).Where("id = ?", posts[i].AuthorID).Take(&posts[i].Author).Error
-			if err != nil {
-				return &[]Post{}, err
-			}
-
-			err = db.Debug().Model(&Category{}).Where("id = ?", posts[i].CategoryID).Take(&posts[i].Category).Error
-			if err != nil {
-				return &[]Post{}, err
-			}
-		}
-	}
 	return &posts, nil
 }
 
-// func (p *Post) FindPostById(db *gorm.DB, pid uint64, uid uint32) (*Post, error) {
-func (p *Post) FindPostById(db *gorm.DB, pid uint64) (*Post, error) {
+func (p *Post) FindPostById(db *gorm.DB, pid uint64, includes ...string) (*Post, error) {
 	var err error
-	err = db.Debug().Model(&Post{}).Where("id = ?", pid).Take(&p).Error
+	err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("id = ?", pid).Take(&p).Error
 	if err != nil {
 		return &Post{}, err
 	}
+	return p, nil
+}
+
+// FindPostsByIds loads the posts with the given ids, in no particular order
+func (p *Post) FindPostsByIds(db *gorm.DB, ids []uint64, includes ...string) (*[]Post, error) {
+	var err error
+	posts := []Post{}
+	err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("id IN (?)", ids).Find(&posts).Error
+	if err != nil {
+		return &[]Post{}, err
+	}
+	return &posts, nil
+}
 
-	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
-		if err != nil {
-			return &Post{}, err
-		}
-		err = db.Debug().Model(&Category{}).Where("id = ?", p.CategoryID).Take(&p.Category).Error
-		if err != nil {
-			return &Post{}, err
-		}
+// GetPostPage returns up to limit posts of query after cursor, newest
+// first. The returned cursor is nil on the last page.
+func GetPostPage(query *gorm.DB, cursor *Cursor, limit int) ([]Post, *Cursor, error) {
+	query = query.Debug().Model(&Post{})
+	if cursor != nil {
+		query = query.Where("posts.id < ?", cursor.ID)
 	}
+	posts := []Post{}
+	err := query.Order("posts.id DESC").Limit(limit + 1).Find(&posts).Error
+	if err != nil {
+		return []Post{}, nil, err
+	}
+	var next *Cursor
+	if len(posts) > limit {
+		posts = posts[:limit]
+		next = &Cursor{ID: posts[limit-1].ID}
+	}
+	return posts, next, nil
+}
 
+func (p *Post) FindPostBySlug(db *gorm.DB, slug string, includes ...string) (*Post, error) {
+	var err error
+	err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("slug = ?", slug).Take(&p).Error
+	if err != nil {
+		return &Post{}, err
+	}
 	return p, nil
 }
 
-func (p *Post) UpdatePost(db *gorm.DB) (*Post, error) {
+// UpdatePost saves the title, content and category of the post and records
+// them as a new revision edited by p.AuthorID. Its tags are replaced as well
+// unless p.Tags is nil.
+func (p *Post) UpdatePost(db *gorm.DB, includes ...string) (*Post, error) {
 
 	var err error
 
-	err = db.Debug().Model(&Post{}).Where("id = ?", p.ID).Updates(Post{Title: p.Title, Content: p.Content, CategoryID: p.CategoryID, UpdatedAt: time.Now()}).Error
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return p.update(tx, p.AuthorID, nil)
+	})
 	if err != nil {
 		return &Post{}, err
 	}
-	if p.ID != 0 {
-		err = db.Debug().Model(&User{}).Where("id = ?", p.AuthorID).Take(&p.Author).Error
+	if p.ID != 0 && len(includes) > 0 {
+		err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("id = ?", p.ID).Take(&p).Error
 		if err != nil {
 			return &Post{}, err
 		}
-		err = db.Debug().Model(&Category{}).Where("id = ?", p.CategoryID).Take(&p.Category).Error
+	}
+	return p, nil
+}
+
+// update saves the post and records the edit, to be run in a transaction.
+// A new title gives the post a new slug.
+func (p *Post) update(tx *gorm.DB, editorID uint32, restoredFrom *uint32) error {
+	err := ensureBaselineRevision(tx, p.ID)
+	if err != nil {
+		return err
+	}
+	current := Post{}
+	err = tx.Debug().Model(&Post{}).Where("id = ?", p.ID).Take(&current).Error
+	if err != nil {
+		return err
+	}
+	p.Slug = current.Slug
+	if current.Title != p.Title || current.Slug == "" {
+		p.Slug, err = renameSlug(tx, SlugPost, p.ID, current.Slug, p.Title)
 		if err != nil {
-			return &Post{}, err
+			return err
 		}
 	}
-	return p, nil
+	err = p.Render()
+	if err != nil {
+		return err
+	}
+	err = tx.Debug().Model(&Post{}).Where("id = ?", p.ID).Updates(map[string]interface{}{
+		"title":        p.Title,
+		"content":      p.Content,
+		"content_html": p.ContentHTML,
+		"excerpt":      p.Excerpt,
+		"category_id":  p.CategoryID,
+		"updated_at":   time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	if p.Tags != nil {
+		err = tx.Debug().Model(&Post{ID: p.ID}).Association("Tags").Replace(p.Tags).Error
+		if err != nil {
+			return err
+		}
+	}
+	return recordRevision(tx, p, editorID, restoredFrom)
 }
 
+// DeletePost moves the post to the trash. Its tags, comments and revisions
+// are kept until the post is purged.
 func (p *Post) DeletePost(db *gorm.DB, pid uint64, uid uint32) (int64, error) {
-	db = db.Debug().Model(&Post{}).Where("id = ? and author_id = ?", pid, uid).Take(&Post{}).Delete(&Post{})
-	if db.Error != nil {
-		if gorm.IsRecordNotFoundError(db.Error) {
+	deleted := db.Debug().Model(&Post{}).Where("id = ? and author_id = ?", pid, uid).Take(&Post{}).Delete(&Post{})
+	if deleted.Error != nil {
+		if gorm.IsRecordNotFoundError(deleted.Error) {
 			return 0, errors.New("Post not found")
 		}
-		return 0, db.Error
+		return 0, deleted.Error
+	}
+	return deleted.RowsAffected, nil
+}
+
+// RestorePost takes the post out of the trash. Its author and category must
+// not be in the trash themselves.
+func (p *Post) RestorePost(db *gorm.DB, pid uint64, includes ...string) (*Post, error) {
+	trashed := Post{}
+	err := db.Debug().Unscoped().Model(&Post{}).Where("id = ? AND deleted_at IS NOT NULL", pid).Take(&trashed).Error
+	if err != nil {
+		return &Post{}, err
+	}
+	err = db.Debug().Model(&User{}).Where("id = ?", trashed.AuthorID).Take(&User{}).Error
+	if err != nil {
+		return &Post{}, ErrParentTrashed
+	}
+	err = db.Debug().Model(&Category{}).Where("id = ?", trashed.CategoryID).Take(&Category{}).Error
+	if err != nil {
+		return &Post{}, ErrParentTrashed
+	}
+
+	err = db.Debug().Unscoped().Model(&Post{}).Where("id = ?", pid).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		return &Post{}, err
+	}
+	return p.FindPostById(db, pid, includes...)
+}
+
+// purgePosts hard-deletes the posts matching the conditions along with their
+// tags, comments and revisions
+func purgePosts(db *gorm.DB, query interface{}, args ...interface{}) (int64, error) {
+	ids := []uint64{}
+	err := db.Debug().Unscoped().Model(&Post{}).Where(query, args...).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	err = db.Debug().Exec("DELETE FROM post_tags WHERE post_id IN (?)", ids).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Exec("DELETE FROM post_media WHERE post_id IN (?)", ids).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("post_id IN (?)", ids).Delete(&ReadingListItem{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("post_id IN (?)", ids).Delete(&Reaction{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("post_id IN (?)", ids).Delete(&ReactionCount{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = purgePostNotifications(db, ids)
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("post_id IN (?)", ids).Delete(&Comment{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("post_id IN (?)", ids).Delete(&PostRevision{}).Error
+	if err != nil {
+		return 0, err
+	}
+	err = db.Debug().Where("kind = ? AND target_id IN (?)", SlugPost, ids).Delete(&SlugHistory{}).Error
+	if err != nil {
+		return 0, err
 	}
-	return db.RowsAffected, nil
+	purged := db.Debug().Unscoped().Where("id IN (?)", ids).Delete(&Post{})
+	return purged.RowsAffected, purged.Error
 }
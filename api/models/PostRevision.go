@@ -0,0 +1,160 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/utils/diff"
+)
+
+// PostRevision is an immutable snapshot of the title, content and category
+// of a post, taken when the post is created and every time it is edited or
+// restored. Revisions are numbered from 1 per post.
+type PostRevision struct {
+	ID           uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PostID       uint64    `gorm:"not null;unique_index:idx_post_revision" json:"post_id"`
+	Number       uint32    `gorm:"not null;unique_index:idx_post_revision" json:"number"`
+	EditorID     uint32    `gorm:"not null;" json:"editor_id"`
+	Title        string    `gorm:"size:255;not null;" json:"title"`
+	Content      string    `gorm:"type:text;not null;" json:"content"`
+	CategoryID   uint32    `gorm:"not null;" json:"category_id"`
+	ChangedList  string    `gorm:"column:changed;size:100" json:"-"`
+	Changed      []string  `gorm:"-" json:"changed"`
+	RestoredFrom *uint32   `json:"restored_from"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	Editor       *Author   `gorm:"foreignkey:EditorID;association_autoupdate:false;association_autocreate:false" json:"editor,omitempty"`
+}
+
+// RevisionDiff is the line-level difference between two revisions of a post
+type RevisionDiff struct {
+	PostID  uint64      `json:"post_id"`
+	From    uint32      `json:"from"`
+	To      uint32      `json:"to"`
+	Changed []string    `json:"changed"`
+	Title   []diff.Line `json:"title"`
+	Content []diff.Line `json:"content"`
+}
+
+func (r *PostRevision) AfterFind() error {
+	r.Changed = splitChanged(r.ChangedList)
+	return nil
+}
+
+func splitChanged(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+// changedFields lists the fields that differ between the revision and the post
+func (r *PostRevision) changedFields(p *Post) []string {
+	changed := []string{}
+	if r.Title != p.Title {
+		changed = append(changed, "title")
+	}
+	if r.Content != p.Content {
+		changed = append(changed, "content")
+	}
+	if r.CategoryID != p.CategoryID {
+		changed = append(changed, "category_id")
+	}
+	return changed
+}
+
+// recordRevision stores the current state of p as its next revision. Edits
+// that change none of the tracked fields are not recorded, except restores.
+func recordRevision(db *gorm.DB, p *Post, editorID uint32, restoredFrom *uint32) error {
+	last := PostRevision{}
+	err := db.Debug().Model(&PostRevision{}).Where("post_id = ?", p.ID).Order("number desc").Take(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	revision := PostRevision{
+		PostID:       p.ID,
+		Number:       1,
+		EditorID:     editorID,
+		Title:        p.Title,
+		Content:      p.Content,
+		CategoryID:   p.CategoryID,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    time.Now(),
+	}
+	changed := []string{"title", "content", "category_id"}
+	if last.ID != 0 {
+		revision.Number = last.Number + 1
+		changed = last.changedFields(p)
+		if len(changed) == 0 && restoredFrom == nil {
+			return nil
+		}
+	}
+	revision.ChangedList = strings.Join(changed, ",")
+	return db.Debug().Create(&revision).Error
+}
+
+// ensureBaselineRevision records the stored state of post pid as its first
+// revision when it has none yet, so posts written before revisions existed
+// don't lose their text on the first edit
+func ensureBaselineRevision(db *gorm.DB, pid uint64) error {
+	count := 0
+	err := db.Debug().Model(&PostRevision{}).Where("post_id = ?", pid).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	current := Post{}
+	err = db.Debug().Model(&Post{}).Where("id = ?", pid).Take(&current).Error
+	if err != nil {
+		return err
+	}
+	return recordRevision(db, &current, current.AuthorID, nil)
+}
+
+func (r *PostRevision) GetPostRevisions(db *gorm.DB, pid uint64) (*[]PostRevision, error) {
+	revisions := []PostRevision{}
+	err := db.Debug().Preload("Editor").Model(&PostRevision{}).Where("post_id = ?", pid).Order("number desc").Find(&revisions).Error
+	if err != nil {
+		return &[]PostRevision{}, err
+	}
+	return &revisions, nil
+}
+
+func (r *PostRevision) FindPostRevision(db *gorm.DB, pid uint64, number uint32) (*PostRevision, error) {
+	err := db.Debug().Preload("Editor").Model(&PostRevision{}).Where("post_id = ? AND number = ?", pid, number).Take(&r).Error
+	if err != nil {
+		return &PostRevision{}, err
+	}
+	return r, nil
+}
+
+// DiffPostRevisions compares the title and content of two revisions line by line
+func DiffPostRevisions(from, to *PostRevision) *RevisionDiff {
+	return &RevisionDiff{
+		PostID:  to.PostID,
+		From:    from.Number,
+		To:      to.Number,
+		Changed: from.changedFields(&Post{Title: to.Title, Content: to.Content, CategoryID: to.CategoryID}),
+		Title:   diff.Lines(from.Title, to.Title),
+		Content: diff.Lines(from.Content, to.Content),
+	}
+}
+
+// RestorePostRevision puts the title, content and category of a revision back
+// on its post. The restore is recorded as a new revision by editorID.
+func (r *PostRevision) RestorePostRevision(db *gorm.DB, editorID uint32, includes ...string) (*Post, error) {
+	p := &Post{
+		ID:         r.PostID,
+		Title:      r.Title,
+		Content:    r.Content,
+		CategoryID: r.CategoryID,
+	}
+	number := r.Number
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return p.update(tx, editorID, &number)
+	})
+	if err != nil {
+		return &Post{}, err
+	}
+	return p.FindPostById(db, p.ID, includes...)
+}
@@ -0,0 +1,229 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ReactionTypes are the reactions readers can leave on a post
+var ReactionTypes = []string{"like", "love", "laugh", "wow", "sad", "angry"}
+
+// reactionAttempts is how many times a reaction is tried when concurrent
+// reactions to the same post conflict
+const reactionAttempts = 5
+
+var ErrInvalidReaction = errors.New("Invalid Reaction Type")
+
+// Reaction is a reaction of a user to a post. A user reacts at most once
+// with each type.
+type Reaction struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	PostID    uint64    `gorm:"not null;unique_index:idx_reaction" json:"post_id"`
+	UserID    uint32    `gorm:"not null;unique_index:idx_reaction;index" json:"user_id"`
+	Type      string    `gorm:"size:20;not null;unique_index:idx_reaction" json:"type"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// ReactionCount is the number of reactions of a type to a post, kept up
+// to date with every reaction so reading them doesn't count rows
+type ReactionCount struct {
+	PostID uint64 `gorm:"primary_key;auto_increment:false" json:"post_id"`
+	Type   string `gorm:"primary_key;size:20" json:"type"`
+	Count  int    `gorm:"not null;default:0" json:"count"`
+}
+
+// ReactionSummary is where the reactions to a post stand for a user
+type ReactionSummary struct {
+	PostID  uint64         `json:"post_id"`
+	Total   int            `json:"reaction_count"`
+	Counts  map[string]int `json:"reactions"`
+	Reacted []string       `json:"reacted"`
+}
+
+func ValidReaction(reaction string) bool {
+	for _, t := range ReactionTypes {
+		if t == reaction {
+			return true
+		}
+	}
+	return false
+}
+
+// React adds the reaction of user uid to post pid, unless it is already
+// there, and tells whether it was added. The counters are updated in the
+// same transaction, and the whole is retried if a concurrent reaction got in
+// the way.
+func React(db *gorm.DB, pid uint64, uid uint32, reaction string) (bool, error) {
+	if !ValidReaction(reaction) {
+		return false, ErrInvalidReaction
+	}
+	var err error
+	for attempt := 0; attempt < reactionAttempts; attempt++ {
+		added := false
+		err = db.Transaction(func(tx *gorm.DB) error {
+			count := 0
+			err := tx.Debug().Model(&Reaction{}).Where("post_id = ? AND user_id = ? AND type = ?", pid, uid, reaction).Count(&count).Error
+			if err != nil || count > 0 {
+				return err
+			}
+			// The unique index turns away a concurrent copy of this reaction
+			err = tx.Debug().Create(&Reaction{PostID: pid, UserID: uid, Type: reaction, CreatedAt: time.Now()}).Error
+			if err != nil {
+				return err
+			}
+			added = true
+			return bumpReactions(tx, pid, reaction, 1)
+		})
+		if err == nil {
+			return added, nil
+		}
+	}
+	return false, err
+}
+
+// Unreact removes the reaction of user uid to post pid, if it is there
+func Unreact(db *gorm.DB, pid uint64, uid uint32, reaction string) error {
+	if !ValidReaction(reaction) {
+		return ErrInvalidReaction
+	}
+	var err error
+	for attempt := 0; attempt < reactionAttempts; attempt++ {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			deleted := tx.Debug().Where("post_id = ? AND user_id = ? AND type = ?", pid, uid, reaction).Delete(&Reaction{})
+			if deleted.Error != nil || deleted.RowsAffected == 0 {
+				return deleted.Error
+			}
+			return bumpReactions(tx, pid, reaction, -1)
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// bumpReactions adds delta to the counters of the post. The increments are
+// done by the database so concurrent ones add up.
+func bumpReactions(db *gorm.DB, pid uint64, reaction string, delta int) error {
+	updated := db.Debug().Model(&ReactionCount{}).Where("post_id = ? AND type = ?", pid, reaction).
+		UpdateColumn("count", gorm.Expr("count + ?", delta))
+	if updated.Error != nil {
+		return updated.Error
+	}
+	if updated.RowsAffected == 0 && delta > 0 {
+		err := db.Debug().Create(&ReactionCount{PostID: pid, Type: reaction, Count: delta}).Error
+		if err != nil {
+			return err
+		}
+	}
+	// UpdateColumn leaves updated_at alone: reacting doesn't edit the post
+	return db.Debug().Unscoped().Model(&Post{}).Where("id = ?", pid).
+		UpdateColumn("reaction_count", gorm.Expr("reaction_count + ?", delta)).Error
+}
+
+// LoadReactions fills the Reactions of the posts, and their Reacted with
+// the reactions of viewer, if any
+func LoadReactions(db *gorm.DB, posts []Post, viewer uint32) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(posts))
+	for i := range posts {
+		ids[i] = posts[i].ID
+	}
+
+	counts := []ReactionCount{}
+	err := db.Debug().Model(&ReactionCount{}).Where("post_id IN (?) AND count > 0", ids).Find(&counts).Error
+	if err != nil {
+		return err
+	}
+	reacted := []Reaction{}
+	if viewer != 0 {
+		err = db.Debug().Model(&Reaction{}).Where("post_id IN (?) AND user_id = ?", ids, viewer).Order("id").Find(&reacted).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	byPost := map[uint64]*Post{}
+	for i := range posts {
+		posts[i].Reactions = map[string]int{}
+		posts[i].Reacted = []string{}
+		byPost[posts[i].ID] = &posts[i]
+	}
+	for _, count := range counts {
+		byPost[count.PostID].Reactions[count.Type] = count.Count
+	}
+	for _, reaction := range reacted {
+		byPost[reaction.PostID].Reacted = append(byPost[reaction.PostID].Reacted, reaction.Type)
+	}
+	return nil
+}
+
+// GetReactionSummary returns the counters of post pid and the reactions of
+// viewer to it
+func GetReactionSummary(db *gorm.DB, pid uint64, viewer uint32) (*ReactionSummary, error) {
+	posts := []Post{}
+	err := db.Debug().Model(&Post{}).Where("id = ?", pid).Find(&posts).Error
+	if err != nil {
+		return &ReactionSummary{}, err
+	}
+	if len(posts) == 0 {
+		return &ReactionSummary{}, gorm.ErrRecordNotFound
+	}
+	err = LoadReactions(db, posts, viewer)
+	if err != nil {
+		return &ReactionSummary{}, err
+	}
+	return &ReactionSummary{
+		PostID:  pid,
+		Total:   posts[0].ReactionCount,
+		Counts:  posts[0].Reactions,
+		Reacted: posts[0].Reacted,
+	}, nil
+}
+
+// PostsByPopularity is a scope ordering a post query by reactions, most
+// first
+func PostsByPopularity(db *gorm.DB) *gorm.DB {
+	return db.Order("posts.reaction_count DESC").Order("posts.id DESC")
+}
+
+// purgeReactions deletes the reactions of the users in the users subquery,
+// taking them off the counters of the posts they were on
+func purgeReactions(db *gorm.DB, users interface{}) error {
+	rows, err := db.Debug().Model(&Reaction{}).Select("post_id, type, COUNT(*)").
+		Where("user_id IN ?", users).Group("post_id, type").Rows()
+	if err != nil {
+		return err
+	}
+	type tally struct {
+		postID   uint64
+		reaction string
+		count    int
+	}
+	tallies := []tally{}
+	for rows.Next() {
+		t := tally{}
+		err = rows.Scan(&t.postID, &t.reaction, &t.count)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		tallies = append(tallies, t)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tallies {
+		err = bumpReactions(db, t.postID, t.reaction, -t.count)
+		if err != nil {
+			return err
+		}
+	}
+	return db.Debug().Where("user_id IN ?", users).Delete(&Reaction{}).Error
+}
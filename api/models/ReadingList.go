@@ -0,0 +1,332 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// shareTokenBytes is the entropy of a share link, enough that it can't be
+// guessed
+const shareTokenBytes = 32
+
+// ReadingList is a named list of posts a user saved for later. A public
+// list can be read by anyone who has its share link.
+type ReadingList struct {
+	ID         uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	OwnerID    uint32    `gorm:"not null;unique_index:idx_reading_list_name" json:"owner_id"`
+	Name       string    `gorm:"size:100;not null;unique_index:idx_reading_list_name" json:"name"`
+	ShareToken *string   `gorm:"size:64;unique_index" json:"-"`
+	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	Public    bool              `gorm:"-" json:"public"`
+	ShareURL  string            `gorm:"-" json:"share_url,omitempty"`
+	PostCount int               `gorm:"-" json:"post_count"`
+	Items     []ReadingListItem `gorm:"-" json:"items,omitempty"`
+}
+
+// ReadingListItem is a post in a reading list. Items are ordered by
+// Position, from 1. Posts deleted or unpublished since they were saved are
+// kept but flagged as not Available, without their content.
+type ReadingListItem struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"-"`
+	ListID    uint64    `gorm:"not null;unique_index:idx_reading_list_post" json:"-"`
+	PostID    uint64    `gorm:"not null;unique_index:idx_reading_list_post;index" json:"post_id"`
+	Position  int       `gorm:"not null" json:"position"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"added_at"`
+
+	Available bool  `gorm:"-" json:"available"`
+	Post      *Post `gorm:"-" json:"post,omitempty"`
+}
+
+func (l *ReadingList) Prepare() {
+	l.ID = 0
+	l.Name = html.EscapeString(strings.TrimSpace(l.Name))
+	l.CreatedAt = time.Now()
+	l.UpdatedAt = time.Now()
+}
+
+func (l *ReadingList) Validate() error {
+	if l.Name == "" {
+		return errors.New("Required Name")
+	}
+	if len([]rune(l.Name)) > 100 {
+		return errors.New("Name Too Long")
+	}
+	return nil
+}
+
+// AfterFind fills Public and the ShareURL of public lists
+func (l *ReadingList) AfterFind() error {
+	l.Public = l.ShareToken != nil
+	l.ShareURL = ""
+	if l.Public {
+		l.ShareURL = "/api/v1/lists/shared/" + *l.ShareToken
+	}
+	return nil
+}
+
+// SetPublic makes the list public with a new share link, or private. A list
+// that is already public keeps its link.
+func (l *ReadingList) SetPublic(public bool) error {
+	if !public {
+		l.ShareToken = nil
+		return nil
+	}
+	if l.ShareToken != nil {
+		return nil
+	}
+	b := make([]byte, shareTokenBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	l.ShareToken = &token
+	return nil
+}
+
+func (l *ReadingList) SaveReadingList(db *gorm.DB) (*ReadingList, error) {
+	err := db.Debug().Model(&ReadingList{}).Create(&l).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l, l.AfterFind()
+}
+
+// UpdateReadingList saves the name and sharing of the list
+func (l *ReadingList) UpdateReadingList(db *gorm.DB) (*ReadingList, error) {
+	err := db.Debug().Model(&ReadingList{}).Where("id = ?", l.ID).Updates(map[string]interface{}{
+		"name":        l.Name,
+		"share_token": l.ShareToken,
+		"updated_at":  time.Now(),
+	}).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l.FindReadingListById(db, l.ID)
+}
+
+func (l *ReadingList) FindReadingListById(db *gorm.DB, lid uint64) (*ReadingList, error) {
+	err := db.Debug().Model(&ReadingList{}).Where("id = ?", lid).Take(&l).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l, nil
+}
+
+// FindReadingListByShareToken finds the public list shared with token. The
+// lists of users in the trash are not found.
+func (l *ReadingList) FindReadingListByShareToken(db *gorm.DB, token string) (*ReadingList, error) {
+	owners := db.New().Model(&User{}).Select("id").SubQuery()
+	err := db.Debug().Model(&ReadingList{}).Where("share_token = ? AND owner_id IN ?", token, owners).Take(&l).Error
+	if err != nil {
+		return &ReadingList{}, err
+	}
+	return l, nil
+}
+
+// GetReadingLists lists the reading lists of user uid by name, with the
+// number of posts in each
+func GetReadingLists(db *gorm.DB, uid uint32) (*[]ReadingList, error) {
+	lists := []ReadingList{}
+	err := db.Debug().Model(&ReadingList{}).Where("owner_id = ?", uid).Order("name").Find(&lists).Error
+	if err != nil {
+		return &[]ReadingList{}, err
+	}
+	if len(lists) == 0 {
+		return &lists, nil
+	}
+
+	ids := make([]uint64, len(lists))
+	for i := range lists {
+		ids[i] = lists[i].ID
+	}
+	rows, err := db.Debug().Model(&ReadingListItem{}).Select("list_id, COUNT(*)").
+		Where("list_id IN (?)", ids).Group("list_id").Rows()
+	if err != nil {
+		return &[]ReadingList{}, err
+	}
+	defer rows.Close()
+	counts := map[uint64]int{}
+	for rows.Next() {
+		var lid uint64
+		var count int
+		err = rows.Scan(&lid, &count)
+		if err != nil {
+			return &[]ReadingList{}, err
+		}
+		counts[lid] = count
+	}
+	for i := range lists {
+		lists[i].PostCount = counts[lists[i].ID]
+	}
+	return &lists, rows.Err()
+}
+
+// DeleteReadingList deletes the list and its items. The posts stay.
+func (l *ReadingList) DeleteReadingList(db *gorm.DB, lid uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Where("list_id = ?", lid).Delete(&ReadingListItem{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Where("id = ?", lid).Delete(&ReadingList{}).Error
+	})
+}
+
+// LoadItems fills the Items of the list in order, and its PostCount. Posts
+// viewer can no longer read are flagged as not Available, or left out when
+// hideUnavailable is set.
+func (l *ReadingList) LoadItems(db *gorm.DB, viewer uint32, hideUnavailable bool, includes ...string) error {
+	items := []ReadingListItem{}
+	err := db.Debug().Model(&ReadingListItem{}).Where("list_id = ?", l.ID).Order("position").Find(&items).Error
+	if err != nil {
+		return err
+	}
+	ids := make([]uint64, len(items))
+	for i := range items {
+		ids[i] = items[i].PostID
+	}
+	posts := []Post{}
+	if len(ids) > 0 {
+		err = preloadPost(db.Debug(), includes).Model(&Post{}).Where("id IN (?)", ids).Find(&posts).Error
+		if err != nil {
+			return err
+		}
+	}
+	byID := map[uint64]*Post{}
+	for i := range posts {
+		byID[posts[i].ID] = &posts[i]
+	}
+
+	l.Items = []ReadingListItem{}
+	for _, item := range items {
+		post, ok := byID[item.PostID]
+		item.Available = ok && post.IsVisibleTo(viewer)
+		if item.Available {
+			item.Post = post
+		} else if hideUnavailable {
+			continue
+		}
+		l.Items = append(l.Items, item)
+	}
+	l.PostCount = len(l.Items)
+	return nil
+}
+
+// SaveToReadingList puts post pid in list lid. The post goes at position,
+// counted from 1, moving the others down; a position of 0 appends a new
+// post and leaves one already in the list where it is.
+func SaveToReadingList(db *gorm.DB, lid uint64, pid uint64, position int) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := touchReadingList(tx, lid)
+		if err != nil {
+			return err
+		}
+		items := []ReadingListItem{}
+		err = tx.Debug().Model(&ReadingListItem{}).Where("list_id = ?", lid).Order("position").Find(&items).Error
+		if err != nil {
+			return err
+		}
+
+		var saved *ReadingListItem
+		for i := range items {
+			if items[i].PostID == pid {
+				item := items[i]
+				saved = &item
+				items = append(items[:i], items[i+1:]...)
+				break
+			}
+		}
+		if saved == nil {
+			saved = &ReadingListItem{ListID: lid, PostID: pid, CreatedAt: time.Now()}
+		} else if position == 0 {
+			return nil
+		}
+
+		if position < 1 || position > len(items)+1 {
+			position = len(items) + 1
+		}
+		ordered := append([]ReadingListItem{}, items[:position-1]...)
+		ordered = append(ordered, *saved)
+		ordered = append(ordered, items[position-1:]...)
+		return renumber(tx, ordered)
+	})
+}
+
+// RemoveFromReadingList takes post pid out of list lid, closing the gap
+// it leaves
+func RemoveFromReadingList(db *gorm.DB, lid uint64, pid uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := touchReadingList(tx, lid)
+		if err != nil {
+			return err
+		}
+		err = tx.Debug().Where("list_id = ? AND post_id = ?", lid, pid).Delete(&ReadingListItem{}).Error
+		if err != nil {
+			return err
+		}
+		items := []ReadingListItem{}
+		err = tx.Debug().Model(&ReadingListItem{}).Where("list_id = ?", lid).Order("position").Find(&items).Error
+		if err != nil {
+			return err
+		}
+		return renumber(tx, items)
+	})
+}
+
+// touchReadingList bumps the updated_at of list lid. Writing the row first
+// holds it until the transaction ends, so concurrent changes to the list
+// are applied one after the other.
+func touchReadingList(db *gorm.DB, lid uint64) error {
+	touched := db.Debug().Model(&ReadingList{}).Where("id = ?", lid).UpdateColumn("updated_at", time.Now())
+	if touched.Error != nil {
+		return touched.Error
+	}
+	if touched.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// renumber saves the items at positions 1, 2, ... in the given order,
+// creating the new ones and only updating those that moved
+func renumber(db *gorm.DB, items []ReadingListItem) error {
+	for i := range items {
+		position := i + 1
+		if items[i].ID == 0 {
+			items[i].Position = position
+			err := db.Debug().Create(&items[i]).Error
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if items[i].Position == position {
+			continue
+		}
+		err := db.Debug().Model(&ReadingListItem{}).Where("id = ?", items[i].ID).UpdateColumn("position", position).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeReadingLists deletes the reading lists of the users in the users
+// subquery
+func purgeReadingLists(db *gorm.DB, users interface{}) error {
+	lists := db.New().Model(&ReadingList{}).Select("id").Where("owner_id IN ?", users).SubQuery()
+	err := db.Debug().Where("list_id IN ?", lists).Delete(&ReadingListItem{}).Error
+	if err != nil {
+		return err
+	}
+	return db.Debug().Where("owner_id IN ?", users).Delete(&ReadingList{}).Error
+}
@@ -0,0 +1,28 @@
+package models
+
+// joinTables are the tables AutoMigrate creates for many to many
+// associations
+var joinTables = []interface{}{"post_tags", "post_media"}
+
+// All returns every model in the order they are migrated, each after the
+// models its foreign keys point to. New models are added here so the server,
+// the seeder and the tests all migrate them.
+func All() []interface{} {
+	return []interface{}{
+		&User{}, &Category{}, &Tag{}, &Post{}, &Comment{}, &PostRevision{}, &SlugHistory{}, &Media{},
+		&Reaction{}, &ReactionCount{}, &Follow{}, &CategoryFollow{}, &ReadingList{}, &ReadingListItem{},
+		&Notification{}, &NotificationActor{}, &NotificationPreferences{}, &Webhook{}, &WebhookDelivery{},
+	}
+}
+
+// AllTables returns the tables of every model and association in an order
+// they can be dropped in: join tables first, then the models in reverse
+// migration order
+func AllTables() []interface{} {
+	models := All()
+	tables := append([]interface{}{}, joinTables...)
+	for i := len(models) - 1; i >= 0; i-- {
+		tables = append(tables, models[i])
+	}
+	return tables
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/utils/slug"
+)
+
+const (
+	SlugPost     = "post"
+	SlugCategory = "category"
+)
+
+// maxSlugLength leaves room for a collision suffix within the slug columns
+const maxSlugLength = 90
+
+// SlugHistory remembers the slugs a post or category had before it was
+// renamed, so old URLs can redirect to the current one
+type SlugHistory struct {
+	ID        uint64    `gorm:"primary_key;auto_increment" json:"id"`
+	Kind      string    `gorm:"size:20;not null;unique_index:idx_slug_history" json:"kind"`
+	Slug      string    `gorm:"size:100;not null;unique_index:idx_slug_history" json:"slug"`
+	TargetID  uint64    `gorm:"not null;index" json:"target_id"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// slugModel returns the model whose slugs are of the given kind
+func slugModel(kind string) interface{} {
+	if kind == SlugCategory {
+		return &Category{}
+	}
+	return &Post{}
+}
+
+// reservedSlugs are path segments routed next to the slugs, as in
+// /category/tree
+var reservedSlugs = map[string]bool{"tree": true}
+
+// uniqueSlug makes a slug from text that no other row of the kind uses now
+// or used before, adding -2, -3... on collisions. Slugs never look like IDs
+// or reserved paths.
+func uniqueSlug(db *gorm.DB, kind string, text string, id uint64) (string, error) {
+	base := slug.Truncate(slug.Make(html.UnescapeString(text)), maxSlugLength)
+	if _, err := strconv.ParseUint(base, 10, 64); err == nil || reservedSlugs[base] {
+		base = kind + "-" + base
+	}
+	if base == "" {
+		base = kind
+	}
+
+	candidate := base
+	for n := 2; ; n++ {
+		taken := 0
+		err := db.Debug().Unscoped().Model(slugModel(kind)).Where("slug = ? AND id <> ?", candidate, id).Count(&taken).Error
+		if err != nil {
+			return "", err
+		}
+		if taken == 0 {
+			err = db.Debug().Model(&SlugHistory{}).Where("kind = ? AND slug = ? AND target_id <> ?", kind, candidate, id).Count(&taken).Error
+			if err != nil {
+				return "", err
+			}
+		}
+		if taken == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", base, n)
+	}
+}
+
+// renameSlug gives row id of the kind a slug made from text, keeping its
+// previous slug in the history. It returns the slug the row ends up with.
+func renameSlug(db *gorm.DB, kind string, id uint64, current string, text string) (string, error) {
+	next, err := uniqueSlug(db, kind, text, id)
+	if err != nil || next == current {
+		return current, err
+	}
+
+	if current != "" {
+		err = db.Debug().Create(&SlugHistory{Kind: kind, Slug: current, TargetID: id, CreatedAt: time.Now()}).Error
+		if err != nil {
+			return current, err
+		}
+	}
+	// Going back to an old name takes its slug back from the history
+	err = db.Debug().Where("kind = ? AND slug = ?", kind, next).Delete(&SlugHistory{}).Error
+	if err != nil {
+		return current, err
+	}
+	err = db.Debug().Unscoped().Model(slugModel(kind)).Where("id = ?", id).UpdateColumn("slug", next).Error
+	if err != nil {
+		return current, err
+	}
+	return next, nil
+}
+
+// FindSlugRedirect returns the current slug of the row of the kind that
+// used to be known as old
+func FindSlugRedirect(db *gorm.DB, kind string, old string) (string, error) {
+	history := SlugHistory{}
+	err := db.Debug().Model(&SlugHistory{}).Where("kind = ? AND slug = ?", kind, old).Take(&history).Error
+	if err != nil {
+		return "", err
+	}
+
+	var current string
+	err = db.Debug().Model(slugModel(kind)).Where("id = ?", history.TargetID).Select("slug").Row().Scan(&current)
+	if err != nil {
+		return "", gorm.ErrRecordNotFound
+	}
+	return current, nil
+}
+
+// BackfillSlugs gives a slug to the posts and categories stored before
+// slugs existed
+func BackfillSlugs(db *gorm.DB) error {
+	posts := []Post{}
+	err := db.Debug().Unscoped().Model(&Post{}).Where("slug IS NULL OR slug = ''").Find(&posts).Error
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		_, err = renameSlug(db, SlugPost, post.ID, "", post.Title)
+		if err != nil {
+			return err
+		}
+	}
+
+	categories := []Category{}
+	err = db.Debug().Unscoped().Model(&Category{}).Where("slug IS NULL OR slug = ''").Find(&categories).Error
+	if err != nil {
+		return err
+	}
+	for _, category := range categories {
+		_, err = renameSlug(db, SlugCategory, uint64(category.ID), "", category.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
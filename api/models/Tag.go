@@ -0,0 +1,118 @@
+package models
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/utils/slug"
+)
+
+type Tag struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Slug      string    `gorm:"size:100;not null;unique_index" json:"slug"`
+	PostCount uint32    `gorm:"-" json:"post_count,omitempty"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// NormalizeTagName trims a tag name, collapses inner whitespace and
+// lowercases it, so "  Go   Lang" and "go lang" are the same tag
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+func (t *Tag) Prepare() {
+	name := NormalizeTagName(t.Name)
+	t.ID = 0
+	t.Name = html.EscapeString(name)
+	t.Slug = slug.Make(name)
+	t.CreatedAt = time.Now()
+	t.UpdatedAt = time.Now()
+}
+
+func (t *Tag) Validate() error {
+	if t.Slug == "" {
+		return errors.New("Required Tag Name")
+	}
+	return nil
+}
+
+// FindOrCreateTags returns the tags with the given names, creating the ones
+// that do not exist yet. Names that slugify the same are only returned once.
+func FindOrCreateTags(db *gorm.DB, names []string) ([]Tag, error) {
+	tags := []Tag{}
+	seen := map[string]bool{}
+	for _, name := range names {
+		tag := Tag{Name: name}
+		tag.Prepare()
+		err := tag.Validate()
+		if err != nil {
+			return []Tag{}, err
+		}
+		if seen[tag.Slug] {
+			continue
+		}
+		seen[tag.Slug] = true
+
+		err = db.Debug().Model(&Tag{}).Where(Tag{Slug: tag.Slug}).Attrs(tag).FirstOrCreate(&tag).Error
+		if err != nil {
+			// Another request may have created the same tag in the meantime
+			err = db.Debug().Model(&Tag{}).Where("slug = ?", tag.Slug).Take(&tag).Error
+			if err != nil {
+				return []Tag{}, err
+			}
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// GetAllTags lists tags with the number of published posts using each, most
+// used first. Other posts are left out of the counts, which anyone may see.
+func (t *Tag) GetAllTags(db *gorm.DB) (*[]Tag, error) {
+	var err error
+	tags := []Tag{}
+	err = db.Debug().Model(&Tag{}).
+		Select("tags.*, COUNT(posts.id) AS post_count").
+		Joins("LEFT JOIN post_tags ON post_tags.tag_id = tags.id").
+		Joins("LEFT JOIN posts ON posts.id = post_tags.post_id AND posts.deleted_at IS NULL AND posts.status = ?", PostPublished).
+		Group("tags.id").
+		Order("post_count DESC, tags.name").
+		Limit(100).
+		Scan(&tags).Error
+	if err != nil {
+		return &[]Tag{}, err
+	}
+	return &tags, nil
+}
+
+func (t *Tag) FindTagBySlug(db *gorm.DB, slug string) (*Tag, error) {
+	var err error
+	err = db.Debug().Model(&Tag{}).Where("slug = ?", slug).Take(&t).Error
+	if err != nil {
+		return &Tag{}, err
+	}
+	return t, nil
+}
+
+// PostsTagged is a scope limiting a post query to posts tagged with any of
+// the given slugs, or with all of them when matchAll is set
+func PostsTagged(slugs []string, matchAll bool) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(slugs) == 0 {
+			return db
+		}
+		tagged := db.New().Table("post_tags").
+			Select("post_tags.post_id").
+			Joins("JOIN tags ON tags.id = post_tags.tag_id").
+			Where("tags.slug IN (?)", slugs)
+		if matchAll {
+			tagged = tagged.Group("post_tags.post_id").Having("COUNT(DISTINCT tags.id) = ?", len(slugs))
+		}
+		return db.Where("posts.id IN ?", tagged.SubQuery())
+	}
+}
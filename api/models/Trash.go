@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TrashRetention is how long deleted users, posts and categories stay in the
+// trash before PurgeTrash removes them for good
+var TrashRetention = 30 * 24 * time.Hour
+
+var ErrParentTrashed = errors.New("Restore the author and category of the post first")
+
+// Trash is what a user can restore: their own posts, or everything for admins
+type Trash struct {
+	Users      []AdminUser `json:"users"`
+	Posts      []Post      `json:"posts"`
+	Categories []Category  `json:"categories"`
+}
+
+// trash soft-deletes the row id of model and the posts whose postColumn
+// points to it, all with the same DeletedAt so restore can tell them apart
+// from posts that were deleted on their own
+func trash(db *gorm.DB, model interface{}, id uint32, postColumn string) (int64, error) {
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Truncate(time.Second)
+		result := tx.Debug().Model(model).Where("id = ?", id).UpdateColumn("deleted_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		deleted = result.RowsAffected
+		return tx.Debug().Model(&Post{}).Where(postColumn+" = ?", id).UpdateColumn("deleted_at", now).Error
+	})
+	return deleted, err
+}
+
+// restore undoes trash. Posts that still have a trashed author or category
+// stay in the trash.
+func restore(db *gorm.DB, model interface{}, id uint32, postColumn string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var deletedAt time.Time
+		err := tx.Debug().Unscoped().Model(model).Select("deleted_at").Where("id = ? AND deleted_at IS NOT NULL", id).Row().Scan(&deletedAt)
+		if err == sql.ErrNoRows {
+			return gorm.ErrRecordNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Debug().Unscoped().Model(model).Where("id = ?", id).UpdateColumn("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		liveUsers := tx.New().Model(&User{}).Select("id").SubQuery()
+		liveCategories := tx.New().Model(&Category{}).Select("id").SubQuery()
+		return tx.Debug().Unscoped().Model(&Post{}).
+			Where(postColumn+" = ? AND deleted_at = ?", id, deletedAt).
+			Where("author_id IN ? AND category_id IN ?", liveUsers, liveCategories).
+			UpdateColumn("deleted_at", nil).Error
+	})
+}
+
+// GetTrash lists what viewer may restore, most recently deleted first
+func GetTrash(db *gorm.DB, viewer *User) (*Trash, error) {
+	trash := Trash{Users: []AdminUser{}, Posts: []Post{}, Categories: []Category{}}
+
+	posts := db.Debug().Unscoped().Model(&Post{}).Where("deleted_at IS NOT NULL")
+	if !viewer.IsAdmin() {
+		posts = posts.Where("author_id = ?", viewer.ID)
+	}
+	err := posts.Order("deleted_at desc").Limit(100).Find(&trash.Posts).Error
+	if err != nil {
+		return &Trash{}, err
+	}
+	if !viewer.IsAdmin() {
+		return &trash, nil
+	}
+
+	users := []User{}
+	err = db.Debug().Unscoped().Model(&User{}).Where("deleted_at IS NOT NULL").Order("deleted_at desc").Limit(100).Find(&users).Error
+	if err != nil {
+		return &Trash{}, err
+	}
+	for i := range users {
+		trash.Users = append(trash.Users, users[i].AdminView())
+	}
+
+	err = db.Debug().Unscoped().Model(&Category{}).Where("deleted_at IS NOT NULL").Order("deleted_at desc").Limit(100).Find(&trash.Categories).Error
+	if err != nil {
+		return &Trash{}, err
+	}
+	return &trash, nil
+}
+
+// PurgeTrash hard-deletes the users, posts and categories deleted before
+// before, and returns how many rows went
+func PurgeTrash(db *gorm.DB, before time.Time) (int64, error) {
+	var purged int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		users := tx.New().Unscoped().Model(&User{}).Select("id").Where("deleted_at < ?", before).SubQuery()
+		categories := tx.New().Unscoped().Model(&Category{}).Select("id").Where("deleted_at < ?", before).SubQuery()
+
+		// The reactions of purged users come off the posts that stay
+		err := purgeReactions(tx, users)
+		if err != nil {
+			return err
+		}
+
+		err = purgeFollows(tx, users, categories)
+		if err != nil {
+			return err
+		}
+		err = purgeReadingLists(tx, users)
+		if err != nil {
+			return err
+		}
+		err = purgeNotifications(tx, users)
+		if err != nil {
+			return err
+		}
+
+		// Posts go first, including any left behind by a purged author or category
+		count, err := purgePosts(tx, "deleted_at < ? OR author_id IN ? OR category_id IN ?", before, users, categories)
+		if err != nil {
+			return err
+		}
+		purged += count
+
+		err = tx.Debug().Where("kind = ? AND target_id IN ?", SlugCategory, categories).Delete(&SlugHistory{}).Error
+		if err != nil {
+			return err
+		}
+
+		// Subcategories of a purged category move to the root. MySQL can't
+		// update a table it reads in a subquery, so the ids are fetched first.
+		parents := []uint32{}
+		err = tx.Debug().Unscoped().Model(&Category{}).Where("deleted_at < ?", before).Pluck("id", &parents).Error
+		if err != nil {
+			return err
+		}
+		if len(parents) > 0 {
+			err = tx.Debug().Unscoped().Model(&Category{}).Where("parent_id IN (?)", parents).UpdateColumn("parent_id", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&User{}, &Category{}} {
+			deleted := tx.Debug().Unscoped().Where("deleted_at < ?", before).Delete(model)
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			purged += deleted.RowsAffected
+		}
+		return nil
+	})
+	return purged, err
+}
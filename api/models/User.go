@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
 	"html"
 	"log"
@@ -12,13 +13,104 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
 type User struct {
 	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
 	Username  string    `gorm:"size:255;not null;unique" json:"username"`
 	Email     string    `gorm:"size:100;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;unique" json:"password"`
+	Password  string    `gorm:"size:100;not null;unique" json:"-"`
+	Role      string    `gorm:"size:20;not null;default:'user'" json:"role"`
 	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	// DeletedAt is set while the user is in the trash
+	DeletedAt *time.Time `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// PublicUser is the profile of a user anyone may see
+type PublicUser struct {
+	ID        uint32    `json:"id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SelfUser is what users see of their own account
+type SelfUser struct {
+	PublicUser
+	Email     string    `json:"email"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AdminUser is what admins see of any account
+type AdminUser struct {
+	SelfUser
+	Role      string     `json:"role"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// IsModerator is true for moderators and admins
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+func (u *User) PublicView() PublicUser {
+	return PublicUser{
+		ID:        u.ID,
+		Username:  u.Username,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+func (u *User) SelfView() SelfUser {
+	return SelfUser{
+		PublicUser: u.PublicView(),
+		Email:      u.Email,
+		UpdatedAt:  u.UpdatedAt,
+	}
+}
+
+func (u *User) AdminView() AdminUser {
+	return AdminUser{
+		SelfUser:  u.SelfView(),
+		Role:      u.Role,
+		DeletedAt: u.DeletedAt,
+	}
+}
+
+// View returns the representation of u that viewer is allowed to see.
+// A nil viewer is an anonymous client.
+func (u *User) View(viewer *User) interface{} {
+	if viewer != nil && viewer.IsAdmin() {
+		return u.AdminView()
+	}
+	if viewer != nil && viewer.ID == u.ID {
+		return u.SelfView()
+	}
+	return u.PublicView()
+}
+
+// Author is a user nested in another resource, such as the author of a post
+// or the editor of a revision. It always encodes as the public profile, so
+// those resources never expose the email of their users.
+type Author struct {
+	User
+}
+
+// TableName keeps authors in the users table
+func (Author) TableName() string {
+	return "users"
+}
+
+func (a Author) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.PublicView())
 }
 
 func Hash(password string) ([]byte, error) {
@@ -116,7 +208,7 @@ func (u *User) GetAllUsers(db *gorm.DB) (*[]User, error) {
 
 func (u *User) FindUserById(db *gorm.DB, uid uint32) (*User, error) {
 	var err error
-	err = db.Debug().Model(User{}).Where("id = ?").Take(&u).Error
+	err = db.Debug().Model(User{}).Where("id = ?", uid).Take(&u).Error
 	if err != nil {
 		return &User{}, err
 	}
@@ -126,6 +218,46 @@ func (u *User) FindUserById(db *gorm.DB, uid uint32) (*User, error) {
 	return u, err
 }
 
+// FindUsersByIds loads the users with the given ids, in no particular order
+func FindUsersByIds(db *gorm.DB, ids []uint32) ([]User, error) {
+	users := []User{}
+	err := db.Debug().Model(&User{}).Where("id IN (?)", ids).Find(&users).Error
+	if err != nil {
+		return []User{}, err
+	}
+	return users, nil
+}
+
+// GetUserPage returns up to limit users after cursor, oldest first. The
+// returned cursor is nil on the last page.
+func GetUserPage(db *gorm.DB, cursor *Cursor, limit int) ([]User, *Cursor, error) {
+	query := db.Debug().Model(&User{})
+	if cursor != nil {
+		query = query.Where("id > ?", cursor.ID)
+	}
+	users := []User{}
+	err := query.Order("id").Limit(limit + 1).Find(&users).Error
+	if err != nil {
+		return []User{}, nil, err
+	}
+	var next *Cursor
+	if len(users) > limit {
+		users = users[:limit]
+		next = &Cursor{ID: uint64(users[limit-1].ID)}
+	}
+	return users, next, nil
+}
+
+// UsersView returns the representation of every user in users that viewer
+// is allowed to see
+func UsersView(users []User, viewer *User) []interface{} {
+	views := make([]interface{}, len(users))
+	for i := range users {
+		views[i] = users[i].View(viewer)
+	}
+	return views
+}
+
 func (u *User) UpdateUser(db *gorm.DB, uid uint32) (*User, error) {
 	err := u.BeforeSave()
 	if err != nil {
@@ -152,10 +284,17 @@ func (u *User) UpdateUser(db *gorm.DB, uid uint32) (*User, error) {
 	return u, nil
 }
 
+// DeleteUser moves the user to the trash along with their posts
 func (u *User) DeleteUser(db *gorm.DB, uid uint32) (int64, error) {
-	db = db.Debug().Model(&User{}).Where("id = ?", uid).Take(&User{}).Delete(&User{})
-	if db.Error != nil {
-		return 0, db.Error
+	return trash(db, &User{}, uid, "author_id")
+}
+
+// RestoreUser takes the user out of the trash, with the posts that were
+// trashed along with them
+func (u *User) RestoreUser(db *gorm.DB, uid uint32) (*User, error) {
+	err := restore(db, &User{}, uid, "author_id")
+	if err != nil {
+		return &User{}, err
 	}
-	return db.RowsAffected, nil
+	return u.FindUserById(db, uid)
 }
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/webhooks"
+)
+
+// Statuses of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// deliveryLease is how long a claimed delivery is held by the worker
+// sending it. A worker that dies leaves it to be retried after that.
+const deliveryLease = 2 * time.Minute
+
+// DeliveryRetention is how long finished deliveries stay in the log
+const DeliveryRetention = 30 * 24 * time.Hour
+
+const webhookSecretBytes = 32
+
+// Webhook subscribes a URL to some types of events. Every event is sent to
+// it in a delivery signed with its secret.
+type Webhook struct {
+	ID  uint64 `gorm:"primary_key;auto_increment" json:"id"`
+	URL string `gorm:"size:2048;not null" json:"url"`
+	// Events is stored as ",type,type," so a type can be matched with LIKE
+	Events    string    `gorm:"size:1000;not null" json:"-"`
+	Secret    string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	EventTypes []string `gorm:"-" json:"events"`
+	// SigningSecret is only shown when the webhook is created
+	SigningSecret string `gorm:"-" json:"secret,omitempty"`
+}
+
+// WebhookDelivery is an event sent, or to be sent, to a webhook. Pending
+// deliveries are the queue of the worker, which sends those whose
+// NextAttemptAt is due.
+type WebhookDelivery struct {
+	ID            uint64     `gorm:"primary_key;auto_increment" json:"id"`
+	WebhookID     uint64     `gorm:"not null;index" json:"webhook_id"`
+	Event         string     `gorm:"size:50;not null" json:"event"`
+	Body          string     `gorm:"type:text;not null" json:"-"`
+	Status        string     `gorm:"size:20;not null" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	ResponseCode  int        `gorm:"not null;default:0" json:"response_code,omitempty"`
+	Error         string     `gorm:"size:1000" json:"error,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+
+	Payload json.RawMessage `gorm:"-" json:"payload"`
+}
+
+func (h *Webhook) Prepare() {
+	h.ID = 0
+	h.URL = strings.TrimSpace(h.URL)
+	for i := range h.EventTypes {
+		h.EventTypes[i] = strings.TrimSpace(h.EventTypes[i])
+	}
+	h.CreatedAt = time.Now()
+	h.UpdatedAt = time.Now()
+}
+
+func (h *Webhook) Validate() error {
+	if h.URL == "" {
+		return errors.New("Required URL")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("Invalid URL")
+	}
+	if len(h.EventTypes) == 0 {
+		return errors.New("Required Events")
+	}
+	for _, t := range h.EventTypes {
+		if !events.ValidType(t) {
+			return errors.New("Invalid Event " + t)
+		}
+	}
+	if h.SigningSecret != "" && len(h.SigningSecret) < 16 {
+		return errors.New("Secret Too Short")
+	}
+	return nil
+}
+
+// AfterFind fills EventTypes
+func (h *Webhook) AfterFind() error {
+	h.EventTypes = []string{}
+	for _, t := range strings.Split(h.Events, ",") {
+		if t != "" {
+			h.EventTypes = append(h.EventTypes, t)
+		}
+	}
+	return nil
+}
+
+// AfterFind fills the Payload shown in the log
+func (d *WebhookDelivery) AfterFind() error {
+	d.Payload = json.RawMessage(d.Body)
+	return nil
+}
+
+// SaveWebhook creates the webhook, with a new secret unless SigningSecret
+// is set. The secret is returned this once.
+func (h *Webhook) SaveWebhook(db *gorm.DB) (*Webhook, error) {
+	if h.SigningSecret == "" {
+		b := make([]byte, webhookSecretBytes)
+		_, err := rand.Read(b)
+		if err != nil {
+			return &Webhook{}, err
+		}
+		h.SigningSecret = hex.EncodeToString(b)
+	}
+	h.Secret = h.SigningSecret
+	h.Events = "," + strings.Join(h.EventTypes, ",") + ","
+	err := db.Debug().Model(&Webhook{}).Create(&h).Error
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return h, nil
+}
+
+func (h *Webhook) FindWebhookById(db *gorm.DB, wid uint64) (*Webhook, error) {
+	err := db.Debug().Model(&Webhook{}).Where("id = ?", wid).Take(&h).Error
+	if err != nil {
+		return &Webhook{}, err
+	}
+	return h, nil
+}
+
+func GetWebhooks(db *gorm.DB) (*[]Webhook, error) {
+	hooks := []Webhook{}
+	err := db.Debug().Model(&Webhook{}).Order("id").Find(&hooks).Error
+	if err != nil {
+		return &[]Webhook{}, err
+	}
+	return &hooks, nil
+}
+
+// DeleteWebhook deletes the webhook and its deliveries, including those
+// not sent yet
+func (h *Webhook) DeleteWebhook(db *gorm.DB, wid uint64) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Debug().Where("webhook_id = ?", wid).Delete(&WebhookDelivery{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Debug().Where("id = ?", wid).Delete(&Webhook{}).Error
+	})
+}
+
+// EnqueueDeliveries queues body for every webhook subscribed to events of
+// type event, to be sent right away
+func EnqueueDeliveries(db *gorm.DB, event string, body []byte) error {
+	hooks := []Webhook{}
+	err := db.Debug().Model(&Webhook{}).Where("events LIKE ?", "%,"+event+",%").Find(&hooks).Error
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, hook := range hooks {
+		err = db.Debug().Create(&WebhookDelivery{
+			WebhookID: hook.ID, Event: event, Body: string(body), Status: DeliveryPending, NextAttemptAt: &now,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimDeliveries returns up to limit pending deliveries that are due at
+// now, each leased to the caller so other workers leave it alone
+func ClaimDeliveries(db *gorm.DB, now time.Time, limit int) ([]WebhookDelivery, error) {
+	due := []WebhookDelivery{}
+	err := db.Debug().Model(&WebhookDelivery{}).Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("next_attempt_at").Limit(limit).Find(&due).Error
+	if err != nil {
+		return []WebhookDelivery{}, err
+	}
+	lease := now.Add(deliveryLease)
+	claimed := []WebhookDelivery{}
+	for _, delivery := range due {
+		// Another worker that got there first moved next_attempt_at
+		updated := db.Debug().Model(&WebhookDelivery{}).Where("id = ? AND next_attempt_at = ?", delivery.ID, delivery.NextAttemptAt).
+			UpdateColumn("next_attempt_at", lease)
+		if updated.Error != nil {
+			return claimed, updated.Error
+		}
+		if updated.RowsAffected == 1 {
+			claimed = append(claimed, delivery)
+		}
+	}
+	return claimed, nil
+}
+
+// RecordAttempt saves the outcome of sending the delivery. A failed delivery
+// is tried again after a backoff, until it has been tried MaxAttempts times.
+func (d *WebhookDelivery) RecordAttempt(db *gorm.DB, code int, sendErr error, now time.Time) error {
+	d.Attempts++
+	d.ResponseCode = code
+	d.Error = ""
+	d.NextAttemptAt = nil
+	switch {
+	case sendErr == nil:
+		d.Status = DeliveryDelivered
+		d.DeliveredAt = &now
+	case d.Attempts >= webhooks.MaxAttempts:
+		d.Status = DeliveryFailed
+	default:
+		next := now.Add(webhooks.Backoff(d.Attempts))
+		d.NextAttemptAt = &next
+	}
+	if sendErr != nil {
+		d.Error = sendErr.Error()
+		if len(d.Error) > 1000 {
+			d.Error = d.Error[:1000]
+		}
+	}
+	return db.Debug().Model(&WebhookDelivery{}).Where("id = ?", d.ID).UpdateColumns(map[string]interface{}{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"response_code":   d.ResponseCode,
+		"error":           d.Error,
+		"next_attempt_at": d.NextAttemptAt,
+		"delivered_at":    d.DeliveredAt,
+		"updated_at":      now,
+	}).Error
+}
+
+// GetDeliveries returns up to limit deliveries of webhook wid after cursor,
+// newest first. The returned cursor is nil on the last page.
+func GetDeliveries(db *gorm.DB, wid uint64, cursor *Cursor, limit int) ([]WebhookDelivery, *Cursor, error) {
+	query := db.Debug().Model(&WebhookDelivery{}).Where("webhook_id = ?", wid)
+	if cursor != nil {
+		query = query.Where("id < ?", cursor.ID)
+	}
+	deliveries := []WebhookDelivery{}
+	err := query.Order("id DESC").Limit(limit + 1).Find(&deliveries).Error
+	if err != nil {
+		return []WebhookDelivery{}, nil, err
+	}
+	var next *Cursor
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		next = &Cursor{ID: deliveries[limit-1].ID}
+	}
+	return deliveries, next, nil
+}
+
+// Redeliver queues a new delivery of the payload of delivery did of webhook
+// wid, to be sent right away. The original stays in the log as it was.
+func Redeliver(db *gorm.DB, wid uint64, did uint64) (*WebhookDelivery, error) {
+	original := WebhookDelivery{}
+	err := db.Debug().Model(&WebhookDelivery{}).Where("id = ? AND webhook_id = ?", did, wid).Take(&original).Error
+	if err != nil {
+		return &WebhookDelivery{}, err
+	}
+	now := time.Now()
+	delivery := WebhookDelivery{
+		WebhookID: wid, Event: original.Event, Body: original.Body, Status: DeliveryPending, NextAttemptAt: &now,
+	}
+	err = db.Debug().Create(&delivery).Error
+	if err != nil {
+		return &WebhookDelivery{}, err
+	}
+	return &delivery, delivery.AfterFind()
+}
+
+// PruneDeliveries deletes the deliveries finished before before
+func PruneDeliveries(db *gorm.DB, before time.Time) error {
+	return db.Debug().Where("status <> ? AND updated_at < ?", DeliveryPending, before).Delete(&WebhookDelivery{}).Error
+}
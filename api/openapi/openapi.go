@@ -0,0 +1,231 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version documents are written in
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Endpoint describes a route for the document. Form, Body and Response are
+// sample values giving the schema of the form-data body, of the JSON body of
+// endpoints reading one instead, and of the successful response body.
+type Endpoint struct {
+	Method     string
+	Path       string
+	Summary    string
+	Tags       []string
+	Auth       bool
+	Deprecated bool
+	Query      []QueryParam
+	Form       interface{}
+	Body       interface{}
+	Status     int
+	Response   interface{}
+	// ContentType of the successful response, application/json when empty
+	ContentType string
+}
+
+type QueryParam struct {
+	Name        string
+	Description string
+}
+
+var pathParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Builder collects endpoints into a Document
+type Builder struct {
+	doc     *Document
+	schemas *schemaGenerator
+}
+
+func NewBuilder(info Info) *Builder {
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*Operation{},
+		Components: Components{
+			Schemas: map[string]*Schema{
+				"Error": {
+					Type:       "object",
+					Properties: map[string]*Schema{"error": {Type: "string"}},
+					Required:   []string{"error"},
+				},
+			},
+			SecuritySchemes: map[string]*SecurityScheme{
+				"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+				"tokenQuery": {Type: "apiKey", Name: "token", In: "query"},
+			},
+		},
+	}
+	return &Builder{
+		doc:     doc,
+		schemas: newSchemaGenerator(doc.Components.Schemas),
+	}
+}
+
+// Alias documents values of type from with the schema of type to. It is
+// meant for types with a custom MarshalJSON.
+func (b *Builder) Alias(from, to interface{}) {
+	b.schemas.aliases[reflect.TypeOf(from)] = reflect.TypeOf(to)
+}
+
+func (b *Builder) Add(e Endpoint) {
+	path := pathParam.ReplaceAllString(e.Path, "{$1}")
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]*Operation{}
+	}
+
+	op := &Operation{
+		Summary:    e.Summary,
+		Tags:       e.Tags,
+		Deprecated: e.Deprecated,
+		Responses:  map[string]*Response{},
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(e.Path, -1) {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:     match[1],
+			In:       "path",
+			Required: true,
+			Schema:   &Schema{Type: "string"},
+		})
+	}
+	for _, q := range e.Query {
+		op.Parameters = append(op.Parameters, &Parameter{
+			Name:        q.Name,
+			In:          "query",
+			Description: q.Description,
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	if e.Form != nil {
+		schema := b.schemas.schema(e.Form)
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"multipart/form-data":               {Schema: schema},
+				"application/x-www-form-urlencoded": {Schema: schema},
+			},
+		}
+	}
+
+	if e.Body != nil {
+		op.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]*MediaType{
+				"application/json": {Schema: b.schemas.schema(e.Body)},
+			},
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	if e.Response != nil && status != http.StatusNoContent {
+		contentType := e.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		success.Content = map[string]*MediaType{
+			contentType: {Schema: b.schemas.schema(e.Response)},
+		}
+	}
+	if e.Deprecated {
+		success.Headers = map[string]*Header{
+			"Deprecation": {Description: "When the route was deprecated", Schema: &Schema{Type: "string"}},
+			"Sunset":      {Description: "When the route will be removed", Schema: &Schema{Type: "string"}},
+		}
+	}
+	op.Responses[strconv.Itoa(status)] = success
+	op.Responses["default"] = &Response{
+		Description: "Error",
+		Content: map[string]*MediaType{
+			"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}},
+		},
+	}
+
+	if e.Auth {
+		op.Security = []map[string][]string{
+			{"bearerAuth": {}},
+			{"tokenQuery": {}},
+		}
+	}
+
+	b.doc.Paths[path][strings.ToLower(e.Method)] = op
+}
+
+func (b *Builder) Document() *Document {
+	return b.doc
+}
@@ -0,0 +1,164 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of JSON Schema used to describe request and
+// response bodies
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+// File is a form field holding an uploaded file, or a binary response body
+type File []byte
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	fileType = reflect.TypeOf(File{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaGenerator derives schemas from Go values the way encoding/json would
+// encode them. Named structs are added to the components once and referenced.
+// Interface fields are described by the value they hold, if any.
+type schemaGenerator struct {
+	components map[string]*Schema
+	aliases    map[reflect.Type]reflect.Type
+}
+
+func newSchemaGenerator(components map[string]*Schema) *schemaGenerator {
+	return &schemaGenerator{
+		components: components,
+		aliases:    map[reflect.Type]reflect.Type{},
+	}
+}
+
+func (g *schemaGenerator) schema(v interface{}) *Schema {
+	return g.schemaOf(reflect.TypeOf(v), reflect.ValueOf(v))
+}
+
+// schemaOf describes type t. v is a value of type t, or the zero Value when
+// there is none to look at.
+func (g *schemaGenerator) schemaOf(t reflect.Type, v reflect.Value) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	if alias, ok := g.aliases[t]; ok {
+		t, v = alias, reflect.Value{}
+	}
+
+	if t == fileType {
+		return &Schema{Type: "string", Format: "binary"}
+	}
+	if t == rawType {
+		// Raw JSON can be any value
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v.IsValid() && !v.IsNil() {
+			return g.schemaOf(t.Elem(), v.Elem())
+		}
+		return g.schemaOf(t.Elem(), reflect.Value{})
+	case reflect.Interface:
+		if v.IsValid() && !v.IsNil() {
+			return g.schemaOf(v.Elem().Type(), v.Elem())
+		}
+		return &Schema{}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int32", Minimum: &zero}
+	case reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: "int64", Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem(), reflect.Value{})}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem(), reflect.Value{})}
+	case reflect.Struct:
+		if t == timeType {
+			return &Schema{Type: "string", Format: "date-time"}
+		}
+		if t.Name() == "" {
+			return g.object(t, v)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.components[t.Name()] = &Schema{}
+			*g.components[t.Name()] = *g.object(t, v)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+func (g *schemaGenerator) object(t reflect.Type, v reflect.Value) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t, v)
+	sort.Strings(s.Required)
+	return s
+}
+
+func (g *schemaGenerator) addFields(s *Schema, t reflect.Type, v reflect.Value) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		value := reflect.Value{}
+		if v.IsValid() {
+			value = v.Field(i)
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+
+		// Embedded structs without a json name are flattened like encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded, value = embedded.Elem(), reflect.Value{}
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(s, embedded, value)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		s.Properties[name] = g.schemaOf(field.Type, value)
+		if !strings.Contains(options, "omitempty") && field.Type.Kind() != reflect.Ptr {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package realtime
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// PingPeriod is how often connections are pinged. A connection that doesn't
+// answer, or send anything else, within twice that is closed.
+var PingPeriod = 30 * time.Second
+
+const (
+	// writeWait is how long a write may take before the connection is
+	// given up on
+	writeWait = 10 * time.Second
+	// maxMessageSize is the largest message a client may send
+	maxMessageSize = 4096
+)
+
+// Authorize tells whether the member of a connection may join the room of
+// a post, with the reason sent back to the client when it may not
+type Authorize func(member Member, postID uint64) error
+
+// Serve connects conn to the hub as member until either of them closes.
+// Clients send join, leave and typing messages naming a post_id, and ping
+// messages when they can't send ping frames.
+func (h *Hub) Serve(conn *websocket.Conn, member Member, authorize Authorize) {
+	period := PingPeriod
+	client := h.Connect(member)
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		h.write(conn, client, period)
+	}()
+	defer func() {
+		// The connection is gone, so there's no one left to tell why
+		conn.Close()
+		h.Disconnect(client)
+		<-written
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	alive := func() {
+		conn.SetReadDeadline(time.Now().Add(2 * period))
+	}
+	alive()
+	conn.SetPongHandler(func(string) error {
+		alive()
+		return nil
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		alive()
+		m := Message{}
+		err = json.Unmarshal(data, &m)
+		if err != nil {
+			h.Reply(client, Message{Type: Error, Error: "Invalid message"})
+			continue
+		}
+
+		switch m.Type {
+		case Join:
+			err = authorize(member, m.PostID)
+			if err != nil {
+				h.Reply(client, Message{Type: Error, PostID: m.PostID, Error: err.Error()})
+				continue
+			}
+			h.Join(client, m.PostID)
+		case Leave:
+			h.Leave(client, m.PostID)
+		case Typing:
+			h.SetTyping(client, m.PostID, m.Typing != nil && *m.Typing)
+		case Ping:
+			h.Reply(client, Message{Type: Pong})
+		default:
+			h.Reply(client, Message{Type: Error, Error: "Unknown message type"})
+		}
+	}
+}
+
+// write sends the messages of client and the pings to conn. Once the
+// client is closed, it says why and closes conn, which ends the reads.
+func (h *Hub) write(conn *websocket.Conn, client *Client, period time.Duration) {
+	defer conn.Close()
+	ping := time.NewTicker(period)
+	defer ping.Stop()
+	for {
+		select {
+		case m, ok := <-client.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// Dropped for falling behind, unless the hub is closing
+				code, reason := websocket.CloseTryAgainLater, "Too far behind"
+				select {
+				case <-h.Done():
+					code, reason = websocket.CloseGoingAway, "Server shutting down"
+				default:
+				}
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+				return
+			}
+			if conn.WriteJSON(m) != nil {
+				return
+			}
+		case <-ping.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if conn.WriteMessage(websocket.PingMessage, nil) != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package realtime
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Types of messages
+const (
+	// Join and Leave are sent by clients entering and leaving the room of a
+	// post, and to the room when a user is first in or last out of it
+	Join  = "join"
+	Leave = "leave"
+	// Typing is sent by clients starting or stopping to type in a room, and
+	// to the other users of the room
+	Typing = "typing"
+	// Presence lists the users in a room, sent to a client when it joins
+	Presence = "presence"
+	// Comment is a comment approved on the post of the room
+	Comment = "comment"
+	// Ping is answered with a Pong, for clients that can't send ping frames
+	Ping  = "ping"
+	Pong  = "pong"
+	Error = "error"
+)
+
+// Member is a user connected to the hub
+type Member struct {
+	ID       uint32 `json:"id"`
+	Username string `json:"username"`
+}
+
+// Message is what clients and the hub send each other. Rooms are those of
+// posts, named by PostID.
+type Message struct {
+	Type   string          `json:"type"`
+	PostID uint64          `json:"post_id,omitempty"`
+	User   *Member         `json:"user,omitempty"`
+	Users  []Member        `json:"users,omitempty"`
+	Typing *bool           `json:"typing,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Broadcaster carries the messages of the rooms to the hubs of every
+// instance of the API, including the one they come from. The hubs keep
+// track of presence from the joins and leaves they get, so every instance
+// sees the users connected to the others.
+type Broadcaster interface {
+	Publish(m Message) error
+	// Subscribe calls handler with every message published from now on,
+	// until the returned function is called
+	Subscribe(handler func(m Message)) func()
+}
+
+// LocalBroadcaster is the Broadcaster of a single instance, handing the
+// messages straight to its subscribers
+type LocalBroadcaster struct {
+	mu       sync.RWMutex
+	next     int
+	handlers map[int]func(Message)
+}
+
+func NewLocalBroadcaster() *LocalBroadcaster {
+	return &LocalBroadcaster{handlers: map[int]func(Message){}}
+}
+
+func (b *LocalBroadcaster) Publish(m Message) error {
+	b.mu.RLock()
+	handlers := make([]func(Message), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(m)
+	}
+	return nil
+}
+
+func (b *LocalBroadcaster) Subscribe(handler func(m Message)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.handlers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Client is a connection to the hub. Messages for it arrive on C, which is
+// closed when the client is disconnected, the hub is closed or the client
+// fell too far behind.
+type Client struct {
+	C      <-chan Message
+	Member Member
+
+	c      chan Message
+	rooms  map[uint64]bool
+	closed bool
+}
+
+type presence struct {
+	member      Member
+	connections int
+}
+
+// Hub keeps the rooms of posts and the users in them. What happens in a
+// room goes through the broadcaster, which hands it back to the hub of
+// every instance to send to its clients in the room.
+type Hub struct {
+	broadcaster Broadcaster
+	unsubscribe func()
+	queue       int
+
+	mu       sync.Mutex
+	clients  map[*Client]struct{}
+	rooms    map[uint64]map[*Client]struct{}
+	presence map[uint64]map[uint32]*presence
+	closed   bool
+	done     chan struct{}
+}
+
+// NewHub returns a hub sharing its rooms through broadcaster, holding up to
+// queue messages for each client before dropping it
+func NewHub(broadcaster Broadcaster, queue int) *Hub {
+	h := &Hub{
+		broadcaster: broadcaster,
+		queue:       queue,
+		clients:     map[*Client]struct{}{},
+		rooms:       map[uint64]map[*Client]struct{}{},
+		presence:    map[uint64]map[uint32]*presence{},
+		done:        make(chan struct{}),
+	}
+	h.unsubscribe = broadcaster.Subscribe(h.deliver)
+	return h
+}
+
+// Connect adds a client for member, in no room yet
+func (h *Hub) Connect(member Member) *Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c := make(chan Message, h.queue)
+	client := &Client{C: c, Member: member, c: c, rooms: map[uint64]bool{}}
+	if h.closed {
+		client.closed = true
+		close(c)
+		return client
+	}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+// Disconnect takes client out of its rooms and stops sending it messages
+func (h *Hub) Disconnect(client *Client) {
+	h.mu.Lock()
+	rooms := h.leaveAll(client)
+	h.drop(client)
+	h.mu.Unlock()
+
+	for _, postID := range rooms {
+		h.publish(Message{Type: Leave, PostID: postID, User: &client.Member})
+	}
+}
+
+// Join puts client in the room of a post. It gets the users already there
+// first, then what happens in the room.
+func (h *Hub) Join(client *Client, postID uint64) {
+	h.mu.Lock()
+	if client.closed || client.rooms[postID] {
+		h.mu.Unlock()
+		return
+	}
+	users := []Member{}
+	for _, p := range h.presence[postID] {
+		users = append(users, p.member)
+	}
+	h.send(client, Message{Type: Presence, PostID: postID, Users: users})
+	client.rooms[postID] = true
+	if h.rooms[postID] == nil {
+		h.rooms[postID] = map[*Client]struct{}{}
+	}
+	h.rooms[postID][client] = struct{}{}
+	h.mu.Unlock()
+
+	h.publish(Message{Type: Join, PostID: postID, User: &client.Member})
+}
+
+// Leave takes client out of the room of a post
+func (h *Hub) Leave(client *Client, postID uint64) {
+	h.mu.Lock()
+	if !client.rooms[postID] {
+		h.mu.Unlock()
+		return
+	}
+	h.leave(client, postID)
+	h.mu.Unlock()
+
+	h.publish(Message{Type: Leave, PostID: postID, User: &client.Member})
+}
+
+// SetTyping tells the other users in the room of a post that the user of
+// client started or stopped typing
+func (h *Hub) SetTyping(client *Client, postID uint64, typing bool) {
+	h.mu.Lock()
+	in := client.rooms[postID]
+	h.mu.Unlock()
+	if in {
+		h.publish(Message{Type: Typing, PostID: postID, User: &client.Member, Typing: &typing})
+	}
+}
+
+// Broadcast sends a message of the server to the room of a post, such as a
+// new comment
+func (h *Hub) Broadcast(postID uint64, kind string, data []byte) {
+	h.publish(Message{Type: kind, PostID: postID, Data: data})
+}
+
+// Reply sends m to client alone
+func (h *Hub) Reply(client *Client, m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.send(client, m)
+}
+
+// Done is closed when the hub is closed
+func (h *Hub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Close disconnects every client, for a graceful shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return
+	}
+	h.closed = true
+	for client := range h.clients {
+		h.drop(client)
+	}
+	close(h.done)
+	h.mu.Unlock()
+
+	h.unsubscribe()
+}
+
+func (h *Hub) publish(m Message) {
+	err := h.broadcaster.Publish(m)
+	if err != nil {
+		log.Printf("Cannot broadcast %s message: %v", m.Type, err)
+	}
+}
+
+// deliver sends a message of the broadcaster to the clients of the room.
+// Joins and leaves are only sent for a user's first and last connection to
+// the room, on any instance.
+func (h *Hub) deliver(m Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch m.Type {
+	case Join, Leave:
+		if m.User == nil {
+			return
+		}
+		members := h.presence[m.PostID]
+		if members == nil {
+			members = map[uint32]*presence{}
+			h.presence[m.PostID] = members
+		}
+		p := members[m.User.ID]
+		if m.Type == Join {
+			if p == nil {
+				p = &presence{member: *m.User}
+				members[m.User.ID] = p
+			}
+			p.connections++
+			if p.connections > 1 {
+				return
+			}
+		} else {
+			if p == nil {
+				return
+			}
+			p.connections--
+			if p.connections > 0 {
+				return
+			}
+			delete(members, m.User.ID)
+			if len(members) == 0 {
+				delete(h.presence, m.PostID)
+			}
+		}
+	}
+
+	for client := range h.rooms[m.PostID] {
+		if m.Type == Typing && m.User != nil && client.Member.ID == m.User.ID {
+			continue
+		}
+		h.send(client, m)
+	}
+}
+
+// send queues m for client, dropping the client when its queue is full.
+// The caller holds h.mu.
+func (h *Hub) send(client *Client, m Message) {
+	if client.closed {
+		return
+	}
+	select {
+	case client.c <- m:
+	default:
+		h.drop(client)
+	}
+}
+
+// drop closes the channel of client. It stays in its rooms until it is
+// disconnected, so its leaves are still sent.
+func (h *Hub) drop(client *Client) {
+	delete(h.clients, client)
+	if !client.closed {
+		client.closed = true
+		close(client.c)
+	}
+}
+
+// leaveAll takes client out of every room, returning them
+func (h *Hub) leaveAll(client *Client) []uint64 {
+	rooms := []uint64{}
+	for postID := range client.rooms {
+		h.leave(client, postID)
+		rooms = append(rooms, postID)
+	}
+	return rooms
+}
+
+func (h *Hub) leave(client *Client, postID uint64) {
+	delete(client.rooms, postID)
+	delete(h.rooms[postID], client)
+	if len(h.rooms[postID]) == 0 {
+		delete(h.rooms, postID)
+	}
+}
@@ -0,0 +1,40 @@
+package responses
+
+import "net/http"
+
+// EnvelopeVersion is reported in the meta of every enveloped response and
+// changes whenever the envelope shape does
+const EnvelopeVersion = "1"
+
+type Meta map[string]interface{}
+
+type Links map[string]string
+
+// Envelope wraps a response body so that pagination, versioning and
+// navigation details have a fixed place next to the data
+type Envelope struct {
+	Data  interface{} `json:"data"`
+	Meta  Meta        `json:"meta"`
+	Links Links       `json:"links,omitempty"`
+}
+
+// ENVELOPE_JSON writes data wrapped in an Envelope. The sparse fieldset of
+// the request applies to data, and meta always carries the envelope version.
+func ENVELOPE_JSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}, meta Meta, links Links) {
+	selected, err := SelectFields(data, ParseFields(r))
+	if err != nil {
+		ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if meta == nil {
+		meta = Meta{}
+	}
+	meta["version"] = EnvelopeVersion
+
+	JSON(w, statusCode, Envelope{
+		Data:  selected,
+		Meta:  meta,
+		Links: links,
+	})
+}
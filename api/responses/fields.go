@@ -0,0 +1,93 @@
+package responses
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// FieldSet is a tree of the fields requested with ?fields=, e.g.
+// "id,author.username" becomes {id: {}, author: {username: {}}}.
+// A node without children selects the whole value.
+type FieldSet map[string]FieldSet
+
+// ParseFields reads the fields query parameter. It returns nil when the
+// client did not ask for a sparse fieldset.
+func ParseFields(r *http.Request) FieldSet {
+	value := strings.TrimSpace(r.URL.Query().Get("fields"))
+	if value == "" {
+		return nil
+	}
+
+	fields := FieldSet{}
+	for _, path := range strings.Split(value, ",") {
+		node := fields
+		for _, name := range strings.Split(strings.TrimSpace(path), ".") {
+			if name == "" {
+				break
+			}
+			if node[name] == nil {
+				node[name] = FieldSet{}
+			}
+			node = node[name]
+		}
+	}
+	return fields
+}
+
+// SelectFields returns data reduced to the given fields. Objects keep only
+// the requested keys and arrays have the selection applied to each element.
+func SelectFields(data interface{}, fields FieldSet) (interface{}, error) {
+	if len(fields) == 0 {
+		return data, nil
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+
+	var value interface{}
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return fields.apply(value), nil
+}
+
+func (fields FieldSet) apply(value interface{}) interface{} {
+	if len(fields) == 0 {
+		return value
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for i := range v {
+			v[i] = fields.apply(v[i])
+		}
+		return v
+	case map[string]interface{}:
+		selected := map[string]interface{}{}
+		for name, children := range fields {
+			if field, ok := v[name]; ok {
+				selected[name] = children.apply(field)
+			}
+		}
+		return selected
+	}
+	return value
+}
+
+// SPARSE_JSON writes data like JSON, keeping only the fields listed in the
+// request's fields query parameter (?fields=id,title,author.username)
+func SPARSE_JSON(w http.ResponseWriter, r *http.Request, statusCode int, data interface{}) {
+	selected, err := SelectFields(data, ParseFields(r))
+	if err != nil {
+		ERROR(w, http.StatusInternalServerError, err)
+		return
+	}
+	JSON(w, statusCode, selected)
+}
@@ -4,8 +4,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"time"
 )
 
+// AuthResponse is the body returned by /login and /register
+type AuthResponse struct {
+	User         interface{} `json:"user"`
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	ExpiresIn    int64       `json:"expires_in"` // seconds until access_token expires
+	RefreshToken string      `json:"refresh_token,omitempty"`
+}
+
 func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.WriteHeader(statusCode)
 	err := json.NewEncoder(w).Encode(data)
@@ -13,16 +23,16 @@ func JSON(w http.ResponseWriter, statusCode int, data interface{}) {
 		fmt.Fprintf(w, "%s", err.Error())
 	}
 }
-func AUTH_JSON(w http.ResponseWriter, statusCode int, data interface{}, token interface{}) {
-	w.WriteHeader(statusCode)
-	err := json.NewEncoder(w).Encode(data)
-	if err != nil {
-		fmt.Fprintf(w, "%s", err.Error())
-	}
-	err = json.NewEncoder(w).Encode(token)
-	if err != nil {
-		fmt.Fprintf(w, "%s", err.Error())
-	}
+
+// AUTH_JSON writes the user together with their bearer access token as a
+// single AuthResponse document
+func AUTH_JSON(w http.ResponseWriter, statusCode int, user interface{}, token string, expiresIn time.Duration) {
+	JSON(w, statusCode, AuthResponse{
+		User:        user,
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(expiresIn / time.Second),
+	})
 }
 
 func ERROR(w http.ResponseWriter, statusCode int, err error) {
@@ -0,0 +1,88 @@
+// Package rpc holds the plumbing of the gRPC API: authentication and the
+// statuses of errors. The services themselves are in the controllers
+// package, next to the REST handlers they share their logic with.
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type userIDKey struct{}
+
+// UserID returns the id of the user whose token the call carries, 0 for
+// anonymous calls
+func UserID(ctx context.Context) uint32 {
+	uid, _ := ctx.Value(userIDKey{}).(uint32)
+	return uid
+}
+
+// Auth reads the access token of calls from their "authorization: Bearer
+// <token>" metadata. Calls with an invalid token are refused, as are the
+// anonymous calls of Protected methods.
+type Auth struct {
+	// Parse returns the id of the user a token was issued to
+	Parse func(token string) (uint32, error)
+	// Protected are full method names such as /blog.v1.PostService/UpdatePost
+	Protected map[string]bool
+}
+
+func (a Auth) authenticate(ctx context.Context, method string) (context.Context, error) {
+	var token string
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		parts := strings.Fields(value)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+			token = parts[1]
+		}
+	}
+
+	var uid uint32
+	if token != "" {
+		var err error
+		uid, err = a.Parse(token)
+		if err != nil || uid == 0 {
+			return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+		}
+	}
+	if uid == 0 && a.Protected[method] {
+		return nil, status.Error(codes.Unauthenticated, "Unauthorized")
+	}
+	return context.WithValue(ctx, userIDKey{}, uid), nil
+}
+
+// Unary authenticates unary calls
+func (a Auth) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream authenticates streaming calls
+func (a Auth) Stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,7 @@
+// Package blogpb holds the protobuf messages and gRPC services of
+// blog.proto. The other files are generated; regenerate them after changing
+// blog.proto with go generate, which needs protoc, protoc-gen-go and
+// protoc-gen-go-grpc.
+package blogpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative blog.proto
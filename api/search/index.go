@@ -0,0 +1,269 @@
+package search
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/utils/markdown"
+)
+
+// BM25 parameters, and how much more a word in the title counts than one
+// in the content
+const (
+	bm25K1      = 1.2
+	bm25B       = 0.75
+	titleWeight = 3
+)
+
+// filterBatch keeps the id lists sent to the database under the SQLite
+// variable limit
+const filterBatch = 500
+
+type document struct {
+	updatedAt time.Time
+	length    int
+	terms     map[string]int
+}
+
+// Index is an in-memory inverted index of the posts ranked with BM25, for
+// databases without full-text search. Before every search it checks whether
+// the row count or latest updated_at of the posts table changed, and if so
+// catches up by reindexing the posts whose updated_at changed.
+type Index struct {
+	// mu guards the index itself. It is only held to read or change it,
+	// never while querying the database.
+	mu       sync.Mutex
+	docs     map[uint64]*document
+	postings map[string]map[uint64]int
+	length   int
+	// indexed is the state of the posts table the index caught up with
+	indexed *tableState
+
+	// refreshing lets one search at a time catch up with the posts table.
+	// As the refresh is the only change to the index, it reads docs
+	// without holding mu.
+	refreshing sync.Mutex
+}
+
+// tableState is the row count and latest updated_at of the posts table
+type tableState struct {
+	count  int
+	latest string
+}
+
+func NewIndex() *Index {
+	return &Index{
+		docs:     map[uint64]*document{},
+		postings: map[string]map[uint64]int{},
+	}
+}
+
+func (idx *Index) Search(db *gorm.DB, text string, filter Filter, limit, offset int) ([]Match, error) {
+	err := idx.refresh(db)
+	if err != nil {
+		return []Match{}, err
+	}
+	idx.mu.Lock()
+	matches := idx.rank(Terms(text))
+	idx.mu.Unlock()
+
+	// Keep the matches the filter allows, in rank order
+	allowed := map[uint64]bool{}
+	for start := 0; start < len(matches); start += filterBatch {
+		end := start + filterBatch
+		if end > len(matches) {
+			end = len(matches)
+		}
+		ids := make([]uint64, 0, end-start)
+		for _, match := range matches[start:end] {
+			ids = append(ids, match.PostID)
+		}
+		found := []uint64{}
+		err = filter(db.Debug().Model(&models.Post{})).Where("posts.id IN (?)", ids).Pluck("posts.id", &found).Error
+		if err != nil {
+			return []Match{}, err
+		}
+		for _, id := range found {
+			allowed[id] = true
+		}
+	}
+
+	page := []Match{}
+	for _, match := range matches {
+		if !allowed[match.PostID] {
+			continue
+		}
+		if offset > 0 {
+			offset--
+			continue
+		}
+		if len(page) == limit {
+			break
+		}
+		page = append(page, match)
+	}
+	return page, nil
+}
+
+// postsState reads the tableState of the posts table
+func postsState(db *gorm.DB) (tableState, error) {
+	state := tableState{}
+	var latest sql.NullString
+	err := db.Debug().Model(&models.Post{}).Select("COUNT(*), MAX(updated_at)").Row().Scan(&state.count, &latest)
+	state.latest = latest.String
+	return state, err
+}
+
+// refresh reindexes the posts that changed since they were indexed and
+// drops the ones that are gone, unless the posts table looks as it did at
+// the last refresh
+func (idx *Index) refresh(db *gorm.DB) error {
+	state, err := postsState(db)
+	if err != nil {
+		return err
+	}
+	idx.mu.Lock()
+	fresh := idx.indexed != nil && *idx.indexed == state
+	idx.mu.Unlock()
+	if fresh {
+		return nil
+	}
+
+	idx.refreshing.Lock()
+	defer idx.refreshing.Unlock()
+	// Another search may have caught up meanwhile
+	if idx.indexed != nil && *idx.indexed == state {
+		return nil
+	}
+
+	type version struct {
+		ID        uint64
+		UpdatedAt time.Time
+	}
+	versions := []version{}
+	err = db.Debug().Model(&models.Post{}).Select("id, updated_at").Scan(&versions).Error
+	if err != nil {
+		return err
+	}
+
+	live := map[uint64]bool{}
+	stale := []uint64{}
+	for _, v := range versions {
+		live[v.ID] = true
+		if doc, ok := idx.docs[v.ID]; !ok || !doc.updatedAt.Equal(v.UpdatedAt) {
+			stale = append(stale, v.ID)
+		}
+	}
+	idx.mu.Lock()
+	for id := range idx.docs {
+		if !live[id] {
+			idx.remove(id)
+		}
+	}
+	idx.mu.Unlock()
+
+	for start := 0; start < len(stale); start += filterBatch {
+		end := start + filterBatch
+		if end > len(stale) {
+			end = len(stale)
+		}
+		posts := []models.Post{}
+		err = db.Debug().Model(&models.Post{}).Where("id IN (?)", stale[start:end]).Find(&posts).Error
+		if err != nil {
+			return err
+		}
+		idx.mu.Lock()
+		for _, post := range posts {
+			idx.add(post)
+		}
+		idx.mu.Unlock()
+	}
+
+	// The state was read before the posts, so changes made meanwhile are
+	// caught up with by the next search
+	idx.mu.Lock()
+	idx.indexed = &state
+	idx.mu.Unlock()
+	return nil
+}
+
+func (idx *Index) add(post models.Post) {
+	idx.remove(post.ID)
+
+	doc := &document{updatedAt: post.UpdatedAt, terms: map[string]int{}}
+	for _, term := range Terms(post.Title) {
+		doc.terms[term] += titleWeight
+		doc.length += titleWeight
+	}
+	for _, term := range Terms(markdown.PlainText(post.ContentHTML)) {
+		doc.terms[term]++
+		doc.length++
+	}
+
+	idx.docs[post.ID] = doc
+	idx.length += doc.length
+	for term, count := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = map[uint64]int{}
+		}
+		idx.postings[term][post.ID] = count
+	}
+}
+
+func (idx *Index) remove(id uint64) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	for term := range doc.terms {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	idx.length -= doc.length
+	delete(idx.docs, id)
+}
+
+// rank scores every post containing any of the terms with BM25
+func (idx *Index) rank(terms []string) []Match {
+	if len(idx.docs) == 0 {
+		return []Match{}
+	}
+	n := float64(len(idx.docs))
+	average := float64(idx.length) / n
+
+	scores := map[uint64]float64{}
+	seen := map[string]bool{}
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		idf := math.Log(1 + (n-float64(len(postings))+0.5)/(float64(len(postings))+0.5))
+		for id, count := range postings {
+			tf := float64(count)
+			norm := 1 - bm25B + bm25B*float64(idx.docs[id].length)/average
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	matches := make([]Match, 0, len(scores))
+	for id, score := range scores {
+		matches = append(matches, Match{PostID: id, Score: score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].PostID > matches[j].PostID
+	})
+	return matches
+}
@@ -0,0 +1,162 @@
+package search
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/utils/slug"
+)
+
+// Match is a post matching a search, with its relevance. Scores are only
+// comparable within one engine.
+type Match struct {
+	PostID uint64
+	Score  float64
+}
+
+// Result is a post found by a search. Snippet is HTML: an escaped extract
+// of the content with the matching words in <mark> tags.
+type Result struct {
+	Post    *models.Post `json:"post"`
+	Score   float64      `json:"score"`
+	Snippet string       `json:"snippet"`
+}
+
+// Filter narrows the posts query a search runs against, e.g. to the posts
+// the client may see in a given category
+type Filter func(db *gorm.DB) *gorm.DB
+
+// Engine finds the posts matching text, most relevant first, and returns
+// the page of them given by limit and offset
+type Engine interface {
+	Search(db *gorm.DB, text string, filter Filter, limit, offset int) ([]Match, error)
+}
+
+// ForDialect returns the engine that works best with the database: the
+// full-text indexes of MySQL and Postgres, or an in-memory inverted index
+// for anything else
+func ForDialect(dialect string) Engine {
+	switch dialect {
+	case "mysql":
+		return MySQL{}
+	case "postgres":
+		return Postgres{}
+	}
+	return NewIndex()
+}
+
+// Migrate creates the full-text index the engine of the dialect needs
+func Migrate(db *gorm.DB) error {
+	switch db.Dialect().GetName() {
+	case "mysql":
+		return MySQL{}.migrate(db)
+	case "postgres":
+		return Postgres{}.migrate(db)
+	}
+	return nil
+}
+
+// Terms splits text into lowercase words, with accented, Cyrillic and
+// Greek letters transliterated, so "Crème" finds "creme"
+func Terms(text string) []string {
+	terms := []string{}
+	for _, term := range strings.Split(slug.Make(text), "-") {
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Snippet returns about width characters of text around the first word
+// matching the query, as HTML with the matching words in <mark> tags
+func Snippet(text string, query string, width int) string {
+	terms := Terms(query)
+	matches := func(word string) bool {
+		for _, w := range Terms(word) {
+			for _, term := range terms {
+				// Prefixes catch the stemmed matches of the SQL engines
+				if w == term || (len(term) >= 3 && strings.HasPrefix(w, term)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	runes := []rune(text)
+	type word struct{ start, end int }
+	words := []word{}
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(runes) && isWordRune(runes[i]) {
+			i++
+		}
+		words = append(words, word{start, i})
+	}
+
+	// Center the window on the first match, or show the beginning
+	from := 0
+	for _, w := range words {
+		if matches(string(runes[w.start:w.end])) {
+			from = w.start - width/3
+			break
+		}
+	}
+	if from < 0 {
+		from = 0
+	}
+	to := from + width
+	if to > len(runes) {
+		to = len(runes)
+		from = to - width
+		if from < 0 {
+			from = 0
+		}
+	}
+	// Don't cut words in half, unless the window is one long word
+	start, end := from, to
+	for start > 0 && start < end && isWordRune(runes[start-1]) {
+		start++
+	}
+	for end < len(runes) && end > start && isWordRune(runes[end]) {
+		end--
+	}
+	if end > start {
+		from, to = start, end
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	last := from
+	for _, w := range words {
+		if w.start < from || w.end > to {
+			continue
+		}
+		if matches(string(runes[w.start:w.end])) {
+			b.WriteString(html.EscapeString(string(runes[last:w.start])))
+			b.WriteString("<mark>")
+			b.WriteString(html.EscapeString(string(runes[w.start:w.end])))
+			b.WriteString("</mark>")
+			last = w.end
+		}
+	}
+	b.WriteString(html.EscapeString(string(runes[last:to])))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
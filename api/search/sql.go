@@ -0,0 +1,67 @@
+package search
+
+import (
+	"github.com/jinzhu/gorm"
+	"github.com/rizalreza/golang-restful/api/models"
+)
+
+// MySQL searches with a FULLTEXT index in natural language mode
+type MySQL struct{}
+
+const mysqlMatch = "MATCH (posts.title, posts.content) AGAINST (? IN NATURAL LANGUAGE MODE)"
+
+func (MySQL) migrate(db *gorm.DB) error {
+	count := 0
+	err := db.Debug().Table("information_schema.statistics").
+		Where("table_schema = DATABASE() AND table_name = ? AND index_name = ?", "posts", "idx_posts_search").
+		Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+	return db.Debug().Exec("ALTER TABLE posts ADD FULLTEXT INDEX idx_posts_search (title, content)").Error
+}
+
+func (MySQL) Search(db *gorm.DB, text string, filter Filter, limit, offset int) ([]Match, error) {
+	query := db.Debug().Model(&models.Post{}).
+		Select("posts.id, "+mysqlMatch+" AS score", text).
+		Where(mysqlMatch, text)
+	return scanMatches(filter(query).Order("score DESC").Limit(limit).Offset(offset))
+}
+
+// Postgres searches a GIN index over a tsvector weighting titles above content
+type Postgres struct{}
+
+const (
+	postgresDocument = "(setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', content), 'B'))"
+	postgresQuery    = "plainto_tsquery('english', ?)"
+)
+
+func (Postgres) migrate(db *gorm.DB) error {
+	return db.Debug().Exec("CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING GIN (" + postgresDocument + ")").Error
+}
+
+func (Postgres) Search(db *gorm.DB, text string, filter Filter, limit, offset int) ([]Match, error) {
+	query := db.Debug().Model(&models.Post{}).
+		Select("posts.id, ts_rank("+postgresDocument+", "+postgresQuery+") AS score", text).
+		Where(postgresDocument+" @@ "+postgresQuery, text)
+	return scanMatches(filter(query).Order("score DESC").Limit(limit).Offset(offset))
+}
+
+func scanMatches(query *gorm.DB) ([]Match, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return []Match{}, err
+	}
+	defer rows.Close()
+
+	matches := []Match{}
+	for rows.Next() {
+		match := Match{}
+		err = rows.Scan(&match.PostID, &match.Score)
+		if err != nil {
+			return []Match{}, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, rows.Err()
+}
@@ -42,11 +42,11 @@ var posts = []models.Post{
 
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Post{}, &models.User{}, &models.Category{}).Error
+	err := db.Debug().DropTableIfExists(models.AllTables()...).Error
 	if err != nil {
 		log.Fatalf("Cannot drop table: %v", err)
 	}
-	err = db.Debug().AutoMigrate(&models.User{}, &models.Category{}, &models.Post{}).Error
+	err = db.Debug().AutoMigrate(models.All()...).Error
 	if err != nil {
 		log.Fatalf("Cannot migrate table: %v", err)
 	}
@@ -1,12 +1,19 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/rizalreza/golang-restful/api/controllers"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/storage"
 )
 
 var server = controllers.Server{}
@@ -21,10 +28,58 @@ func Run() {
 		fmt.Println("We are getting the env values")
 	}
 
+	// Comments from accounts younger than this wait for a moderator, e.g. 24h
+	if age := os.Getenv("NEW_ACCOUNT_AGE"); age != "" {
+		models.NewAccountAge, err = time.ParseDuration(age)
+		if err != nil {
+			log.Fatalf("Invalid NEW_ACCOUNT_AGE %v", err)
+		}
+	}
+
+	// Deleted users, posts and categories are purged after this long, e.g. 720h
+	if retention := os.Getenv("TRASH_RETENTION"); retention != "" {
+		models.TrashRetention, err = time.ParseDuration(retention)
+		if err != nil {
+			log.Fatalf("Invalid TRASH_RETENTION %v", err)
+		}
+	}
+
+	// Uploads are kept under MEDIA_DIR, or in an S3 compatible bucket when
+	// S3_BUCKET is set
+	if bucket := os.Getenv("S3_BUCKET"); bucket != "" {
+		server.Blobs = storage.NewS3(os.Getenv("S3_ENDPOINT"), bucket, os.Getenv("S3_REGION"), os.Getenv("S3_ACCESS_KEY_ID"), os.Getenv("S3_SECRET_ACCESS_KEY"))
+	} else if dir := os.Getenv("MEDIA_DIR"); dir != "" {
+		server.Blobs = storage.NewLocal(dir)
+	}
+	// Largest upload accepted, in bytes
+	if size := os.Getenv("MEDIA_MAX_SIZE"); size != "" {
+		models.MaxMediaSize, err = strconv.ParseInt(size, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid MEDIA_MAX_SIZE %v", err)
+		}
+	}
+
+	// Internal services call the gRPC API on GRPC_ADDRESS, :9090 by default
+	server.GRPCAddress = os.Getenv("GRPC_ADDRESS")
+	if server.GRPCAddress == "" {
+		server.GRPCAddress = ":9090"
+	}
+
 	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
 
 	// seed.Load(server.DB)
 
-	server.Run(":8090")
+	// Ctrl-C or SIGTERM shuts the server down gracefully
+	ctx, stop := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		stop()
+	}()
+
+	server.StartJobs(ctx)
+
+	server.Run(ctx, ":8090")
 
 }
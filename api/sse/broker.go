@@ -0,0 +1,161 @@
+package sse
+
+import (
+	"sync"
+)
+
+// Message is an event sent to the streams. Labels describe it for filters,
+// e.g. {"category": "3"}.
+type Message struct {
+	ID     uint64
+	Event  string
+	Data   []byte
+	Labels map[string]string
+}
+
+// Filter matches the messages having every one of its labels
+type Filter map[string]string
+
+func (f Filter) Match(m Message) bool {
+	for k, v := range f {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Client is a stream subscribed to a broker. Messages arrive on C, which is
+// closed when the broker is closed or the client fell too far behind; it
+// should then reconnect with the ID of the last message it got.
+type Client struct {
+	C <-chan Message
+
+	c      chan Message
+	filter Filter
+}
+
+// Broker fans messages out to clients and keeps the latest ones so clients
+// that reconnect can resume where they stopped
+type Broker struct {
+	mu      sync.Mutex
+	next    uint64
+	buffer  []Message
+	size    int
+	queue   int
+	clients map[*Client]struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+// NewBroker returns a broker replaying up to size messages, and holding up
+// to queue messages for each client before dropping it
+func NewBroker(size int, queue int) *Broker {
+	return &Broker{
+		next:    1,
+		size:    size,
+		queue:   queue,
+		clients: map[*Client]struct{}{},
+		done:    make(chan struct{}),
+	}
+}
+
+// Publish numbers m and sends it to the clients it matches. A client whose
+// queue is full is dropped rather than holding up the others; it resumes
+// from the replay buffer when it reconnects.
+func (b *Broker) Publish(event string, data []byte, labels map[string]string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	m := Message{ID: b.next, Event: event, Data: data, Labels: labels}
+	b.next++
+	b.buffer = append(b.buffer, m)
+	if len(b.buffer) > b.size {
+		b.buffer = b.buffer[len(b.buffer)-b.size:]
+	}
+	for client := range b.clients {
+		if !client.filter.Match(m) {
+			continue
+		}
+		select {
+		case client.c <- m:
+		default:
+			b.drop(client)
+		}
+	}
+}
+
+// Subscribe returns a client getting the messages matching filter. With a
+// lastID, the buffered messages after it are queued first; complete is
+// false when some were already gone from the buffer, so the client missed
+// messages.
+func (b *Broker) Subscribe(filter Filter, lastID uint64) (*Client, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	replay := []Message{}
+	complete := true
+	if lastID > 0 {
+		oldest := b.next
+		if len(b.buffer) > 0 {
+			oldest = b.buffer[0].ID
+		}
+		complete = lastID+1 >= oldest && lastID < b.next
+		for _, m := range b.buffer {
+			if m.ID > lastID && filter.Match(m) {
+				replay = append(replay, m)
+			}
+		}
+	}
+
+	queue := b.queue
+	if len(replay) > queue {
+		queue = len(replay)
+	}
+	c := make(chan Message, queue)
+	for _, m := range replay {
+		c <- m
+	}
+	client := &Client{C: c, c: c, filter: filter}
+	if b.closed {
+		close(c)
+		return client, complete
+	}
+	b.clients[client] = struct{}{}
+	return client, complete
+}
+
+// Unsubscribe stops sending messages to client
+func (b *Broker) Unsubscribe(client *Client) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.drop(client)
+}
+
+func (b *Broker) drop(client *Client) {
+	if _, ok := b.clients[client]; ok {
+		delete(b.clients, client)
+		close(client.c)
+	}
+}
+
+// Done is closed when the broker is closed
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+// Close ends every stream, for a graceful shutdown
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for client := range b.clients {
+		b.drop(client)
+	}
+	close(b.done)
+}
@@ -0,0 +1,33 @@
+package sse
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Heartbeat is how often an idle stream gets a comment, so proxies and
+// clients don't take it for dead
+var Heartbeat = 15 * time.Second
+
+// WriteMessage writes m in the event stream format
+func WriteMessage(w io.Writer, m Message) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "id: %d\n", m.ID)
+	if m.Event != "" {
+		fmt.Fprintf(&buf, "event: %s\n", m.Event)
+	}
+	for _, line := range bytes.Split(m.Data, []byte("\n")) {
+		fmt.Fprintf(&buf, "data: %s\n", line)
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// WriteComment writes a comment line, ignored by clients
+func WriteComment(w io.Writer, comment string) error {
+	_, err := fmt.Fprintf(w, ": %s\n\n", comment)
+	return err
+}
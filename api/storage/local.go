@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps blobs as files under a directory, fanned out by the first
+// characters of their key: ab/cd/abcd...
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, key[:2], key[2:4], key)
+}
+
+func (l *Local) Put(key string, content io.Reader, size int64, contentType string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	path := l.path(key)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first so readers never see part of a blob
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".upload-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, content)
+	if err == nil && written != size {
+		err = fmt.Errorf("Blob Size Mismatch: wrote %d of %d bytes", written, size)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (l *Local) Open(key string) (Blob, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(l.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (l *Local) Delete(key string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(l.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
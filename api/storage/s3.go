@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// unsignedPayload leaves request bodies out of the signature, so uploads
+// can stream
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 keeps blobs in a bucket of Amazon S3 or of a compatible service such
+// as MinIO, addressed by path: endpoint/bucket/key. Requests are signed with
+// AWS Signature Version 4.
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+// NewS3 returns the store of the bucket at endpoint, e.g.
+// https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+func NewS3(endpoint, bucket, region, accessKey, secretKey string) *S3 {
+	if region == "" {
+		region = "us-east-1"
+	}
+	return &S3{
+		Endpoint:  strings.TrimRight(endpoint, "/"),
+		Bucket:    bucket,
+		Region:    region,
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		Client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (s *S3) Put(key string, content io.Reader, size int64, contentType string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	if _, err := s.head(key); err == nil {
+		return nil
+	}
+
+	req, err := s.request("PUT", key, content)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
+	res, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (s *S3) Open(key string) (Blob, error) {
+	err := checkKey(key)
+	if err != nil {
+		return nil, err
+	}
+	size, err := s.head(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Blob{store: s, key: key, size: size}, nil
+}
+
+func (s *S3) Delete(key string) error {
+	err := checkKey(key)
+	if err != nil {
+		return err
+	}
+	req, err := s.request("DELETE", key, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(req)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// head returns the size of the blob stored under key
+func (s *S3) head(key string) (int64, error) {
+	req, err := s.request("HEAD", key, nil)
+	if err != nil {
+		return 0, err
+	}
+	res, err := s.do(req)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	return res.ContentLength, nil
+}
+
+func (s *S3) request(method, key string, body io.Reader) (*http.Request, error) {
+	return http.NewRequest(method, s.Endpoint+"/"+s.Bucket+"/"+key, body)
+}
+
+// do signs and sends req. Responses other than 2xx are turned into errors.
+func (s *S3) do(req *http.Request) (*http.Response, error) {
+	s.sign(req, time.Now())
+	res, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+		res.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: %s %s", req.Method, req.URL.Path, res.Status, message)
+	}
+	return res, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (s *S3) sign(req *http.Request, now time.Time) {
+	stamp := now.UTC().Format("20060102T150405Z")
+	date := stamp[:8]
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + unsignedPayload + "\n" +
+		"x-amz-date:" + stamp + "\n"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		unsignedPayload,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	digest := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(digest[:])
+
+	key := []byte("AWS4" + s.SecretKey)
+	for _, part := range []string{date, s.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Blob reads a blob with ranged GETs, starting a new one after each seek
+type s3Blob struct {
+	store  *S3
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (b *s3Blob) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		req, err := b.store.request("GET", b.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		res, err := b.store.do(req)
+		if err != nil {
+			return 0, err
+		}
+		b.body = res.Body
+	}
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	return n, err
+}
+
+func (b *s3Blob) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek Before Start")
+	}
+	if offset != b.offset {
+		b.Close()
+		b.offset = offset
+	}
+	return offset, nil
+}
+
+func (b *s3Blob) Close() error {
+	if b.body == nil {
+		return nil
+	}
+	err := b.body.Close()
+	b.body = nil
+	return err
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+var (
+	ErrNotFound   = errors.New("Blob Not Found")
+	ErrInvalidKey = errors.New("Invalid Blob Key")
+)
+
+// Blob is the content of a stored blob. It seeks so ranges of it can be
+// served.
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// BlobStore keeps blobs under the key made from their content by Key, so
+// storing a key that is already there can be skipped and blobs never change
+type BlobStore interface {
+	// Put stores size bytes of content under key
+	Put(key string, content io.Reader, size int64, contentType string) error
+	// Open returns the blob stored under key, or ErrNotFound
+	Open(key string) (Blob, error)
+	// Delete removes the blob stored under key, if any
+	Delete(key string) error
+}
+
+// Key returns the key of content: its SHA-256 in hex
+func Key(content io.Reader) (string, error) {
+	hash := sha256.New()
+	_, err := io.Copy(hash, content)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// checkKey makes sure key is a hex SHA-256, which also keeps it safe to use
+// in paths
+func checkKey(key string) error {
+	if len(key) != sha256.Size*2 {
+		return ErrInvalidKey
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
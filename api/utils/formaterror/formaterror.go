@@ -18,6 +18,10 @@ func FormatError(err string) error {
 	if strings.Contains(err, "title") {
 		return errors.New("Title Already Taken")
 	}
+
+	if strings.Contains(err, "name") {
+		return errors.New("Name Already Taken")
+	}
 	if strings.Contains(err, "hashedPassword") {
 		return errors.New("Incorrect Password")
 	}
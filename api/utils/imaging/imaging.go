@@ -0,0 +1,112 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// MaxPixels bounds the images decoded for thumbnails, so a small file that
+// claims huge dimensions can't exhaust the memory
+const MaxPixels = 40000000
+
+// samples is how many source pixels are averaged along each side of a
+// thumbnail pixel
+const samples = 4
+
+var ErrTooLarge = errors.New("Image Too Large")
+
+// Decodable tells whether Dimensions and Thumbnail understand contentType
+func Decodable(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Dimensions returns the width and height of the image in content, reading
+// only its header
+func Dimensions(content []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// Thumbnail scales the image in content down to fit in max by max pixels,
+// and returns it as a JPEG, or a PNG when it has transparent parts. Images
+// that already fit return nil.
+func Thumbnail(content []byte, max int) ([]byte, error) {
+	width, height, err := Dimensions(content)
+	if err != nil {
+		return nil, err
+	}
+	if width <= max && height <= max {
+		return nil, nil
+	}
+	if width*height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	thumb := scale(src, max)
+
+	var buf bytes.Buffer
+	if thumb.Opaque() {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, thumb)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale shrinks src to fit in max by max pixels, keeping its aspect ratio.
+// Each pixel averages a grid of samples taken across the source pixels it
+// covers.
+func scale(src image.Image, max int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := max, max
+	if bounds.Dx() > bounds.Dy() {
+		height = bounds.Dy() * max / bounds.Dx()
+	} else {
+		width = bounds.Dx() * max / bounds.Dy()
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	xScale := float64(bounds.Dx()) / float64(width)
+	yScale := float64(bounds.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b, a uint64
+			for sy := 0; sy < samples; sy++ {
+				srcY := bounds.Min.Y + int((float64(y)+(float64(sy)+0.5)/samples)*yScale)
+				for sx := 0; sx < samples; sx++ {
+					srcX := bounds.Min.X + int((float64(x)+(float64(sx)+0.5)/samples)*xScale)
+					pr, pg, pb, pa := src.At(srcX, srcY).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+				}
+			}
+			n := uint64(samples * samples)
+			dst.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(b / n), A: uint16(a / n)})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,84 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+// renderer speaks CommonMark plus the GitHub tables, strikethrough and
+// autolinks. Table alignment is written as align attributes, since the
+// policy drops style attributes.
+var renderer = goldmark.New(goldmark.WithExtensions(
+	extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+	extension.Strikethrough,
+	extension.Linkify,
+))
+
+// policy is the allowlist of what rendered Markdown may contain: text
+// formatting, headings, lists, quotes, tables, code blocks, links and images.
+// Raw HTML in the source is dropped by the renderer before it gets here.
+var policy = newPolicy()
+
+// text strips every tag, for excerpts
+var text = bluemonday.StrictPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "hr", "em", "strong", "del", "blockquote", "ul", "ol", "li", "pre", "code")
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowElements("table", "thead", "tbody", "tr", "th", "td")
+	p.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	p.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	p.AllowStandardURLs()
+	p.AllowAttrs("href", "title").OnElements("a")
+	p.RequireNoFollowOnLinks(true)
+	p.AllowAttrs("src", "alt", "title").OnElements("img")
+	return p
+}
+
+// Render turns Markdown into HTML that is safe to embed in a page
+func Render(source string) (string, error) {
+	var buf bytes.Buffer
+	err := renderer.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+var blockTag = regexp.MustCompile(`(?i)</?(p|br|hr|li|h[1-6]|blockquote|pre|table|thead|tbody|tr|th|td|ul|ol)\b`)
+
+// PlainText returns the text of rendered HTML on a single line
+func PlainText(rendered string) string {
+	// Block tags become spaces so paragraphs don't run into each other
+	plain := html.UnescapeString(text.Sanitize(blockTag.ReplaceAllString(rendered, " $0")))
+	return strings.Join(strings.Fields(plain), " ")
+}
+
+// Excerpt returns the plain text of rendered HTML, cut after at most max
+// characters at a word boundary
+func Excerpt(rendered string, max int) string {
+	plain := PlainText(rendered)
+
+	runes := []rune(plain)
+	if len(runes) <= max {
+		return plain
+	}
+	cut := max
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 {
+		cut = max
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsPunct) + "…"
+}
@@ -0,0 +1,105 @@
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// transliterations spells out letters that have no ASCII base letter to
+// fall back to
+var transliterations = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "ae", 'ø': "o", 'Ø': "o", 'œ': "oe", 'Œ': "oe",
+	'đ': "d", 'Đ': "d", 'ð': "d", 'Ð': "d", 'þ': "th", 'Þ': "th", 'ł': "l", 'Ł': "l",
+	'ı': "i",
+}
+
+// latin maps accented Latin letters to their base letter
+var latin = map[string]string{
+	"a": "àáâãäåāăą",
+	"c": "çćĉċč",
+	"d": "ď",
+	"e": "èéêëēĕėęě",
+	"g": "ĝğġģ",
+	"h": "ĥħ",
+	"i": "ìíîïĩīĭįİ",
+	"j": "ĵ",
+	"k": "ķ",
+	"l": "ĺļľŀ",
+	"n": "ñńņňŉ",
+	"o": "òóôõöōŏő",
+	"r": "ŕŗř",
+	"s": "śŝşšș",
+	"t": "ţťŧț",
+	"u": "ùúûüũūŭůűų",
+	"w": "ŵ",
+	"y": "ýÿŷ",
+	"z": "źżž",
+}
+
+// alphabets spells out Cyrillic and Greek letters, lowercase only
+var alphabets = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+}
+
+func init() {
+	for base, letters := range latin {
+		for _, letter := range letters {
+			transliterations[letter] = base
+			transliterations[unicode.ToUpper(letter)] = base
+		}
+	}
+	for letter, spelling := range alphabets {
+		transliterations[letter] = spelling
+		transliterations[unicode.ToUpper(letter)] = spelling
+	}
+}
+
+// Make turns s into a lowercase, URL safe slug such as "hello-world".
+// Accented Latin, Cyrillic and Greek letters are transliterated to ASCII,
+// other letters and digits are kept as they are, and everything else
+// becomes a single dash.
+func Make(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		if t, ok := transliterations[r]; ok {
+			if t == "" {
+				continue
+			}
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(t)
+			dash = false
+			continue
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// Truncate shortens slug to at most max letters without leaving a dash at
+// the end
+func Truncate(slug string, max int) string {
+	runes := []rune(slug)
+	if len(runes) <= max {
+		return slug
+	}
+	return strings.TrimRight(string(runes[:max]), "-")
+}
@@ -1,13 +1,32 @@
 module github.com/rizalreza/golang-restful
 
-go 1.15
+go 1.24.0
 
 require (
 	github.com/badoux/checkmail v1.2.1
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/graphql-go/graphql v0.8.1
 	github.com/jinzhu/gorm v1.9.16
 	github.com/joho/godotenv v1.3.0
-	golang.org/x/crypto v0.0.0-20201002170205-7f63de1d35b0
-	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/swaggo/files/v2 v2.0.2
+	github.com/yuin/goldmark v1.4.13
+	golang.org/x/crypto v0.46.0
+	google.golang.org/grpc v1.79.1
+	google.golang.org/protobuf v1.36.10
+	gopkg.in/go-playground/assert.v1 v1.2.1
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/go-sql-driver/mysql v1.5.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/mattn/go-sqlite3 v1.14.16 // indirect
+	golang.org/x/net v0.48.0 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20251202230838-ff82c1b0f217 // indirect
 )
@@ -0,0 +1,191 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type batchBody struct {
+	Mode    string `json:"mode"`
+	Error   string `json:"error"`
+	Results []struct {
+		Index  int    `json:"index"`
+		Status int    `json:"status"`
+		ID     uint64 `json:"id"`
+		Error  string `json:"error"`
+	} `json:"results"`
+}
+
+func (b batchBody) statuses() []int {
+	statuses := []int{}
+	for _, result := range b.Results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func TestBatch(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	anna := models.User{Username: "anna", Email: "anna@gmail.com", Password: "password"}
+	err = server.DB.Create(&anna).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	batch := func(path string, token string, body string) (int, batchBody) {
+		req, err := http.NewRequest("POST", path, strings.NewReader(body))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		result := batchBody{}
+		json.Unmarshal(rr.Body.Bytes(), &result)
+		return rr.Code, result
+	}
+	count := func(model interface{}) int {
+		n := 0
+		server.DB.Model(model).Count(&n)
+		return n
+	}
+
+	// Every item saved together
+	code, result := batch("/posts:batch", token, fmt.Sprintf(`{"items": [
+		{"title": "Imported 1", "content": "One", "category_id": %d, "status": "published", "tags": ["Go"]},
+		{"action": "create", "title": "Imported 2", "content": "Two", "category_id": %d},
+		{"action": "update", "id": %d, "title": "Updated", "content": "Changed", "category_id": %d}
+	]}`, post.CategoryID, post.CategoryID, post.ID, post.CategoryID))
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.Mode, "all_or_nothing")
+	assert.Equal(t, result.statuses(), []int{201, 201, 200})
+	assert.Equal(t, result.Results[2].ID, post.ID)
+	imported := models.Post{}
+	err = server.DB.Preload("Tags").Where("id = ?", result.Results[0].ID).Take(&imported).Error
+	assert.Equal(t, err, nil)
+	assert.Equal(t, imported.AuthorID, post.AuthorID)
+	assert.Equal(t, imported.Status, models.PostPublished)
+	assert.Equal(t, imported.Tags[0].Name, "go")
+	assert.Equal(t, count(&models.Post{}), 3)
+
+	// Events are only told once the transaction is committed
+	told := []string{}
+	unsubscribe := server.Events.Subscribe(func(e events.Event) {
+		told = append(told, e.Type)
+	})
+	defer unsubscribe()
+
+	// One item failing rolls every other back, each error told at its index
+	code, result = batch("/posts:batch", token, fmt.Sprintf(`{"mode": "all_or_nothing", "items": [
+		{"title": "Rolled back", "content": "Gone", "category_id": %d},
+		{"title": "", "content": "No title", "category_id": %d},
+		{"action": "delete", "id": %d},
+		{"title": "Nowhere", "content": "Gone", "category_id": 999}
+	]}`, post.CategoryID, post.CategoryID, result.Results[1].ID))
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, result.statuses(), []int{424, 422, 424, 404})
+	assert.Equal(t, result.Results[1].Error, "Required Title")
+	assert.Equal(t, result.Results[0].ID, uint64(0))
+	assert.Equal(t, count(&models.Post{}), 3)
+	assert.Equal(t, len(told), 0)
+
+	// Items of a partial batch stand on their own
+	code, result = batch("/posts:batch", token, fmt.Sprintf(`{"mode": "partial", "items": [
+		{"title": "Kept", "content": "Here", "category_id": %d},
+		{"title": 5},
+		{"action": "move", "id": %d},
+		{"action": "delete", "id": 999},
+		{"action": "delete", "id": %d}
+	]}`, post.CategoryID, post.ID, post.ID))
+	assert.Equal(t, code, http.StatusMultiStatus)
+	assert.Equal(t, result.statuses(), []int{201, 422, 422, 404, 204})
+	assert.Equal(t, strings.HasPrefix(result.Results[1].Error, "Invalid item"), true)
+	assert.Equal(t, result.Results[2].Error, "Unknown action: move, expected create, update or delete")
+	assert.Equal(t, result.Results[4].ID, post.ID)
+	assert.Equal(t, count(&models.Post{}), 3)
+	assert.Equal(t, told, []string{events.PostCreated, events.PostDeleted})
+
+	// Posts of others are theirs
+	annas := models.Post{Title: "Anna's", Content: "Mine", AuthorID: anna.ID, CategoryID: post.CategoryID}
+	err = server.DB.Create(&annas).Error
+	if err != nil {
+		log.Fatalf("cannot seed posts: %v", err)
+	}
+	code, result = batch("/posts:batch", token, fmt.Sprintf(`{"mode": "partial", "items": [{"action": "delete", "id": %d}]}`, annas.ID))
+	assert.Equal(t, code, http.StatusMultiStatus)
+	assert.Equal(t, result.statuses(), []int{401})
+
+	// Batches themselves are checked before any item
+	code, _ = batch("/posts:batch", "", `{"items": [{"title": "Anonymous"}]}`)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	for _, tc := range []struct {
+		body  string
+		code  int
+		error string
+	}{
+		{`not json`, http.StatusBadRequest, "Invalid batch, expected a JSON body with mode and items"},
+		{`{"mode": "some", "items": [{}]}`, http.StatusBadRequest, "mode must be all_or_nothing or partial"},
+		{`{"items": []}`, http.StatusUnprocessableEntity, "Required items"},
+		{`{"items": [` + strings.Repeat(`{},`, 500) + `{}]}`, http.StatusRequestEntityTooLarge, "Batch Too Large, the limit is 500 items"},
+	} {
+		code, result = batch("/posts:batch", token, tc.body)
+		assert.Equal(t, code, tc.code)
+		assert.Equal(t, result.Error, tc.error)
+	}
+
+	// Anyone may create categories, but changing them needs a token
+	code, result = batch("/category:batch", "", fmt.Sprintf(`{"items": [
+		{"name": "Imported"},
+		{"name": "Nested", "parent_id": %d}
+	]}`, post.CategoryID))
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.statuses(), []int{201, 201})
+	nested := uint32(result.Results[1].ID)
+	category := models.Category{}
+	server.DB.Where("id = ?", nested).Take(&category)
+	assert.Equal(t, *category.ParentID, post.CategoryID)
+
+	update := fmt.Sprintf(`{"mode": "partial", "items": [
+		{"action": "update", "id": %d, "name": "Root", "parent_id": 0},
+		{"action": "delete", "id": %d}
+	]}`, nested, result.Results[0].ID)
+	code, result = batch("/category:batch", "", update)
+	assert.Equal(t, code, http.StatusMultiStatus)
+	assert.Equal(t, result.statuses(), []int{401, 401})
+	code, result = batch("/category:batch", token, update)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.statuses(), []int{200, 204})
+	category = models.Category{}
+	server.DB.Where("id = ?", nested).Take(&category)
+	assert.Equal(t, category.Name, "Root")
+	assert.Equal(t, category.ParentID, (*uint32)(nil))
+
+	categories := count(&models.Category{})
+	code, result = batch("/category:batch", token, `{"items": [
+		{"name": "Rolled back"},
+		{"name": "Orphan", "parent_id": 999}
+	]}`)
+	assert.Equal(t, code, http.StatusUnprocessableEntity)
+	assert.Equal(t, result.statuses(), []int{424, 422})
+	assert.Equal(t, count(&models.Category{}), categories)
+}
@@ -0,0 +1,139 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestCommentRules(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, user := range []models.User{
+		{Username: "anna", Email: "anna@gmail.com", Password: "password"},
+		{Username: "mike", Email: "mike@gmail.com", Password: "password"},
+		{Username: "mod", Email: "mod@gmail.com", Password: "password", Role: models.RoleModerator},
+	} {
+		err = server.DB.Create(&user).Error
+		if err != nil {
+			log.Fatalf("cannot seed users: %v", err)
+		}
+	}
+	// Only anna's account is new
+	err = server.DB.Model(&models.User{}).Where("username <> ?", "anna").UpdateColumn("created_at", time.Now().Add(-2*models.NewAccountAge)).Error
+	if err != nil {
+		log.Fatalf("cannot age users: %v", err)
+	}
+	tokens := map[string]string{}
+	for _, name := range []string{"john", "anna", "mike", "mod"} {
+		tokens[name], err = server.SignIn(name+"@gmail.com", "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+	}
+
+	send := func(name string, method string, path string, form url.Values) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if name != "" {
+			req.Header.Set("Authorization", "Bearer "+tokens[name])
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		body := map[string]interface{}{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+	comments := fmt.Sprintf("/api/v1/posts/%d/comments", post.ID)
+	comment := func(id interface{}) string {
+		return fmt.Sprintf("/api/v1/comments/%v", id)
+	}
+
+	// Comments of new accounts wait for a moderator, and so do their edits
+	code, annas := send("anna", "POST", comments, url.Values{"body": {"Hello"}})
+	assert.Equal(t, code, http.StatusCreated)
+	assert.Equal(t, annas["status"], models.CommentPending)
+	code, annas = send("mod", "POST", comment(annas["id"])+"/approve", nil)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, annas["status"], models.CommentApproved)
+	code, annas = send("anna", "PUT", comment(annas["id"]), url.Values{"body": {"Buy my stuff"}})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, annas["status"], models.CommentPending)
+
+	// Older accounts keep their comments published, but a rejected comment
+	// goes back to the moderators
+	code, mikes := send("mike", "POST", comments, url.Values{"body": {"Nice post"}})
+	assert.Equal(t, code, http.StatusCreated)
+	assert.Equal(t, mikes["status"], models.CommentApproved)
+	code, mikes = send("mike", "PUT", comment(mikes["id"]), url.Values{"body": {"Very nice post"}})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, mikes["status"], models.CommentApproved)
+	code, rejected := send("mike", "POST", comments, url.Values{"body": {"Rude"}})
+	assert.Equal(t, code, http.StatusCreated)
+	err = server.DB.Model(&models.Comment{}).Where("id = ?", rejected["id"]).UpdateColumn("status", models.CommentRejected).Error
+	if err != nil {
+		log.Fatalf("cannot reject comment: %v", err)
+	}
+	code, rejected = send("mike", "PUT", comment(rejected["id"]), url.Values{"body": {"Polite"}})
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, rejected["status"], models.CommentPending)
+
+	// Only the author edits a comment, not the post author nor moderators
+	for _, name := range []string{"", "anna", "john", "mod"} {
+		code, _ = send(name, "PUT", comment(mikes["id"]), url.Values{"body": {"Edited by " + name}})
+		assert.Equal(t, code, http.StatusUnauthorized)
+	}
+
+	// The author, the post author and moderators delete a comment, others
+	// don't
+	for _, name := range []string{"", "anna"} {
+		code, _ = send(name, "DELETE", comment(mikes["id"]), nil)
+		assert.Equal(t, code, http.StatusUnauthorized)
+	}
+	code, _ = send("john", "DELETE", comment(annas["id"]), nil)
+	assert.Equal(t, code, http.StatusNoContent)
+	code, _ = send("mike", "DELETE", comment(rejected["id"]), nil)
+	assert.Equal(t, code, http.StatusNoContent)
+	code, reply := send("john", "POST", comments, url.Values{"body": {"Thanks"}, "parent_id": {fmt.Sprint(mikes["id"])}})
+	assert.Equal(t, code, http.StatusCreated)
+	code, _ = send("mod", "DELETE", comment(mikes["id"]), nil)
+	assert.Equal(t, code, http.StatusNoContent)
+	code, _ = send("mike", "PUT", comment(mikes["id"]), url.Values{"body": {"Back"}})
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// The placeholder kept for the reply doesn't tell who wrote the comment
+	req, err := http.NewRequest("GET", comments, nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+	threads := []map[string]interface{}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &threads)
+	if err != nil {
+		t.Fatalf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, len(threads), 1)
+	assert.Equal(t, threads[0]["status"], models.CommentDeleted)
+	assert.Equal(t, threads[0]["author_id"], float64(0))
+	_, ok := threads[0]["author"]
+	assert.Equal(t, ok, false)
+	replies := threads[0]["replies"].([]interface{})
+	assert.Equal(t, replies[0].(map[string]interface{})["id"], reply["id"])
+}
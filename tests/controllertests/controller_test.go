@@ -64,7 +64,7 @@ func refreshUserTable() error {
 		return err
 	}
 	server.DB.Exec("SET foreign_key_checks=1")
-	err = server.DB.Debug().AutoMigrate(&models.User{}).Error
+	err = server.DB.Debug().AutoMigrate(&models.User{}, &models.Post{}).Error
 	if err != nil {
 		return err
 	}
@@ -80,7 +80,7 @@ func refreshCategoryTable() error {
 	}
 
 	server.DB.Exec("SET foreign_key_checks=1")
-	err = server.DB.AutoMigrate(&models.Category{}).Error
+	err = server.DB.AutoMigrate(&models.Category{}, &models.Post{}).Error
 	if err != nil {
 		return err
 	}
@@ -155,13 +155,13 @@ func seedUsers() ([]models.User, error) {
 
 func refreshUserCategoryAndPostTable() error {
 	server.DB.Exec("SET foreign_key_checks=0")
-	err := server.DB.Debug().DropTableIfExists(&models.Post{}, &models.Category{}, &models.User{}).Error
+	err := server.DB.Debug().DropTableIfExists(models.AllTables()...).Error
 	if err != nil {
 		return err
 	}
 
 	server.DB.Exec("SET foreign_key_checks=1")
-	err = server.DB.Debug().AutoMigrate(&models.User{}, &models.Category{}, &models.Post{}).Error
+	err = server.DB.Debug().AutoMigrate(models.All()...).Error
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,147 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type feedPage struct {
+	Data []models.Post          `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
+func TestFollowAndFeed(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = seedUsers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	users, categories, _, err := SeedUsersCategoriesAndPosts()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mike, shinoda := users[0], users[1]
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	// Two posts published in the same second, an older one and a draft
+	published := time.Now().Add(-time.Hour).Truncate(time.Second)
+	older := published.Add(-time.Minute)
+	for _, post := range []models.Post{
+		{Title: "Tie A", Content: "a", AuthorID: mike.ID, CategoryID: categories[0].ID, Status: models.PostPublished, PublishedAt: &published},
+		{Title: "Tie B", Content: "b", AuthorID: mike.ID, CategoryID: categories[0].ID, Status: models.PostPublished, PublishedAt: &published},
+		{Title: "Older", Content: "c", AuthorID: shinoda.ID, CategoryID: categories[1].ID, Status: models.PostPublished, PublishedAt: &older},
+		{Title: "Draft", Content: "d", AuthorID: mike.ID, CategoryID: categories[0].ID, Status: models.PostDraft},
+	} {
+		err = server.DB.Create(&post).Error
+		if err != nil {
+			log.Fatalf("cannot seed posts: %v", err)
+		}
+	}
+
+	samples := []struct {
+		method     string
+		url        string
+		statusCode int
+	}{
+		{method: "POST", url: fmt.Sprintf("/api/v1/users/%d/follow", mike.ID), statusCode: 204},
+		{method: "POST", url: fmt.Sprintf("/api/v1/users/%d/follow", mike.ID), statusCode: 204},
+		{method: "POST", url: "/api/v1/users/1/follow", statusCode: 422},
+		{method: "POST", url: "/api/v1/users/99/follow", statusCode: 404},
+		{method: "POST", url: fmt.Sprintf("/api/v1/category/%d/follow", categories[1].ID), statusCode: 204},
+		{method: "POST", url: "/api/v1/category/99/follow", statusCode: 404},
+		{method: "GET", url: "/api/v1/feed?cursor=nope", statusCode: 400},
+	}
+	for _, v := range samples {
+		req, err := http.NewRequest(v.method, v.url, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.statusCode)
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/users/%d/followers", mike.ID), nil)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	followers := struct {
+		Data []map[string]interface{} `json:"data"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &followers)
+	if err != nil {
+		t.Errorf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, len(followers.Data), 1)
+	assert.Equal(t, followers.Data[0]["username"], "john")
+
+	// Pages follow each other without gaps or repeats, even when a post is
+	// published between them
+	titles := []string{}
+	url := "/api/v1/feed?limit=2"
+	for page := 0; url != "" && page < 5; page++ {
+		req, _ := http.NewRequest("GET", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, 200)
+
+		feed := feedPage{}
+		err = json.Unmarshal(rr.Body.Bytes(), &feed)
+		if err != nil {
+			t.Errorf("Cannot convert to json: %v", err)
+		}
+		for _, post := range feed.Data {
+			titles = append(titles, post.Title)
+		}
+		url = ""
+		if next, ok := feed.Meta["next_cursor"].(string); ok {
+			url = "/api/v1/feed?limit=2&cursor=" + next
+		}
+
+		if page == 0 {
+			fresh := models.Post{Title: "Fresh", Content: "e", AuthorID: mike.ID, CategoryID: categories[0].ID}
+			err = server.DB.Create(&fresh).Error
+			if err != nil {
+				log.Fatalf("cannot seed posts: %v", err)
+			}
+		}
+	}
+	assert.Equal(t, titles, []string{"Second Title", "First Title", "Tie B", "Tie A", "Older"})
+
+	// Unfollowing the author leaves the posts of the followed category
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/v1/users/%d/follow", mike.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 204)
+
+	req, _ = http.NewRequest("GET", "/api/v1/feed", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	feed := feedPage{}
+	err = json.Unmarshal(rr.Body.Bytes(), &feed)
+	if err != nil {
+		t.Errorf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, len(feed.Data), 2)
+	assert.Equal(t, feed.Data[0].Title, "Second Title")
+	assert.Equal(t, feed.Data[1].Title, "Older")
+	assert.Equal(t, feed.Meta["next_cursor"], nil)
+}
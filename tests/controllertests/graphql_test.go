@@ -0,0 +1,288 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/controllers"
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type queryCounter struct {
+	count int
+}
+
+func (c *queryCounter) Print(values ...interface{}) {
+	if len(values) > 0 && values[0] == "sql" {
+		c.count++
+	}
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string                 `json:"message"`
+		Extensions map[string]interface{} `json:"extensions"`
+	} `json:"errors"`
+}
+
+type graphqlPost struct {
+	ID     string `json:"id"`
+	Title  string `json:"title"`
+	Status string `json:"status"`
+	Author struct {
+		Username string  `json:"username"`
+		Email    *string `json:"email"`
+	} `json:"author"`
+	Category struct {
+		Name     string                  `json:"name"`
+		Parent   *struct{ Name string }  `json:"parent"`
+		Children []struct{ Name string } `json:"children"`
+	} `json:"category"`
+	Tags []struct{ Name string } `json:"tags"`
+}
+
+type graphqlPosts struct {
+	Edges []struct {
+		Cursor string      `json:"cursor"`
+		Node   graphqlPost `json:"node"`
+	} `json:"edges"`
+	PageInfo struct {
+		HasNextPage bool    `json:"hasNextPage"`
+		EndCursor   *string `json:"endCursor"`
+	} `json:"pageInfo"`
+}
+
+// parseID reads the id of a GraphQL object
+func parseID(t *testing.T, id string) uint32 {
+	parsed, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		t.Fatalf("cannot parse id: %v", err)
+	}
+	return uint32(parsed)
+}
+
+// runGraphQL posts query to handler and decodes what it answers, with the
+// data in data when given
+func runGraphQL(t *testing.T, handler http.Handler, token, query string, variables map[string]interface{}, data interface{}) (int, graphqlResponse) {
+	body, _ := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	req, _ := http.NewRequest("POST", "/api/v1/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	res := graphqlResponse{}
+	err := json.Unmarshal(rr.Body.Bytes(), &res)
+	if err != nil {
+		t.Fatalf("cannot convert to json: %v", err)
+	}
+	if data != nil && len(res.Data) > 0 {
+		err = json.Unmarshal(res.Data, data)
+		if err != nil {
+			t.Fatalf("cannot convert data: %v", err)
+		}
+	}
+	return rr.Code, res
+}
+
+func TestGraphQL(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	anna := models.User{Username: "anna", Email: "anna@gmail.com", Password: "password"}
+	err = server.DB.Create(&anna).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	child := models.Category{Name: "Child", ParentID: &post.CategoryID}
+	err = server.DB.Create(&child).Error
+	if err != nil {
+		log.Fatalf("cannot seed categories: %v", err)
+	}
+	tags, err := models.FindOrCreateTags(server.DB, []string{"go"})
+	if err != nil {
+		log.Fatalf("cannot seed tags: %v", err)
+	}
+	for _, seeded := range []models.Post{
+		{Title: "Anna's", Content: "a", AuthorID: anna.ID, CategoryID: child.ID, Status: models.PostPublished, Tags: tags},
+		{Title: "Draft", Content: "d", AuthorID: post.AuthorID, CategoryID: post.CategoryID, Status: models.PostDraft},
+	} {
+		err = server.DB.Create(&seeded).Error
+		if err != nil {
+			log.Fatalf("cannot seed posts: %v", err)
+		}
+	}
+	tokens := map[string]string{}
+	for _, name := range []string{"john", "anna"} {
+		tokens[name], err = server.SignIn(name+"@gmail.com", "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+	}
+
+	// A server counting its queries
+	counter := &queryCounter{}
+	counted := &controllers.Server{DB: server.DB.New()}
+	counted.DB.SetLogger(counter)
+	counted.InitializeRouter()
+
+	// The associations of a page are loaded once for all its posts
+	page := struct{ Posts graphqlPosts }{}
+	code, res := runGraphQL(t, counted.Router, "", `{
+		posts {
+			edges { cursor node { id title author { username email } category { name parent { name } children { name } } tags { name } } }
+			pageInfo { hasNextPage endCursor }
+		}
+	}`, nil, &page)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(res.Errors), 0)
+	assert.Equal(t, counter.count, 6)
+	assert.Equal(t, len(page.Posts.Edges), 2)
+	newest := page.Posts.Edges[0].Node
+	assert.Equal(t, newest.Title, "Anna's")
+	assert.Equal(t, newest.Author.Username, "anna")
+	assert.Equal(t, newest.Author.Email, (*string)(nil))
+	assert.Equal(t, newest.Category.Parent.Name, "Category Test 1")
+	assert.Equal(t, newest.Tags[0].Name, "go")
+	oldest := page.Posts.Edges[1].Node
+	assert.Equal(t, oldest.Author.Username, "john")
+	assert.Equal(t, oldest.Category.Parent, (*struct{ Name string })(nil))
+	assert.Equal(t, oldest.Category.Children[0].Name, "Child")
+	assert.Equal(t, len(oldest.Tags), 0)
+	assert.Equal(t, page.Posts.PageInfo.HasNextPage, false)
+
+	// Pages go on from the end cursor of the previous one
+	query := `query($after: String) { posts(first: 1, after: $after) { edges { node { title } } pageInfo { hasNextPage endCursor } } }`
+	runGraphQL(t, server.Router, "", query, nil, &page)
+	assert.Equal(t, page.Posts.Edges[0].Node.Title, "Anna's")
+	assert.Equal(t, page.Posts.PageInfo.HasNextPage, true)
+	runGraphQL(t, server.Router, "", query, map[string]interface{}{"after": *page.Posts.PageInfo.EndCursor}, &page)
+	assert.Equal(t, page.Posts.Edges[0].Node.Title, post.Title)
+	assert.Equal(t, page.Posts.PageInfo.HasNextPage, false)
+
+	// Users see their email and their drafts
+	viewer := struct {
+		Viewer struct {
+			Username string
+			Email    *string
+			Posts    graphqlPosts
+		}
+	}{}
+	runGraphQL(t, server.Router, tokens["john"], `{ viewer { username email posts { edges { node { title status } } } } }`, nil, &viewer)
+	assert.Equal(t, *viewer.Viewer.Email, "john@gmail.com")
+	assert.Equal(t, len(viewer.Viewer.Posts.Edges), 2)
+	assert.Equal(t, viewer.Viewer.Posts.Edges[0].Node.Status, models.PostDraft)
+	one := struct{ Post *graphqlPost }{}
+	code, _ = runGraphQL(t, server.Router, tokens["anna"], `{ post(slug: "draft") { title } }`, nil, &one)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, one.Post, (*graphqlPost)(nil))
+
+	// Mutations go through the checks of the REST API
+	createPost := `mutation($input: PostInput!) { createPost(input: $input) { id title status author { username } tags { name } } }`
+	input := map[string]interface{}{"title": "From GraphQL", "content": "Hello", "categoryId": post.CategoryID, "tags": []string{"Go", "graphql"}}
+	_, res = runGraphQL(t, server.Router, "", createPost, map[string]interface{}{"input": input}, nil)
+	assert.Equal(t, res.Errors[0].Message, "Unauthorized")
+	assert.Equal(t, res.Errors[0].Extensions["status"], float64(http.StatusUnauthorized))
+	created := struct{ CreatePost graphqlPost }{}
+	_, res = runGraphQL(t, server.Router, tokens["anna"], createPost, map[string]interface{}{"input": input}, &created)
+	assert.Equal(t, len(res.Errors), 0)
+	assert.Equal(t, created.CreatePost.Title, "From GraphQL")
+	assert.Equal(t, created.CreatePost.Status, models.PostDraft)
+	assert.Equal(t, created.CreatePost.Author.Username, "anna")
+	assert.Equal(t, len(created.CreatePost.Tags), 2)
+
+	updatePost := `mutation($id: ID!, $input: PostInput!) { updatePost(id: $id, input: $input) { title } }`
+	input["title"] = "Edited"
+	_, res = runGraphQL(t, server.Router, tokens["john"], updatePost, map[string]interface{}{"id": created.CreatePost.ID, "input": input}, nil)
+	assert.Equal(t, res.Errors[0].Extensions["status"], float64(http.StatusUnauthorized))
+	updated := struct{ UpdatePost graphqlPost }{}
+	runGraphQL(t, server.Router, tokens["anna"], updatePost, map[string]interface{}{"id": created.CreatePost.ID, "input": input}, &updated)
+	assert.Equal(t, updated.UpdatePost.Title, "Edited")
+	deleted := struct{ DeletePost bool }{}
+	runGraphQL(t, server.Router, tokens["anna"], `mutation($id: ID!) { deletePost(id: $id) }`, map[string]interface{}{"id": created.CreatePost.ID}, &deleted)
+	assert.Equal(t, deleted.DeletePost, true)
+
+	category := struct {
+		CreateCategory struct {
+			ID     string
+			Parent struct{ Name string }
+		}
+	}{}
+	runGraphQL(t, server.Router, "", `mutation { createCategory(input: {name: "Nested", parentId: 2}) { id parent { name } } }`, nil, &category)
+	assert.Equal(t, category.CreateCategory.Parent.Name, "Child")
+	_, res = runGraphQL(t, server.Router, "", `mutation($id: ID!) { deleteCategory(id: $id) }`, map[string]interface{}{"id": category.CreateCategory.ID}, nil)
+	assert.Equal(t, res.Errors[0].Extensions["status"], float64(http.StatusUnauthorized))
+
+	user := struct {
+		UpdateUser struct {
+			Username string
+			Email    string
+		}
+	}{}
+	updateUser := `mutation($id: ID!) { updateUser(id: $id, input: {username: "annie", email: "annie@gmail.com", password: "password"}) { username email } }`
+	_, res = runGraphQL(t, server.Router, tokens["john"], updateUser, map[string]interface{}{"id": anna.ID}, nil)
+	assert.Equal(t, res.Errors[0].Extensions["status"], float64(http.StatusUnauthorized))
+	runGraphQL(t, server.Router, tokens["anna"], updateUser, map[string]interface{}{"id": anna.ID}, &user)
+	assert.Equal(t, user.UpdateUser.Username, "annie")
+	assert.Equal(t, user.UpdateUser.Email, "annie@gmail.com")
+
+	// GET only runs queries, so a link carrying a token can't change data
+	document := `query Categories { categories { edges { node { id } } } } mutation Delete($id: ID!) { deleteCategory(id: $id) }`
+	get := func(operationName string) (int, string) {
+		params := url.Values{"query": {document}, "operationName": {operationName}, "token": {tokens["john"]}}
+		params.Set("variables", fmt.Sprintf(`{"id": %q}`, category.CreateCategory.ID))
+		req, _ := http.NewRequest("GET", "/api/v1/graphql?"+params.Encode(), nil)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr.Code, rr.Header().Get("Allow")
+	}
+	code, allow := get("Delete")
+	assert.Equal(t, code, http.StatusMethodNotAllowed)
+	assert.Equal(t, allow, http.MethodPost)
+	code, _ = get("Categories")
+	assert.Equal(t, code, http.StatusOK)
+	found, err := (&models.Category{}).FindCategoryById(server.DB, parseID(t, category.CreateCategory.ID))
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.Name, "Nested")
+
+	// Queries too deep or too costly are turned down before they run
+	samples := []struct {
+		query   string
+		message string
+	}{
+		{
+			query:   `{ posts { edges { node { author { posts { edges { node { category { posts { edges { node { title } } } } } } } } } } } }`,
+			message: "Query is nested 12 levels deep, more than the 10 allowed",
+		},
+		{
+			query:   `{ users(first: 100) { edges { node { posts(first: 100) { edges { node { title } } } } } } }`,
+			message: "Query has a complexity over 5000",
+		},
+		{
+			query:   `{ posts { edges { node { nope } } } }`,
+			message: `Cannot query field "nope" on type "Post".`,
+		},
+		{
+			query:   `{ posts {`,
+			message: "Syntax Error GraphQL request (1:10) Expected Name, found EOF\n\n1: { posts {\n            ^\n",
+		},
+	}
+	for _, v := range samples {
+		code, res := runGraphQL(t, server.Router, "", v.query, nil, nil)
+		assert.Equal(t, code, http.StatusBadRequest)
+		assert.Equal(t, res.Errors[0].Message, v.message)
+	}
+}
@@ -0,0 +1,172 @@
+package controllertests
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/rpc/blogpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// withToken returns ctx carrying token as the call credentials
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+func TestGRPC(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	anna := models.User{Username: "anna", Email: "anna@gmail.com", Password: "password"}
+	err = server.DB.Create(&anna).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	tokens := map[string]string{}
+	for _, name := range []string{"john", "anna"} {
+		tokens[name], err = server.SignIn(name+"@gmail.com", "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+	}
+
+	lis := bufconn.Listen(1 << 20)
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ServeGRPC(ctx, lis)
+	}()
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("cannot dial: %v", err)
+	}
+	defer conn.Close()
+	users := blogpb.NewUserServiceClient(conn)
+	posts := blogpb.NewPostServiceClient(conn)
+	categories := blogpb.NewCategoryServiceClient(conn)
+	background := context.Background()
+	john, annas := withToken(background, tokens["john"]), withToken(background, tokens["anna"])
+
+	// Errors of the shared logic keep their meaning
+	_, err = users.CreateUser(background, &blogpb.CreateUserRequest{Username: "mike", Password: "password"})
+	assert.Equal(t, status.Code(err), codes.InvalidArgument)
+	assert.Equal(t, status.Convert(err).Message(), "Required Email")
+	mike, err := users.CreateUser(background, &blogpb.CreateUserRequest{Username: "mike", Email: "mike@gmail.com", Password: "password"})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, mike.Email, "mike@gmail.com")
+	_, err = users.GetUser(background, &blogpb.GetUserRequest{Id: 999})
+	assert.Equal(t, status.Code(err), codes.NotFound)
+
+	// Emails are only shown to their user
+	user, err := users.GetUser(background, &blogpb.GetUserRequest{Id: post.AuthorID})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, user.Username, "john")
+	assert.Equal(t, user.Email, "")
+	user, _ = users.GetUser(john, &blogpb.GetUserRequest{Id: post.AuthorID})
+	assert.Equal(t, user.Email, "john@gmail.com")
+
+	page, err := users.ListUsers(background, &blogpb.ListUsersRequest{PageSize: 2})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(page.Users), 2)
+	assert.NotEqual(t, page.NextPageToken, "")
+	page, _ = users.ListUsers(background, &blogpb.ListUsersRequest{PageSize: 2, PageToken: page.NextPageToken})
+	assert.Equal(t, len(page.Users), 1)
+	assert.Equal(t, page.Users[0].Username, "mike")
+	assert.Equal(t, page.NextPageToken, "")
+	_, err = users.ListUsers(background, &blogpb.ListUsersRequest{PageToken: "nope"})
+	assert.Equal(t, status.Code(err), codes.InvalidArgument)
+
+	// Calls changing what users own need their token
+	create := &blogpb.CreatePostRequest{Title: "Over gRPC", Content: "Hello", CategoryId: post.CategoryID, Tags: &blogpb.TagNames{Names: []string{"Go", "rpc"}}}
+	_, err = posts.CreatePost(background, create)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	_, err = posts.CreatePost(withToken(background, "forged"), create)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	created, err := posts.CreatePost(annas, create)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, created.AuthorId, anna.ID)
+	assert.Equal(t, created.Status, models.PostDraft)
+	assert.Equal(t, len(created.Tags), 2)
+
+	_, err = posts.GetPost(background, &blogpb.GetPostRequest{Key: &blogpb.GetPostRequest_Slug{Slug: created.Slug}})
+	assert.Equal(t, status.Code(err), codes.NotFound)
+	found, err := posts.GetPost(annas, &blogpb.GetPostRequest{Key: &blogpb.GetPostRequest_Id{Id: created.Id}})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, found.Title, "Over gRPC")
+	list, err := posts.ListPosts(background, &blogpb.ListPostsRequest{})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(list.Posts), 1)
+	list, _ = posts.ListPosts(annas, &blogpb.ListPostsRequest{AuthorId: anna.ID})
+	assert.Equal(t, len(list.Posts), 1)
+	assert.Equal(t, list.Posts[0].Tags[0].Name, "go")
+
+	update := &blogpb.UpdatePostRequest{Id: created.Id, Title: "Edited", Content: "Hello", CategoryId: post.CategoryID}
+	_, err = posts.UpdatePost(john, update)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	updated, err := posts.UpdatePost(annas, update)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, updated.Title, "Edited")
+	assert.Equal(t, len(updated.Tags), 2)
+	_, err = posts.DeletePost(annas, &blogpb.DeletePostRequest{Id: created.Id})
+	assert.Equal(t, err, nil)
+	_, err = posts.GetPost(annas, &blogpb.GetPostRequest{Key: &blogpb.GetPostRequest_Id{Id: created.Id}})
+	assert.Equal(t, status.Code(err), codes.NotFound)
+
+	parentID := post.CategoryID
+	category, err := categories.CreateCategory(background, &blogpb.CreateCategoryRequest{Name: "Nested", ParentId: &parentID})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, category.GetParentId(), post.CategoryID)
+	root := uint32(0)
+	_, err = categories.UpdateCategory(background, &blogpb.UpdateCategoryRequest{Id: category.Id, Name: "Root", ParentId: &root})
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+	category, err = categories.UpdateCategory(john, &blogpb.UpdateCategoryRequest{Id: category.Id, Name: "Root", ParentId: &root})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, category.ParentId, (*uint32)(nil))
+	_, err = categories.DeleteCategory(john, &blogpb.DeleteCategoryRequest{Id: 999})
+	assert.Equal(t, status.Code(err), codes.NotFound)
+
+	// The tokens of users in the trash are refused
+	err = server.DB.Delete(&anna).Error
+	if err != nil {
+		log.Fatalf("cannot trash user: %v", err)
+	}
+	_, err = posts.CreatePost(annas, create)
+	assert.Equal(t, status.Code(err), codes.Unauthenticated)
+
+	// Reflection lists the services
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(background)
+	if err != nil {
+		t.Fatalf("cannot reflect: %v", err)
+	}
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{}})
+	assert.Equal(t, err, nil)
+	reflected, err := stream.Recv()
+	assert.Equal(t, err, nil)
+	services := []string{}
+	for _, service := range reflected.GetListServicesResponse().Service {
+		services = append(services, service.Name)
+	}
+	sort.Strings(services)
+	assert.Equal(t, services, []string{"blog.v1.CategoryService", "blog.v1.PostService", "blog.v1.UserService", "grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"})
+	stream.CloseSend()
+
+	// The server stops with its context
+	stop()
+	assert.Equal(t, <-served, nil)
+}
@@ -132,7 +132,15 @@ func TestLogin(t *testing.T) {
 
 		assert.Equal(t, rr.Code, v.statusCode)
 		if v.statusCode == 200 {
-			assert.NotEqual(t, rr.Body.String(), "")
+			responseMap := make(map[string]interface{})
+			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.NotEqual(t, responseMap["access_token"], "")
+			assert.Equal(t, responseMap["token_type"], "Bearer")
+			assert.Equal(t, responseMap["expires_in"], float64(3600))
+			assert.Equal(t, responseMap["user"].(map[string]interface{})["email"], v.email)
 		}
 
 		if v.statusCode == 422 && v.errorMessage != "" {
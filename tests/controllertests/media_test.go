@@ -0,0 +1,203 @@
+package controllertests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/storage"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestUploadAndServeMedia(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	dir, err := ioutil.TempDir("", "media")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	blobs := server.Blobs
+	server.Blobs = storage.NewLocal(dir)
+	defer func() { server.Blobs = blobs }()
+	server.InitializeRouter()
+
+	picture := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	for x := 0; x < 640; x++ {
+		for y := 0; y < 480; y++ {
+			picture.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	err = png.Encode(&encoded, picture)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	samples := []struct {
+		filename    string
+		content     []byte
+		postID      string
+		statusCode  int
+		contentType string
+	}{
+		{
+			filename:    "picture.png",
+			content:     encoded.Bytes(),
+			postID:      fmt.Sprintf("%d", post.ID),
+			statusCode:  201,
+			contentType: "image/png",
+		},
+		{
+			// Sniffed from the content, whatever the name says
+			filename:    "notes.png",
+			content:     []byte("Just some notes"),
+			statusCode:  201,
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			filename:   "page.html",
+			content:    []byte("<html><script>alert('hi')</script></html>"),
+			statusCode: 415,
+		},
+		{
+			filename:   "empty.txt",
+			content:    []byte{},
+			statusCode: 422,
+		},
+	}
+
+	urls := map[string]string{}
+	for _, v := range samples {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, err := form.CreateFormFile("file", v.filename)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		part.Write(v.content)
+		if v.postID != "" {
+			form.WriteField("post_id", v.postID)
+		}
+		form.Close()
+
+		req, err := http.NewRequest("POST", "/api/v1/media", &body)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		if v.statusCode == 201 {
+			responseMap := make(map[string]interface{})
+			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, responseMap["content_type"], v.contentType)
+			assert.Equal(t, responseMap["size"], float64(len(v.content)))
+			urls[v.filename] = responseMap["url"].(string)
+		}
+	}
+
+	// The picture is attached to the post and served in ranges
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/v1/posts/%d/media", post.ID), nil)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	attached := []map[string]interface{}{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &attached)
+	if err != nil {
+		t.Errorf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, len(attached), 1)
+	assert.Equal(t, attached[0]["width"], float64(640))
+	assert.Equal(t, attached[0]["height"], float64(480))
+
+	req, _ = http.NewRequest("GET", attached[0]["url"].(string), nil)
+	req.Header.Set("Range", "bytes=0-7")
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 206)
+	assert.Equal(t, rr.Header().Get("Cache-Control"), "public, max-age=31536000, immutable")
+	assert.Equal(t, rr.Body.Bytes(), encoded.Bytes()[:8])
+	assert.Equal(t, rr.Header().Get("Content-Range"), fmt.Sprintf("bytes 0-7/%d", encoded.Len()))
+
+	req, _ = http.NewRequest("GET", attached[0]["url"].(string), nil)
+	req.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 304)
+
+	req, _ = http.NewRequest("GET", attached[0]["thumbnail_url"].(string), nil)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 200)
+	thumbnail, _, err := image.DecodeConfig(rr.Body)
+	if err != nil {
+		t.Errorf("Cannot decode the thumbnail: %v", err)
+	}
+	assert.Equal(t, thumbnail.Width, 320)
+	assert.Equal(t, thumbnail.Height, 240)
+
+	// Other media is only served to its owner and to those who may read a
+	// post it is attached to, and kept out of shared caches
+	doe := models.User{Username: "doe", Email: "doe@gmail.com", Password: "password"}
+	err = server.DB.Create(&doe).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	doeToken, err := server.SignIn("doe@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	err = server.DB.Model(&models.Post{}).Where("id = ?", post.ID).UpdateColumn("status", models.PostDraft).Error
+	if err != nil {
+		log.Fatalf("cannot unpublish the post: %v", err)
+	}
+	access := []struct {
+		url   string
+		token string
+		code  int
+	}{
+		{url: urls["notes.png"], code: 404},
+		{url: urls["notes.png"], token: doeToken, code: 404},
+		{url: urls["notes.png"], token: token, code: 200},
+		{url: attached[0]["url"].(string), code: 404},
+		{url: attached[0]["thumbnail_url"].(string), token: doeToken, code: 404},
+		{url: attached[0]["url"].(string), token: token, code: 200},
+	}
+	for _, v := range access {
+		req, _ = http.NewRequest("GET", v.url, nil)
+		if v.token != "" {
+			req.Header.Set("Authorization", "Bearer "+v.token)
+		}
+		rr = httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, v.code)
+		if v.code == 200 {
+			assert.Equal(t, rr.Header().Get("Cache-Control"), "private, no-cache")
+		}
+	}
+}
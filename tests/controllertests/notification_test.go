@@ -0,0 +1,140 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type notificationPage struct {
+	Data []models.Notification  `json:"data"`
+	Meta map[string]interface{} `json:"meta"`
+}
+
+func TestNotifications(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens := map[string]string{}
+	for _, name := range []string{"anna", "bob", "carl"} {
+		user := models.User{Username: name, Email: name + "@gmail.com", Password: "password"}
+		err = server.DB.Create(&user).Error
+		if err != nil {
+			log.Fatalf("cannot seed users: %v", err)
+		}
+	}
+	for _, name := range []string{"john", "anna", "bob", "carl"} {
+		tokens[name], err = server.SignIn(name+"@gmail.com", "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+	}
+
+	send := func(name string, method string, path string, form url.Values) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+tokens[name])
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+	notifications := func(query string) notificationPage {
+		rr := send("john", "GET", "/api/v1/me/notifications"+query, nil)
+		assert.Equal(t, rr.Code, 200)
+		page := notificationPage{}
+		err := json.Unmarshal(rr.Body.Bytes(), &page)
+		if err != nil {
+			t.Fatalf("cannot convert to json: %v", err)
+		}
+		return page
+	}
+	reactions := fmt.Sprintf("/api/v1/posts/%d/reactions/", post.ID)
+
+	// Three people react, one of them twice, and the author's own reaction
+	// doesn't count
+	send("john", "PUT", reactions+"like", nil)
+	for _, name := range []string{"anna", "bob", "carl"} {
+		rr := send(name, "PUT", reactions+"like", nil)
+		assert.Equal(t, rr.Code, 200)
+	}
+	send("bob", "PUT", reactions+"love", nil)
+	send("bob", "PUT", reactions+"love", nil)
+	rr := send("anna", "POST", fmt.Sprintf("/api/v1/users/%d/follow", post.AuthorID), nil)
+	assert.Equal(t, rr.Code, 204)
+
+	page := notifications("")
+	assert.Equal(t, page.Meta["unread_count"], float64(2))
+	assert.Equal(t, len(page.Data), 2)
+	assert.Equal(t, page.Data[0].Kind, models.NotifyFollow)
+	assert.Equal(t, page.Data[0].Message, "anna started following you")
+	assert.Equal(t, page.Data[1].Kind, models.NotifyReaction)
+	assert.Equal(t, page.Data[1].PostID, post.ID)
+	assert.Equal(t, page.Data[1].ActorCount, 3)
+	assert.Equal(t, len(page.Data[1].Actors), 3)
+	assert.Equal(t, strings.HasSuffix(page.Data[1].Message, " and 2 others reacted to your post"), true)
+
+	// Reading one leaves the other unread
+	rr = send("john", "POST", "/api/v1/me/notifications/read", url.Values{"ids": {fmt.Sprint(page.Data[0].ID)}})
+	assert.Equal(t, rr.Code, 204)
+	page = notifications("?unread=true")
+	assert.Equal(t, page.Meta["unread_count"], float64(1))
+	assert.Equal(t, len(page.Data), 1)
+	assert.Equal(t, page.Data[0].Kind, models.NotifyReaction)
+	rr = send("john", "POST", "/api/v1/me/notifications/read", nil)
+	assert.Equal(t, rr.Code, 204)
+	assert.Equal(t, notifications("").Meta["unread_count"], float64(0))
+
+	// Turned off kinds aren't notified of
+	rr = send("john", "PUT", "/api/v1/me/notifications/preferences", url.Values{"reactions": {"false"}})
+	assert.Equal(t, rr.Code, 200)
+	preferences := models.NotificationPreferences{}
+	json.Unmarshal(rr.Body.Bytes(), &preferences)
+	assert.Equal(t, preferences, models.NotificationPreferences{Follows: true, Comments: true, Reactions: false})
+	send("anna", "PUT", reactions+"wow", nil)
+	assert.Equal(t, notifications("").Meta["unread_count"], float64(0))
+
+	// Activity after a notification was read starts a new one
+	send("john", "PUT", "/api/v1/me/notifications/preferences", url.Values{"reactions": {"true"}})
+	send("carl", "PUT", reactions+"sad", nil)
+	page = notifications("?unread=true")
+	assert.Equal(t, len(page.Data), 1)
+	assert.Equal(t, page.Data[0].ActorCount, 1)
+	assert.Equal(t, page.Data[0].Message, "carl reacted to your post")
+
+	rr = send("john", "PUT", "/api/v1/me/notifications/preferences", url.Values{"reactions": {"maybe"}})
+	assert.Equal(t, rr.Code, 400)
+	req, _ := http.NewRequest("GET", "/api/v1/me/notifications", nil)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 401)
+
+	// Purged users are counted out of the notifications of others, and those
+	// left without actors go
+	err = server.DB.Model(&models.User{}).Where("username IN (?)", []string{"bob", "carl"}).UpdateColumn("deleted_at", time.Now().Add(-time.Hour)).Error
+	if err != nil {
+		log.Fatalf("cannot trash users: %v", err)
+	}
+	_, err = models.PurgeTrash(server.DB, time.Now())
+	if err != nil {
+		t.Fatalf("this is the error purging the trash: %v", err)
+	}
+	page = notifications("")
+	assert.Equal(t, len(page.Data), 2)
+	assert.Equal(t, page.Data[1].Kind, models.NotifyReaction)
+	assert.Equal(t, page.Data[1].ActorCount, 1)
+	assert.Equal(t, page.Data[1].Message, "anna reacted to your post")
+}
@@ -0,0 +1,162 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// TestOpenAPICoversRoutes fails when a route is registered without being
+// described in /openapi.json
+func TestOpenAPICoversRoutes(t *testing.T) {
+
+	server.InitializeRouter()
+
+	req, err := http.NewRequest("GET", "/openapi.json", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	spec := struct {
+		OpenAPI string                            `json:"openapi"`
+		Paths   map[string]map[string]interface{} `json:"paths"`
+	}{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &spec)
+	if err != nil {
+		t.Fatalf("Cannot convert to json: %v", err)
+	}
+	assert.Equal(t, spec.OpenAPI, "3.1.0")
+
+	err = server.Router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Subrouter prefixes only group other routes
+			return nil
+		}
+		for _, method := range methods {
+			if _, ok := spec.Paths[path][strings.ToLower(method)]; !ok {
+				t.Errorf("%s %s is missing from the OpenAPI document", method, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("this is the error walking the routes: %v\n", err)
+	}
+}
+
+// TestOpenAPIDescribesJSONBodies checks the batch endpoints document the
+// items they read
+func TestOpenAPIDescribesJSONBodies(t *testing.T) {
+
+	server.InitializeRouter()
+
+	req, err := http.NewRequest("GET", "/openapi.json", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, http.StatusOK)
+
+	type schema struct {
+		Ref        string            `json:"$ref"`
+		Properties map[string]schema `json:"properties"`
+		Items      *schema           `json:"items"`
+	}
+	spec := struct {
+		Paths map[string]map[string]struct {
+			RequestBody struct {
+				Content map[string]struct {
+					Schema schema `json:"schema"`
+				} `json:"content"`
+			} `json:"requestBody"`
+		} `json:"paths"`
+		Components struct {
+			Schemas map[string]schema `json:"schemas"`
+		} `json:"components"`
+	}{}
+	err = json.Unmarshal(rr.Body.Bytes(), &spec)
+	if err != nil {
+		t.Fatalf("Cannot convert to json: %v", err)
+	}
+	resolve := func(s schema) schema {
+		if s.Ref != "" {
+			return spec.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		}
+		return s
+	}
+
+	samples := []struct {
+		path  string
+		field string
+	}{
+		{path: "/api/v1/posts:batch", field: "title"},
+		{path: "/api/v1/category:batch", field: "parent_id"},
+	}
+	for _, v := range samples {
+		body := resolve(spec.Paths[v.path]["post"].RequestBody.Content["application/json"].Schema)
+		_, ok := body.Properties["mode"]
+		assert.Equal(t, ok, true)
+		items := body.Properties["items"].Items
+		if items == nil {
+			t.Fatalf("%s documents no items", v.path)
+		}
+		item := resolve(*items)
+		for _, field := range []string{"action", "id", v.field} {
+			_, ok = item.Properties[field]
+			assert.Equal(t, ok, true)
+		}
+	}
+}
+
+// TestDocsServesItsAssets checks the Swagger UI loads nothing from other
+// hosts, its stylesheet and script being served from the binary
+func TestDocsServesItsAssets(t *testing.T) {
+
+	server.InitializeRouter()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("/docs")
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, strings.Contains(rr.Body.String(), "://"), false)
+
+	samples := []struct {
+		path        string
+		code        int
+		contentType string
+	}{
+		{path: "/docs/swagger-ui.css", code: http.StatusOK, contentType: "text/css; charset=utf-8"},
+		{path: "/docs/swagger-ui-bundle.js", code: http.StatusOK, contentType: "text/javascript; charset=utf-8"},
+		{path: "/docs/index.html", code: http.StatusNotFound},
+	}
+	for _, v := range samples {
+		rr = get(v.path)
+		assert.Equal(t, rr.Code, v.code)
+		if v.code == http.StatusOK {
+			assert.Equal(t, rr.Header().Get("Content-Type"), v.contentType)
+			assert.NotEqual(t, rr.Body.Len(), 0)
+		}
+	}
+}
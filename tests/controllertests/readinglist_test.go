@@ -0,0 +1,135 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestReadingLists(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+	author := models.User{Username: "doe", Email: "doe@gmail.com", Password: "password"}
+	err = server.DB.Create(&author).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	posts := []models.Post{post}
+	for _, title := range []string{"Unpublished later", "Deleted later"} {
+		p := models.Post{Title: title, Content: title, AuthorID: author.ID, CategoryID: post.CategoryID}
+		err = server.DB.Create(&p).Error
+		if err != nil {
+			log.Fatalf("cannot seed posts: %v", err)
+		}
+		posts = append(posts, p)
+	}
+
+	send := func(method string, path string, form url.Values) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		body := map[string]interface{}{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+	order := func(list map[string]interface{}) []string {
+		titles := []string{}
+		items, _ := list["items"].([]interface{})
+		for _, item := range items {
+			item := item.(map[string]interface{})
+			if post, ok := item["post"].(map[string]interface{}); ok {
+				titles = append(titles, post["title"].(string))
+			} else {
+				titles = append(titles, fmt.Sprintf("unavailable %v", item["post_id"]))
+			}
+		}
+		return titles
+	}
+
+	code, list := send("POST", "/api/v1/me/lists", url.Values{"name": {"Later"}, "public": {"true"}})
+	assert.Equal(t, code, 201)
+	shareURL := list["share_url"].(string)
+	lists := fmt.Sprintf("/api/v1/me/lists/%v", list["id"])
+
+	code, _ = send("POST", "/api/v1/me/lists", url.Values{"name": {""}})
+	assert.Equal(t, code, 422)
+	code, _ = send("PUT", fmt.Sprintf("%s/posts/99", lists), nil)
+	assert.Equal(t, code, 404)
+
+	// New posts go last, and a position moves a post there
+	for _, p := range posts {
+		code, list = send("PUT", fmt.Sprintf("%s/posts/%d", lists, p.ID), nil)
+		assert.Equal(t, code, 200)
+	}
+	code, list = send("PUT", fmt.Sprintf("%s/posts/%d", lists, posts[2].ID), url.Values{"position": {"1"}})
+	assert.Equal(t, code, 200)
+	assert.Equal(t, order(list), []string{"Deleted later", posts[0].Title, "Unpublished later"})
+	code, list = send("PUT", fmt.Sprintf("%s/posts/%d", lists, posts[2].ID), nil)
+	assert.Equal(t, order(list), []string{"Deleted later", posts[0].Title, "Unpublished later"})
+
+	// Posts gone from view stay in the list, flagged, but not in the shared copy
+	err = server.DB.Model(&models.Post{}).Where("id = ?", posts[1].ID).UpdateColumn("status", models.PostDraft).Error
+	if err != nil {
+		t.Fatalf("cannot unpublish: %v", err)
+	}
+	_, err = postInstance.DeletePost(server.DB, posts[2].ID, author.ID)
+	if err != nil {
+		t.Fatalf("cannot delete: %v", err)
+	}
+	code, list = send("GET", lists, nil)
+	assert.Equal(t, code, 200)
+	assert.Equal(t, order(list), []string{
+		fmt.Sprintf("unavailable %d", posts[2].ID), posts[0].Title, fmt.Sprintf("unavailable %d", posts[1].ID),
+	})
+
+	req, _ := http.NewRequest("GET", shareURL, nil)
+	rr := httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 200)
+	shared := map[string]interface{}{}
+	json.Unmarshal(rr.Body.Bytes(), &shared)
+	assert.Equal(t, order(shared), []string{posts[0].Title})
+
+	// Making the list private revokes the link
+	code, list = send("PUT", lists, url.Values{"public": {"false"}})
+	assert.Equal(t, code, 200)
+	assert.Equal(t, list["name"], "Later")
+	assert.Equal(t, list["public"], false)
+	req, _ = http.NewRequest("GET", shareURL, nil)
+	rr = httptest.NewRecorder()
+	server.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 404)
+
+	code, _ = send("DELETE", fmt.Sprintf("%s/posts/%d", lists, posts[2].ID), nil)
+	assert.Equal(t, code, 204)
+	code, list = send("GET", lists, nil)
+	items := list["items"].([]interface{})
+	assert.Equal(t, len(items), 2)
+	assert.Equal(t, items[0].(map[string]interface{})["position"], float64(1))
+	assert.Equal(t, items[1].(map[string]interface{})["position"], float64(2))
+
+	code, _ = send("DELETE", lists, nil)
+	assert.Equal(t, code, 204)
+	code, _ = send("GET", lists, nil)
+	assert.Equal(t, code, 404)
+}
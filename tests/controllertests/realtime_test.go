@@ -0,0 +1,180 @@
+package controllertests
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rizalreza/golang-restful/api/controllers"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/realtime"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// nextMessage returns the next message sent on conn
+func nextMessage(t *testing.T, conn *websocket.Conn) realtime.Message {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	m := realtime.Message{}
+	err := conn.ReadJSON(&m)
+	if err != nil {
+		t.Fatalf("no message: %v", err)
+	}
+	return m
+}
+
+// roundTrip pings the server and returns once it answered, so whatever conn
+// sent before has been handled
+func roundTrip(t *testing.T, conn *websocket.Conn) {
+	conn.WriteJSON(realtime.Message{Type: realtime.Ping})
+	assert.Equal(t, nextMessage(t, conn).Type, realtime.Pong)
+}
+
+func TestRealtime(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&models.User{}).Where("id = ?", post.AuthorID).UpdateColumn("role", models.RoleAdmin).Error
+	if err != nil {
+		t.Fatalf("cannot make admin: %v", err)
+	}
+	anna := models.User{Username: "anna", Email: "anna@gmail.com", Password: "password"}
+	err = server.DB.Create(&anna).Error
+	if err != nil {
+		log.Fatalf("cannot seed users: %v", err)
+	}
+	draft := models.Post{Title: "Draft", Content: "Draft", AuthorID: post.AuthorID, CategoryID: post.CategoryID, Status: models.PostDraft}
+	err = server.DB.Create(&draft).Error
+	if err != nil {
+		log.Fatalf("cannot seed posts: %v", err)
+	}
+	tokens := map[string]string{}
+	for _, name := range []string{"john", "anna"} {
+		tokens[name], err = server.SignIn(name+"@gmail.com", "password")
+		if err != nil {
+			log.Fatalf("cannot login: %v\n", err)
+		}
+	}
+
+	// A server of its own, so shutting it down leaves the others be
+	live := &controllers.Server{DB: server.DB}
+	live.InitializeRouter()
+	ts := httptest.NewServer(live.Router)
+	defer ts.Close()
+	endpoint := "ws" + strings.TrimPrefix(ts.URL, "http") + "/api/v1/live"
+	connect := func(name string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(endpoint+"?token="+tokens[name], nil)
+		if err != nil {
+			t.Fatalf("cannot connect: %v", err)
+		}
+		return conn
+	}
+
+	_, res, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	assert.Equal(t, err, websocket.ErrBadHandshake)
+	assert.Equal(t, res.StatusCode, 401)
+
+	// Joining gets who is there, then the room hears of it
+	john := connect("john")
+	defer john.Close()
+	john.WriteJSON(realtime.Message{Type: realtime.Join, PostID: post.ID})
+	presence := nextMessage(t, john)
+	assert.Equal(t, presence.Type, realtime.Presence)
+	assert.Equal(t, len(presence.Users), 0)
+	assert.Equal(t, nextMessage(t, john).User.Username, "john")
+
+	annaConn := connect("anna")
+	annaConn.WriteJSON(realtime.Message{Type: realtime.Join, PostID: post.ID})
+	presence = nextMessage(t, annaConn)
+	assert.Equal(t, presence.Users, []realtime.Member{{ID: post.AuthorID, Username: "john"}})
+	assert.Equal(t, nextMessage(t, annaConn).Type, realtime.Join)
+	joined := nextMessage(t, john)
+	assert.Equal(t, joined.Type, realtime.Join)
+	assert.Equal(t, joined.User.ID, anna.ID)
+
+	// Typing is only sent to the others
+	typing := true
+	annaConn.WriteJSON(realtime.Message{Type: realtime.Typing, PostID: post.ID, Typing: &typing})
+	roundTrip(t, annaConn)
+	typed := nextMessage(t, john)
+	assert.Equal(t, typed.Type, realtime.Typing)
+	assert.Equal(t, typed.User.ID, anna.ID)
+	assert.Equal(t, *typed.Typing, true)
+
+	// Comments approved on the post are sent to the room
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/v1/posts/%d/comments", post.ID), strings.NewReader(url.Values{"body": {"Live"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+tokens["john"])
+	rr := httptest.NewRecorder()
+	live.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 201)
+	for _, conn := range []*websocket.Conn{john, annaConn} {
+		comment := nextMessage(t, conn)
+		assert.Equal(t, comment.Type, realtime.Comment)
+		assert.Equal(t, comment.PostID, post.ID)
+		assert.Equal(t, strings.Contains(string(comment.Data), `"body":"Live"`), true)
+	}
+
+	// Rooms of posts one can't see can't be joined
+	annaConn.WriteJSON(realtime.Message{Type: realtime.Join, PostID: draft.ID})
+	refused := nextMessage(t, annaConn)
+	assert.Equal(t, refused.Type, realtime.Error)
+	assert.Equal(t, refused.Error, "Post not found")
+	annaConn.WriteJSON(realtime.Message{Type: "dance"})
+	assert.Equal(t, nextMessage(t, annaConn).Error, "Unknown message type")
+
+	// A user is in the room until their last connection leaves
+	second := connect("anna")
+	second.WriteJSON(realtime.Message{Type: realtime.Join, PostID: post.ID})
+	assert.Equal(t, len(nextMessage(t, second).Users), 2)
+	annaConn.WriteJSON(realtime.Message{Type: realtime.Leave, PostID: post.ID})
+	roundTrip(t, annaConn)
+	roundTrip(t, john)
+	annaConn.Close()
+	second.Close()
+	left := nextMessage(t, john)
+	assert.Equal(t, left.Type, realtime.Leave)
+	assert.Equal(t, left.User.ID, anna.ID)
+
+	// Connections are pinged, and dropped when they don't answer
+	pingPeriod := realtime.PingPeriod
+	realtime.PingPeriod = 50 * time.Millisecond
+	defer func() { realtime.PingPeriod = pingPeriod }()
+	quiet := connect("john")
+	pings := 0
+	quiet.SetPingHandler(func(string) error {
+		pings++
+		return nil
+	})
+	quiet.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = quiet.ReadMessage()
+	assert.NotEqual(t, pings, 0)
+	assert.Equal(t, websocket.IsCloseError(err, websocket.CloseAbnormalClosure), true)
+
+	// Shutting down closes the connections
+	conn := connect("anna")
+	live.Realtime.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	assert.Equal(t, websocket.IsCloseError(err, websocket.CloseGoingAway), true)
+
+	// Hubs sharing a broadcaster share their rooms
+	broadcaster := realtime.NewLocalBroadcaster()
+	first := realtime.NewHub(broadcaster, 10)
+	other := realtime.NewHub(broadcaster, 10)
+	here := first.Connect(realtime.Member{ID: 1, Username: "here"})
+	there := other.Connect(realtime.Member{ID: 2, Username: "there"})
+	first.Join(here, 7)
+	other.Join(there, 7)
+	assert.Equal(t, (<-there.C).Users, []realtime.Member{{ID: 1, Username: "here"}})
+	<-here.C
+	<-here.C
+	assert.Equal(t, (<-here.C).User.Username, "there")
+}
@@ -0,0 +1,44 @@
+package controllertests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestVersionedRoutes(t *testing.T) {
+
+	server.InitializeRouter()
+
+	samples := []struct {
+		path       string
+		deprecated bool
+		successor  string
+	}{
+		{
+			path:       "/api/v1/",
+			deprecated: false,
+		},
+		{
+			path:       "/",
+			deprecated: true,
+			successor:  "</api/v1/>; rel=\"successor-version\"",
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", v.path, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, http.StatusOK)
+		assert.Equal(t, rr.Header().Get("Deprecation") != "", v.deprecated)
+		assert.Equal(t, rr.Header().Get("Sunset") != "", v.deprecated)
+		assert.Equal(t, rr.Header().Get("Link"), v.successor)
+	}
+}
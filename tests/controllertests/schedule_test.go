@@ -0,0 +1,54 @@
+package controllertests
+
+import (
+	"context"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestPublishDuePosts(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	due, later := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	err = server.DB.Model(&models.Post{}).Where("id = ?", post.ID).UpdateColumns(map[string]interface{}{"status": models.PostScheduled, "published_at": due}).Error
+	if err != nil {
+		t.Fatalf("cannot schedule post: %v", err)
+	}
+	scheduled := models.Post{Title: "Later", Content: "Not yet", AuthorID: post.AuthorID, CategoryID: post.CategoryID, Status: models.PostScheduled, PublishedAt: &later}
+	err = server.DB.Create(&scheduled).Error
+	if err != nil {
+		log.Fatalf("cannot seed posts: %v", err)
+	}
+
+	if server.Events == nil {
+		server.Events = events.NewBus()
+	}
+	told := []events.Event{}
+	unsubscribe := server.Events.Subscribe(func(e events.Event) {
+		told = append(told, e)
+	})
+	defer unsubscribe()
+
+	// Only the due post goes live, and those reacting to updates hear of it
+	err = server.PublishDuePosts(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(told), 1)
+	assert.Equal(t, told[0].Type, events.PostUpdated)
+	assert.Equal(t, told[0].PostID, post.ID)
+	assert.Equal(t, told[0].ActorID, post.AuthorID)
+	assert.Equal(t, told[0].Data.(*models.Post).Status, models.PostPublished)
+	assert.Equal(t, told[0].Data.(*models.Post).IsVisibleTo(0), true)
+
+	// Published posts are not told again
+	err = server.PublishDuePosts(context.Background())
+	assert.Equal(t, err, nil)
+	assert.Equal(t, len(told), 1)
+}
@@ -0,0 +1,147 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/search"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestSearchPosts(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	other := models.Post{
+		Title:      "Baking a crème brûlée",
+		Content:    "It needs **cream**, sugar and patience",
+		AuthorID:   post.AuthorID,
+		CategoryID: post.CategoryID,
+	}
+	err = server.DB.Model(&models.Post{}).Create(&other).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	draft := models.Post{
+		Title:      "A draft about cream",
+		Content:    "Not ready yet",
+		AuthorID:   post.AuthorID,
+		CategoryID: post.CategoryID,
+		Status:     models.PostDraft,
+	}
+	err = server.DB.Model(&models.Post{}).Create(&draft).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The in-memory index works with every database the tests run against
+	engine := server.Search
+	server.Search = search.NewIndex()
+	defer func() { server.Search = engine }()
+	server.InitializeRouter()
+
+	samples := []struct {
+		query      string
+		statusCode int
+		ids        []float64
+		snippet    string
+	}{
+		{
+			query:      "q=creme",
+			statusCode: 200,
+			ids:        []float64{float64(other.ID)},
+		},
+		{
+			// Drafts are only found by their author
+			query:      "q=cream",
+			statusCode: 200,
+			ids:        []float64{float64(other.ID)},
+			snippet:    "It needs <mark>cream</mark>, sugar and patience",
+		},
+		{
+			// Words in the title count more than words in the content
+			query:      "q=sam+sugar",
+			statusCode: 200,
+			ids:        []float64{float64(post.ID), float64(other.ID)},
+		},
+		{
+			query:      "q=cream&category_id=99",
+			statusCode: 200,
+			ids:        []float64{},
+		},
+		{
+			query:      "q=",
+			statusCode: 400,
+		},
+		{
+			query:      "q=cream&from=yesterday",
+			statusCode: 400,
+		},
+	}
+
+	search := func(query string) (int, []map[string]interface{}, []float64) {
+		req, err := http.NewRequest("GET", "/api/v1/search?"+query, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+
+		results := []map[string]interface{}{}
+		ids := []float64{}
+		if rr.Code != 200 {
+			return rr.Code, results, ids
+		}
+		err = json.Unmarshal([]byte(rr.Body.String()), &results)
+		if err != nil {
+			t.Errorf("Cannot convert to json: %v", err)
+		}
+		for _, result := range results {
+			ids = append(ids, result["post"].(map[string]interface{})["id"].(float64))
+		}
+		return rr.Code, results, ids
+	}
+
+	for _, v := range samples {
+		code, results, ids := search(v.query)
+		assert.Equal(t, code, v.statusCode)
+		if v.statusCode != 200 {
+			continue
+		}
+		assert.Equal(t, ids, v.ids)
+		if v.snippet != "" {
+			assert.Equal(t, results[0]["snippet"], v.snippet)
+		}
+	}
+
+	// The index catches up with posts changed and deleted since the last
+	// search
+	err = server.DB.Model(&other).UpdateColumns(map[string]interface{}{
+		"title":        "Baking a tarte tatin",
+		"content":      "Apples and sugar",
+		"content_html": "<p>Apples and sugar</p>",
+		"updated_at":   time.Now().Add(time.Minute),
+	}).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Delete(&post).Error
+	if err != nil {
+		log.Fatal(err)
+	}
+	for query, want := range map[string][]float64{
+		"q=tatin":     {float64(other.ID)},
+		"q=sam+sugar": {float64(other.ID)},
+		"q=cream":     {},
+	} {
+		_, _, ids := search(query)
+		assert.Equal(t, ids, want)
+	}
+}
@@ -0,0 +1,77 @@
+package controllertests
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestGetPostBySlug(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert.Equal(t, post.Slug, "this-is-the-title-sam")
+
+	postUpdate := models.Post{
+		ID:         post.ID,
+		Title:      "A new title",
+		Content:    post.Content,
+		AuthorID:   post.AuthorID,
+		CategoryID: post.CategoryID,
+	}
+	_, err = postUpdate.UpdatePost(server.DB)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server.InitializeRouter()
+
+	samples := []struct {
+		path       string
+		statusCode int
+		location   string
+	}{
+		{
+			path:       "/api/v1/posts/a-new-title",
+			statusCode: 200,
+		},
+		{
+			// The slug the post had before the rename
+			path:       "/api/v1/posts/this-is-the-title-sam?include=author",
+			statusCode: 301,
+			location:   "/api/v1/posts/a-new-title?include=author",
+		},
+		{
+			path:       "/api/v1/posts/unknown-post",
+			statusCode: 404,
+		},
+	}
+
+	for _, v := range samples {
+		req, err := http.NewRequest("GET", v.path, nil)
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+
+		assert.Equal(t, rr.Code, v.statusCode)
+		assert.Equal(t, rr.Header().Get("Location"), v.location)
+		if v.statusCode == 200 {
+			responseMap := make(map[string]interface{})
+			err = json.Unmarshal([]byte(rr.Body.String()), &responseMap)
+			if err != nil {
+				t.Errorf("Cannot convert to json: %v", err)
+			}
+			assert.Equal(t, responseMap["id"], float64(post.ID))
+			assert.Equal(t, responseMap["slug"], "a-new-title")
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package controllertests
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/controllers"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/sse"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+type streamFrame struct {
+	ID      string
+	Event   string
+	Data    string
+	Comment string
+}
+
+// readStream sends the frames of an event stream on a channel, closed when
+// the stream ends
+func readStream(t *testing.T, url string, lastID string) (chan streamFrame, func()) {
+	req, _ := http.NewRequest("GET", url, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("cannot connect: %v", err)
+	}
+	assert.Equal(t, res.Header.Get("Content-Type"), "text/event-stream")
+	frames := make(chan streamFrame, 100)
+	go func() {
+		defer close(frames)
+		scanner := bufio.NewScanner(res.Body)
+		frame := streamFrame{}
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if frame != (streamFrame{}) {
+					frames <- frame
+				}
+				frame = streamFrame{}
+			case strings.HasPrefix(line, ": "):
+				frame.Comment = line[2:]
+			case strings.HasPrefix(line, "id: "):
+				frame.ID = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				frame.Event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				frame.Data = line[6:]
+			}
+		}
+	}()
+	return frames, func() { res.Body.Close() }
+}
+
+// nextEvent returns the next frame that isn't a heartbeat
+func nextEvent(t *testing.T, frames chan streamFrame) streamFrame {
+	for {
+		select {
+		case frame, ok := <-frames:
+			if !ok {
+				return streamFrame{}
+			}
+			if frame.Comment == "" {
+				return frame
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	other := models.Category{Name: "Elsewhere"}
+	err = server.DB.Create(&other).Error
+	if err != nil {
+		log.Fatalf("cannot seed categories: %v", err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	// A server of its own, so shutting it down leaves the others be
+	heartbeat := sse.Heartbeat
+	sse.Heartbeat = 50 * time.Millisecond
+	defer func() { sse.Heartbeat = heartbeat }()
+	streaming := &controllers.Server{DB: server.DB}
+	streaming.InitializeRouter()
+	ts := httptest.NewServer(streaming.Router)
+	defer ts.Close()
+
+	createPost := func(title string, cid uint32, status string) {
+		req, _ := http.NewRequest("POST", "/api/v1/posts", strings.NewReader(url.Values{
+			"title": {title}, "content": {title}, "author_id": {fmt.Sprint(post.AuthorID)},
+			"category_id": {fmt.Sprint(cid)}, "status": {status},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		streaming.Router.ServeHTTP(rr, req)
+		assert.Equal(t, rr.Code, 201)
+	}
+
+	stream := fmt.Sprintf("%s/api/v1/events?category=%d", ts.URL, post.CategoryID)
+	frames, disconnect := readStream(t, stream, "")
+
+	// Drafts and posts of other categories are left out
+	createPost("Elsewhere", other.ID, models.PostPublished)
+	createPost("Secret", post.CategoryID, models.PostDraft)
+	createPost("Live", post.CategoryID, models.PostPublished)
+	first := nextEvent(t, frames)
+	assert.Equal(t, first.Event, "post.created")
+	live := models.Post{}
+	json.Unmarshal([]byte(first.Data), &live)
+	assert.Equal(t, live.Title, "Live")
+
+	// Idle streams get heartbeats
+	frame := <-frames
+	for frame.Comment == "" {
+		frame = <-frames
+	}
+	assert.Equal(t, frame.Comment, "heartbeat")
+	disconnect()
+
+	// Reconnecting replays what was missed
+	createPost("Missed", post.CategoryID, models.PostPublished)
+	frames, disconnect = readStream(t, stream, first.ID)
+	missed := nextEvent(t, frames)
+	assert.Equal(t, missed.Event, "post.created")
+	assert.Equal(t, strings.Contains(missed.Data, `"title":"Missed"`), true)
+	disconnect()
+
+	// Events no longer kept can't be replayed
+	frames, disconnect = readStream(t, stream, "999999")
+	assert.Equal(t, nextEvent(t, frames).Event, "resync")
+	disconnect()
+
+	req, _ := http.NewRequest("GET", "/api/v1/events?author=x", nil)
+	rr := httptest.NewRecorder()
+	streaming.Router.ServeHTTP(rr, req)
+	assert.Equal(t, rr.Code, 400)
+
+	// Shutting down ends the streams
+	frames, _ = readStream(t, stream, "")
+	streaming.Stream.Close()
+	assert.Equal(t, nextEvent(t, frames), streamFrame{})
+
+	// A client that falls behind is dropped, with what it was sent
+	broker := sse.NewBroker(10, 2)
+	client, _ := broker.Subscribe(sse.Filter{}, 0)
+	for i := 0; i < 3; i++ {
+		broker.Publish("tick", []byte("{}"), nil)
+	}
+	ids := []uint64{}
+	for m := range client.C {
+		ids = append(ids, m.ID)
+	}
+	assert.Equal(t, ids, []uint64{1, 2})
+	client, complete := broker.Subscribe(sse.Filter{}, 2)
+	assert.Equal(t, complete, true)
+	assert.Equal(t, (<-client.C).ID, uint64(3))
+}
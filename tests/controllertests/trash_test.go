@@ -0,0 +1,66 @@
+package controllertests
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"gopkg.in/go-playground/assert.v1"
+)
+
+// TestTrashedUserTokens checks the tokens of a user moved to the trash no
+// longer change their posts
+func TestTrashedUserTokens(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	send := func(method string, path string, contentType string, body string) int {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	form := "application/x-www-form-urlencoded"
+	postForm := url.Values{
+		"title":       {"After the trash"},
+		"content":     {"Still here"},
+		"author_id":   {fmt.Sprint(post.AuthorID)},
+		"category_id": {fmt.Sprint(post.CategoryID)},
+	}.Encode()
+
+	code := send("DELETE", fmt.Sprintf("/api/v1/users/%d", post.AuthorID), form, "")
+	assert.Equal(t, code, http.StatusNoContent)
+
+	samples := []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+	}{
+		{method: "POST", path: "/api/v1/posts", contentType: form, body: postForm},
+		{method: "PUT", path: fmt.Sprintf("/api/v1/posts/%d", post.ID), contentType: form, body: postForm},
+		{method: "POST", path: fmt.Sprintf("/api/v1/posts/%d/publish", post.ID), contentType: form},
+		{method: "DELETE", path: fmt.Sprintf("/api/v1/posts/%d", post.ID), contentType: form},
+		{method: "POST", path: "/api/v1/posts:batch", contentType: "application/json", body: fmt.Sprintf(`{"items": [{"action": "delete", "id": %d}]}`, post.ID)},
+	}
+	for _, v := range samples {
+		code = send(v.method, v.path, v.contentType, v.body)
+		assert.Equal(t, code, http.StatusUnauthorized)
+	}
+}
@@ -146,6 +146,38 @@ func TestGetUsers(t *testing.T) {
 	assert.Equal(t, len(users), 2)
 }
 
+func TestGetUsersSparseFields(t *testing.T) {
+
+	err := refreshUserTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = seedUsers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", "/users?fields=id,username", nil)
+	if err != nil {
+		t.Errorf("this is the error: %v\n", err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(server.GetUsers)
+	handler.ServeHTTP(rr, req)
+
+	var users []map[string]interface{}
+	err = json.Unmarshal([]byte(rr.Body.String()), &users)
+	if err != nil {
+		log.Fatalf("Cannot convert to json: %v\n", err)
+	}
+	assert.Equal(t, rr.Code, http.StatusOK)
+	assert.Equal(t, len(users), 2)
+	for _, user := range users {
+		assert.Equal(t, len(user), 2)
+		assert.NotEqual(t, user["id"], nil)
+		assert.NotEqual(t, user["username"], nil)
+	}
+}
+
 func TestGetUserByID(t *testing.T) {
 
 	err := refreshUserTable()
@@ -194,8 +226,10 @@ func TestGetUserByID(t *testing.T) {
 		assert.Equal(t, rr.Code, v.statusCode)
 
 		if v.statusCode == 200 {
+			// Anonymous clients only get the public profile
 			assert.Equal(t, user.Username, responseMap["username"])
-			assert.Equal(t, user.Email, responseMap["email"])
+			assert.Equal(t, responseMap["email"], nil)
+			assert.Equal(t, responseMap["password"], nil)
 		}
 	}
 }
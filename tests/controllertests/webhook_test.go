@@ -0,0 +1,152 @@
+package controllertests
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/events"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/webhooks"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestWebhooks(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = server.DB.Model(&models.User{}).Where("id = ?", post.AuthorID).UpdateColumn("role", models.RoleAdmin).Error
+	if err != nil {
+		t.Fatalf("cannot make admin: %v", err)
+	}
+	token, err := server.SignIn("john@gmail.com", "password")
+	if err != nil {
+		log.Fatalf("cannot login: %v\n", err)
+	}
+
+	// The receiver fails until told otherwise, and checks every signature
+	secret := "a-long-enough-test-secret"
+	var mu sync.Mutex
+	failing := true
+	received := []events.Event{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		signature := r.Header.Get(webhooks.SignatureHeader)
+		assert.Equal(t, webhooks.Verify(secret, signature, body, time.Minute, time.Now()), nil)
+		assert.Equal(t, webhooks.Verify(secret, signature, append(body, ' '), time.Minute, time.Now()), webhooks.ErrInvalidSignature)
+		assert.Equal(t, webhooks.Verify(secret, signature, body, time.Minute, time.Now().Add(time.Hour)), webhooks.ErrInvalidSignature)
+		e := events.Event{}
+		json.Unmarshal(body, &e)
+		assert.Equal(t, r.Header.Get(webhooks.EventHeader), e.Type)
+
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e)
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	send := func(method string, path string, form url.Values) (int, map[string]interface{}) {
+		req, err := http.NewRequest(method, path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Errorf("this is the error: %v\n", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		server.Router.ServeHTTP(rr, req)
+		body := map[string]interface{}{}
+		json.Unmarshal(rr.Body.Bytes(), &body)
+		return rr.Code, body
+	}
+	deliveries := func(hook string) []interface{} {
+		code, page := send("GET", hook+"/deliveries", nil)
+		assert.Equal(t, code, 200)
+		return page["data"].([]interface{})
+	}
+	deliver := func() {
+		err := server.DeliverWebhooks(context.Background())
+		if err != nil {
+			t.Fatalf("cannot deliver: %v", err)
+		}
+	}
+
+	code, _ := send("POST", "/api/v1/webhooks", url.Values{"url": {receiver.URL}, "events": {"post.created,post.exploded"}})
+	assert.Equal(t, code, 422)
+	code, _ = send("POST", "/api/v1/webhooks", url.Values{"url": {"ftp://example.com"}, "events": {"post.created"}})
+	assert.Equal(t, code, 422)
+	code, hook := send("POST", "/api/v1/webhooks", url.Values{
+		"url": {receiver.URL}, "events": {"post.created, post.deleted"}, "secret": {secret},
+	})
+	assert.Equal(t, code, 201)
+	assert.Equal(t, hook["secret"], secret)
+	hookURL := fmt.Sprintf("/api/v1/webhooks/%v", hook["id"])
+	code, hook = send("GET", hookURL, nil)
+	assert.Equal(t, code, 200)
+	assert.Equal(t, hook["secret"], nil)
+	assert.Equal(t, hook["events"], []interface{}{"post.created", "post.deleted"})
+
+	// Only the subscribed events are queued
+	code, created := send("POST", "/api/v1/posts", url.Values{
+		"title": {"Hooked"}, "content": {"Hooked"}, "author_id": {fmt.Sprint(post.AuthorID)}, "category_id": {fmt.Sprint(post.CategoryID)},
+	})
+	assert.Equal(t, code, 201)
+	code, _ = send("PUT", fmt.Sprintf("/api/v1/posts/%v", created["id"]), url.Values{
+		"title": {"Hooked again"}, "content": {"Hooked"}, "category_id": {fmt.Sprint(post.CategoryID)},
+	})
+	assert.Equal(t, code, 200)
+	assert.Equal(t, len(deliveries(hookURL)), 1)
+
+	// A failed delivery is retried after a backoff, not right away
+	deliver()
+	deliver()
+	assert.Equal(t, len(received), 1)
+	assert.Equal(t, received[0].Type, events.PostCreated)
+	assert.Equal(t, received[0].Data.(map[string]interface{})["title"], "Hooked")
+	logged := deliveries(hookURL)
+	failed := logged[0].(map[string]interface{})
+	assert.Equal(t, failed["status"], models.DeliveryPending)
+	assert.Equal(t, failed["attempts"], float64(1))
+	assert.Equal(t, failed["response_code"], float64(500))
+	assert.NotEqual(t, failed["next_attempt_at"], nil)
+
+	// Redelivering sends the same payload again as a new delivery
+	mu.Lock()
+	failing = false
+	mu.Unlock()
+	code, redelivery := send("POST", fmt.Sprintf("%s/deliveries/%v/redeliver", hookURL, failed["id"]), nil)
+	assert.Equal(t, code, 202)
+	deliver()
+	assert.Equal(t, len(received), 2)
+	assert.Equal(t, received[1], received[0])
+	logged = deliveries(hookURL)
+	assert.Equal(t, len(logged), 2)
+	assert.Equal(t, logged[0].(map[string]interface{})["id"], redelivery["id"])
+	assert.Equal(t, logged[0].(map[string]interface{})["status"], models.DeliveryDelivered)
+	assert.Equal(t, logged[1].(map[string]interface{})["status"], models.DeliveryPending)
+
+	code, _ = send("POST", fmt.Sprintf("%s/deliveries/999/redeliver", hookURL), nil)
+	assert.Equal(t, code, 404)
+
+	assert.Equal(t, webhooks.Backoff(1), 30*time.Second)
+	assert.Equal(t, webhooks.Backoff(3), 2*time.Minute)
+	assert.Equal(t, webhooks.Backoff(20), 4*time.Hour)
+
+	code, _ = send("DELETE", hookURL, nil)
+	assert.Equal(t, code, 204)
+	code, _ = send("GET", hookURL, nil)
+	assert.Equal(t, code, 404)
+}
@@ -0,0 +1,92 @@
+package modelstests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestCategoryTree(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	languages := models.Category{Name: "Languages"}
+	_, err = languages.SaveCategory(server.DB)
+	if err != nil {
+		t.Fatalf("cannot save category: %v", err)
+	}
+	golang := models.Category{Name: "Go", ParentID: &languages.ID}
+	_, err = golang.SaveCategory(server.DB)
+	if err != nil {
+		t.Fatalf("cannot save category: %v", err)
+	}
+	generics := models.Category{Name: "Generics", ParentID: &golang.ID}
+	_, err = generics.SaveCategory(server.DB)
+	if err != nil {
+		t.Fatalf("cannot save category: %v", err)
+	}
+	cooking := models.Category{Name: "Cooking"}
+	_, err = cooking.SaveCategory(server.DB)
+	if err != nil {
+		t.Fatalf("cannot save category: %v", err)
+	}
+
+	missing := uint32(999)
+	orphan := models.Category{Name: "Orphan", ParentID: &missing}
+	_, err = orphan.SaveCategory(server.DB)
+	assert.Equal(t, err, models.ErrCategoryNotFound)
+
+	tree, err := categortInstance.GetCategoryTree(server.DB)
+	if err != nil {
+		t.Fatalf("cannot get the category tree: %v", err)
+	}
+	assert.Equal(t, len(*tree), 2)
+	assert.Equal(t, (*tree)[0].Name, "Cooking")
+	assert.Equal(t, (*tree)[1].Name, "Languages")
+	assert.Equal(t, (*tree)[1].Children[0].Name, "Go")
+	assert.Equal(t, (*tree)[1].Children[0].Children[0].Name, "Generics")
+
+	found, err := categortInstance.FindCategoryById(server.DB, generics.ID)
+	if err != nil {
+		t.Fatalf("cannot find category: %v", err)
+	}
+	err = found.LoadBreadcrumbs(server.DB)
+	if err != nil {
+		t.Fatalf("cannot load breadcrumbs: %v", err)
+	}
+	assert.Equal(t, found.Breadcrumbs, []models.Breadcrumb{
+		{ID: languages.ID, Name: "Languages", Slug: "languages"},
+		{ID: golang.ID, Name: "Go", Slug: "go"},
+	})
+
+	descendants, err := models.CategoryDescendants(server.DB, languages.ID)
+	if err != nil {
+		t.Fatalf("cannot get descendants: %v", err)
+	}
+	assert.Equal(t, descendants, []uint32{languages.ID, golang.ID, generics.ID})
+
+	// Moving a category under its own descendant would make a loop
+	move := models.Category{Name: "Languages", ParentID: &generics.ID}
+	_, err = move.UpdateCategory(server.DB, languages.ID)
+	assert.Equal(t, err, models.ErrCategoryCycle)
+	move = models.Category{Name: "Languages", ParentID: &languages.ID}
+	_, err = move.UpdateCategory(server.DB, languages.ID)
+	assert.Equal(t, err, models.ErrCategoryCycle)
+
+	// Moving it anywhere else is fine
+	move = models.Category{Name: "Languages", ParentID: &cooking.ID}
+	_, err = move.UpdateCategory(server.DB, languages.ID)
+	if err != nil {
+		t.Fatalf("cannot move category: %v", err)
+	}
+	descendants, err = models.CategoryDescendants(server.DB, cooking.ID)
+	if err != nil {
+		t.Fatalf("cannot get descendants: %v", err)
+	}
+	assert.Equal(t, descendants, []uint32{cooking.ID, languages.ID, golang.ID, generics.ID})
+}
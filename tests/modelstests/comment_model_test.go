@@ -0,0 +1,113 @@
+package modelstests
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestInitialCommentStatus(t *testing.T) {
+
+	samples := []struct {
+		role      string
+		createdAt time.Time
+		status    string
+	}{
+		{role: models.RoleUser, createdAt: time.Now(), status: models.CommentPending},
+		{role: models.RoleUser, createdAt: time.Now().Add(-2 * models.NewAccountAge), status: models.CommentApproved},
+		{role: models.RoleModerator, createdAt: time.Now(), status: models.CommentApproved},
+	}
+
+	for _, v := range samples {
+		user := models.User{Role: v.role, CreatedAt: v.createdAt}
+		assert.Equal(t, models.InitialCommentStatus(&user), v.status)
+	}
+}
+
+func TestEditedCommentStatus(t *testing.T) {
+
+	samples := []struct {
+		role      string
+		createdAt time.Time
+		status    string
+		edited    string
+	}{
+		{role: models.RoleUser, createdAt: time.Now(), status: models.CommentApproved, edited: models.CommentPending},
+		{role: models.RoleUser, createdAt: time.Now().Add(-2 * models.NewAccountAge), status: models.CommentApproved, edited: models.CommentApproved},
+		{role: models.RoleUser, createdAt: time.Now().Add(-2 * models.NewAccountAge), status: models.CommentRejected, edited: models.CommentPending},
+		{role: models.RoleModerator, createdAt: time.Now(), status: models.CommentRejected, edited: models.CommentApproved},
+	}
+
+	for _, v := range samples {
+		user := models.User{Role: v.role, CreatedAt: v.createdAt}
+		assert.Equal(t, models.EditedCommentStatus(&user, v.status), v.edited)
+	}
+}
+
+func TestPostCommentThreads(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error seeding tables %v\n", err)
+	}
+
+	root := models.Comment{PostID: post.ID, AuthorID: post.AuthorID, Body: "First", Status: models.CommentApproved}
+	_, err = root.SaveComment(server.DB)
+	if err != nil {
+		log.Fatalf("Cannot seed comment %v\n", err)
+	}
+	reply := models.Comment{PostID: post.ID, AuthorID: post.AuthorID, ParentID: &root.ID, Body: "Reply", Status: models.CommentApproved}
+	_, err = reply.SaveComment(server.DB)
+	if err != nil {
+		log.Fatalf("Cannot seed comment %v\n", err)
+	}
+	pending := models.Comment{PostID: post.ID, AuthorID: post.AuthorID, Body: "Held", Status: models.CommentPending}
+	_, err = pending.SaveComment(server.DB)
+	if err != nil {
+		log.Fatalf("Cannot seed comment %v\n", err)
+	}
+
+	commentInstance := models.Comment{}
+
+	// Other readers don't see the pending comment
+	threads, err := commentInstance.GetPostComments(server.DB, post.ID, 0)
+	if err != nil {
+		t.Errorf("this is the error getting the comments: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*threads), 1)
+	assert.Equal(t, len((*threads)[0].Replies), 1)
+	assert.Equal(t, (*threads)[0].Replies[0].Body, "Reply")
+
+	// Its author does
+	threads, err = commentInstance.GetPostComments(server.DB, post.ID, post.AuthorID)
+	if err != nil {
+		t.Errorf("this is the error getting the comments: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*threads), 2)
+
+	// Deleting a comment with replies keeps a placeholder
+	_, err = commentInstance.DeleteComment(server.DB, root.ID)
+	if err != nil {
+		t.Errorf("this is the error deleting the comment: %v\n", err)
+		return
+	}
+	threads, err = commentInstance.GetPostComments(server.DB, post.ID, 0)
+	if err != nil {
+		t.Errorf("this is the error getting the comments: %v\n", err)
+		return
+	}
+	assert.Equal(t, (*threads)[0].Status, models.CommentDeleted)
+	assert.Equal(t, (*threads)[0].Body, "")
+	assert.Equal(t, (*threads)[0].AuthorID, uint32(0))
+	assert.Equal(t, (*threads)[0].Author, (*models.Author)(nil))
+	assert.Equal(t, len((*threads)[0].Replies), 1)
+}
@@ -3,6 +3,7 @@ package modelstests
 import (
 	"log"
 	"testing"
+	"time"
 
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/rizalreza/golang-restful/api/models"
@@ -134,3 +135,175 @@ func TestDeleteAPost(t *testing.T) {
 	//Can be done this way too
 	assert.Equal(t, isDeleted, int64(1))
 }
+
+// queryCounter is a gorm logger that counts the SQL statements it is given
+type queryCounter struct {
+	count int
+}
+
+func (c *queryCounter) Print(values ...interface{}) {
+	if len(values) > 0 && values[0] == "sql" {
+		c.count++
+	}
+}
+
+func TestFindAllPostsQueryCount(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table %v\n", err)
+	}
+	_, _, _, err = SeedUsersCategoriesAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding user and post  table %v\n", err)
+	}
+
+	samples := []struct {
+		includes []string
+		queries  int
+	}{
+		{includes: []string{}, queries: 1},
+		{includes: []string{"Author"}, queries: 2},
+		{includes: []string{"Author", "Category"}, queries: 3},
+	}
+
+	for _, v := range samples {
+		counter := &queryCounter{}
+		db := server.DB.New()
+		db.SetLogger(counter)
+
+		posts, err := postInstance.GetAllPost(db, v.includes...)
+		if err != nil {
+			t.Errorf("this is the error getting the posts: %v\n", err)
+			return
+		}
+		assert.Equal(t, len(*posts), 2)
+		assert.Equal(t, counter.count, v.queries)
+		for _, post := range *posts {
+			assert.Equal(t, post.Author != nil, len(v.includes) > 0)
+			if post.Author != nil {
+				assert.Equal(t, post.Author.ID, post.AuthorID)
+			}
+		}
+	}
+}
+
+func TestPublishDuePosts(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table: %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error Seeding table")
+	}
+
+	publishAt := time.Now().Add(time.Hour)
+	err = post.SetStatus(models.PostPublished, &publishAt)
+	if err != nil {
+		t.Errorf("this is the error scheduling the post: %v\n", err)
+		return
+	}
+	assert.Equal(t, post.Status, models.PostScheduled)
+	_, err = post.UpdatePostStatus(server.DB)
+	if err != nil {
+		t.Errorf("this is the error scheduling the post: %v\n", err)
+		return
+	}
+
+	// Scheduled posts are hidden from everyone but their author
+	visible, err := postInstance.GetAllPost(server.DB.Scopes(models.PostsVisibleTo(0)))
+	if err != nil {
+		t.Errorf("this is the error getting the posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*visible), 0)
+	visible, err = postInstance.GetAllPost(server.DB.Scopes(models.PostsVisibleTo(post.AuthorID)))
+	if err != nil {
+		t.Errorf("this is the error getting the posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*visible), 1)
+
+	published, err := models.PublishDuePosts(server.DB, time.Now())
+	if err != nil {
+		t.Errorf("this is the error publishing the posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(published), 0)
+
+	// Once due the post is published, and only once
+	published, err = models.PublishDuePosts(server.DB, publishAt.Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error publishing the posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(published), 1)
+	published, err = models.PublishDuePosts(server.DB, publishAt.Add(time.Minute))
+	if err != nil {
+		t.Errorf("this is the error publishing the posts: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(published), 0)
+}
+
+func TestPostMarkdownContent(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table: %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error Seeding table")
+	}
+
+	samples := []struct {
+		content string
+		html    string
+		excerpt string
+	}{
+		{
+			content: "Tom & Jerry <3 \"quotes\"",
+			html:    "<p>Tom &amp; Jerry &lt;3 &#34;quotes&#34;</p>\n",
+			excerpt: "Tom & Jerry <3 \"quotes\"",
+		},
+		{
+			content: "## Heading\n\nA [link](https://example.com) <script>alert(1)</script>",
+			html:    "<h2>Heading</h2>\n<p>A <a href=\"https://example.com\" rel=\"nofollow\">link</a> alert(1)</p>\n",
+			excerpt: "Heading A link alert(1)",
+		},
+		{
+			content: "[click](javascript:alert(1))",
+			html:    "<p>click</p>\n",
+			excerpt: "click",
+		},
+	}
+
+	for _, v := range samples {
+		postUpdate := models.Post{
+			ID:         post.ID,
+			Title:      post.Title,
+			Content:    v.content,
+			AuthorID:   post.AuthorID,
+			CategoryID: post.CategoryID,
+		}
+		postUpdate.Prepare()
+		postUpdate.ID = post.ID
+		_, err = postUpdate.UpdatePost(server.DB)
+		if err != nil {
+			t.Errorf("this is the error updating the post: %v\n", err)
+			return
+		}
+
+		foundPost, err := (&models.Post{}).FindPostById(server.DB, post.ID)
+		if err != nil {
+			t.Errorf("this is the error getting the post: %v\n", err)
+			return
+		}
+		assert.Equal(t, foundPost.Content, v.content)
+		assert.Equal(t, foundPost.ContentHTML, v.html)
+		assert.Equal(t, foundPost.Excerpt, v.excerpt)
+	}
+}
@@ -0,0 +1,76 @@
+package modelstests
+
+import (
+	"log"
+	"testing"
+
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/rizalreza/golang-restful/api/models"
+	"github.com/rizalreza/golang-restful/api/utils/diff"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestPostRevisions(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table: %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error Seeding table")
+	}
+
+	postUpdate := models.Post{
+		ID:         post.ID,
+		Title:      post.Title,
+		Content:    post.Content + "\nA second line",
+		AuthorID:   post.AuthorID,
+		CategoryID: post.CategoryID,
+	}
+	_, err = postUpdate.UpdatePost(server.DB)
+	if err != nil {
+		t.Errorf("this is the error updating the post: %v\n", err)
+		return
+	}
+
+	// The seeded post had no history, so its original text is kept as revision 1
+	revision := models.PostRevision{}
+	revisions, err := revision.GetPostRevisions(server.DB, post.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the revisions: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*revisions), 2)
+	assert.Equal(t, (*revisions)[0].Number, uint32(2))
+	assert.Equal(t, (*revisions)[0].Changed, []string{"content"})
+	assert.Equal(t, (*revisions)[1].Content, post.Content)
+
+	// Saving without changes does not add a revision
+	_, err = postUpdate.UpdatePost(server.DB)
+	if err != nil {
+		t.Errorf("this is the error updating the post: %v\n", err)
+		return
+	}
+	revisions, _ = revision.GetPostRevisions(server.DB, post.ID)
+	assert.Equal(t, len(*revisions), 2)
+
+	first, _ := (&models.PostRevision{}).FindPostRevision(server.DB, post.ID, 1)
+	second, _ := (&models.PostRevision{}).FindPostRevision(server.DB, post.ID, 2)
+	difference := models.DiffPostRevisions(first, second)
+	assert.Equal(t, difference.Content, []diff.Line{
+		{Op: diff.Equal, Text: post.Content},
+		{Op: diff.Insert, Text: "A second line"},
+	})
+
+	restored, err := first.RestorePostRevision(server.DB, post.AuthorID)
+	if err != nil {
+		t.Errorf("this is the error restoring the revision: %v\n", err)
+		return
+	}
+	assert.Equal(t, restored.Content, post.Content)
+
+	revisions, _ = revision.GetPostRevisions(server.DB, post.ID)
+	assert.Equal(t, len(*revisions), 3)
+	assert.Equal(t, *(*revisions)[0].RestoredFrom, uint32(1))
+}
@@ -0,0 +1,98 @@
+package modelstests
+
+import (
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestReactions(t *testing.T) {
+
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = seedUsers()
+	if err != nil {
+		log.Fatal(err)
+	}
+	other := models.Post{Title: "Another post", Content: "Nobody reacts to this one", AuthorID: post.AuthorID, CategoryID: post.CategoryID}
+	_, err = other.SavePost(server.DB)
+	if err != nil {
+		t.Fatalf("cannot save post: %v", err)
+	}
+
+	// Every user likes the post twice at once, and loves it once
+	var wg sync.WaitGroup
+	errs := make(chan error, 9)
+	added := make(chan bool, 9)
+	for _, uid := range []uint32{1, 2, 3} {
+		for _, reaction := range []string{"like", "like", "love"} {
+			wg.Add(1)
+			go func(uid uint32, reaction string) {
+				defer wg.Done()
+				ok, err := models.React(server.DB, post.ID, uid, reaction)
+				added <- ok
+				errs <- err
+			}(uid, reaction)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	close(added)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("cannot react: %v", err)
+		}
+	}
+	// Only the first of the same reactions is added
+	adds := 0
+	for ok := range added {
+		if ok {
+			adds++
+		}
+	}
+	assert.Equal(t, adds, 6)
+
+	rows := 0
+	server.DB.Model(&models.Reaction{}).Where("post_id = ?", post.ID).Count(&rows)
+	assert.Equal(t, rows, 6)
+	summary, err := models.GetReactionSummary(server.DB, post.ID, 2)
+	if err != nil {
+		t.Fatalf("cannot get the reactions: %v", err)
+	}
+	assert.Equal(t, summary.Total, 6)
+	assert.Equal(t, summary.Counts, map[string]int{"like": 3, "love": 3})
+	assert.Equal(t, summary.Reacted, []string{"like", "love"})
+
+	_, err = models.React(server.DB, post.ID, 2, "meh")
+	assert.Equal(t, err, models.ErrInvalidReaction)
+
+	// Taking a reaction off twice only counts once
+	for i := 0; i < 2; i++ {
+		err = models.Unreact(server.DB, post.ID, 2, "like")
+		if err != nil {
+			t.Fatalf("cannot unreact: %v", err)
+		}
+	}
+	posts := []models.Post{post, other}
+	err = models.LoadReactions(server.DB, posts, 2)
+	if err != nil {
+		t.Fatalf("cannot load the reactions: %v", err)
+	}
+	assert.Equal(t, posts[0].Reactions, map[string]int{"like": 2, "love": 3})
+	assert.Equal(t, posts[0].Reacted, []string{"love"})
+	assert.Equal(t, posts[1].Reactions, map[string]int{})
+
+	// The older post comes first because it is the popular one
+	popular, err := postInstance.GetAllPost(server.DB.Scopes(models.PostsByPopularity))
+	if err != nil {
+		t.Fatalf("cannot get the posts: %v", err)
+	}
+	assert.Equal(t, (*popular)[0].ID, post.ID)
+	assert.Equal(t, (*popular)[0].ReactionCount, 5)
+	assert.Equal(t, (*popular)[1].ID, other.ID)
+}
@@ -0,0 +1,133 @@
+package modelstests
+
+import (
+	"log"
+	"testing"
+
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestFindOrCreateTags(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+
+	tags, err := models.FindOrCreateTags(server.DB, []string{"  Go   Lang ", "go lang", "Crème Brûlée"})
+	if err != nil {
+		t.Errorf("this is the error creating the tags: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(tags), 2)
+	assert.Equal(t, tags[0].Name, "go lang")
+	assert.Equal(t, tags[0].Slug, "go-lang")
+	assert.Equal(t, tags[1].Slug, "creme-brulee")
+
+	// Existing tags are reused
+	again, err := models.FindOrCreateTags(server.DB, []string{"GO LANG"})
+	if err != nil {
+		t.Errorf("this is the error finding the tags: %v\n", err)
+		return
+	}
+	assert.Equal(t, again[0].ID, tags[0].ID)
+}
+
+func TestPostsTagged(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	_, _, posts, err := SeedUsersCategoriesAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding tables %v\n", err)
+	}
+
+	tags, err := models.FindOrCreateTags(server.DB, []string{"go", "web"})
+	if err != nil {
+		log.Fatalf("Cannot seed tags %v\n", err)
+	}
+	// The first post has both tags, the second only "web"
+	err = server.DB.Model(&posts[0]).Association("Tags").Replace(tags).Error
+	if err != nil {
+		log.Fatalf("Cannot tag post %v\n", err)
+	}
+	err = server.DB.Model(&posts[1]).Association("Tags").Replace(tags[1:]).Error
+	if err != nil {
+		log.Fatalf("Cannot tag post %v\n", err)
+	}
+
+	samples := []struct {
+		slugs    []string
+		matchAll bool
+		count    int
+	}{
+		{slugs: []string{"go"}, matchAll: false, count: 1},
+		{slugs: []string{"go", "web"}, matchAll: false, count: 2},
+		{slugs: []string{"go", "web"}, matchAll: true, count: 1},
+		{slugs: []string{}, matchAll: true, count: 2},
+	}
+
+	for _, v := range samples {
+		found, err := postInstance.GetAllPost(server.DB.Scopes(models.PostsTagged(v.slugs, v.matchAll)), "Tags")
+		if err != nil {
+			t.Errorf("this is the error getting the posts: %v\n", err)
+			return
+		}
+		assert.Equal(t, len(*found), v.count)
+	}
+
+	tagInstance := models.Tag{}
+	counted, err := tagInstance.GetAllTags(server.DB)
+	if err != nil {
+		t.Errorf("this is the error getting the tags: %v\n", err)
+		return
+	}
+	assert.Equal(t, (*counted)[0].Slug, "web")
+	assert.Equal(t, (*counted)[0].PostCount, uint32(2))
+	assert.Equal(t, (*counted)[1].PostCount, uint32(1))
+}
+
+func TestTagsCountPublishedPosts(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing tables %v\n", err)
+	}
+	_, _, posts, err := SeedUsersCategoriesAndPosts()
+	if err != nil {
+		log.Fatalf("Error seeding tables %v\n", err)
+	}
+	tags, err := models.FindOrCreateTags(server.DB, []string{"go", "drafts"})
+	if err != nil {
+		log.Fatalf("Cannot seed tags %v\n", err)
+	}
+
+	// The first post is published, the second a draft
+	err = server.DB.Model(&posts[0]).Association("Tags").Replace(tags[:1]).Error
+	if err != nil {
+		log.Fatalf("Cannot tag post %v\n", err)
+	}
+	err = server.DB.Model(&posts[1]).Association("Tags").Replace(tags).Error
+	if err != nil {
+		log.Fatalf("Cannot tag post %v\n", err)
+	}
+	err = server.DB.Model(&models.Post{}).Where("id = ?", posts[1].ID).UpdateColumn("status", models.PostDraft).Error
+	if err != nil {
+		log.Fatalf("Cannot unpublish post %v\n", err)
+	}
+
+	tagInstance := models.Tag{}
+	counted, err := tagInstance.GetAllTags(server.DB)
+	if err != nil {
+		t.Errorf("this is the error getting the tags: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(*counted), 2)
+	assert.Equal(t, (*counted)[0].Slug, "go")
+	assert.Equal(t, (*counted)[0].PostCount, uint32(1))
+	assert.Equal(t, (*counted)[1].Slug, "drafts")
+	assert.Equal(t, (*counted)[1].PostCount, uint32(0))
+}
@@ -0,0 +1,90 @@
+package modelstests
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	_ "github.com/jinzhu/gorm/dialects/mysql"
+	"github.com/rizalreza/golang-restful/api/models"
+	"gopkg.in/go-playground/assert.v1"
+)
+
+func TestTrashAndRestoreUser(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table: %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error Seeding table")
+	}
+
+	user := models.User{}
+	_, err = user.DeleteUser(server.DB, post.AuthorID)
+	if err != nil {
+		t.Errorf("this is the error deleting the user: %v\n", err)
+		return
+	}
+
+	// The posts of a deleted user go to the trash with them
+	_, err = (&models.Post{}).FindPostById(server.DB, post.ID)
+	assert.NotEqual(t, err, nil)
+
+	trash, err := models.GetTrash(server.DB, &models.User{Role: models.RoleAdmin})
+	if err != nil {
+		t.Errorf("this is the error getting the trash: %v\n", err)
+		return
+	}
+	assert.Equal(t, len(trash.Users), 1)
+	assert.Equal(t, len(trash.Posts), 1)
+
+	_, err = user.RestoreUser(server.DB, post.AuthorID)
+	if err != nil {
+		t.Errorf("this is the error restoring the user: %v\n", err)
+		return
+	}
+	foundPost, err := (&models.Post{}).FindPostById(server.DB, post.ID)
+	if err != nil {
+		t.Errorf("this is the error getting the post: %v\n", err)
+		return
+	}
+	assert.Equal(t, foundPost.DeletedAt == nil, true)
+}
+
+func TestPurgeTrash(t *testing.T) {
+
+	err := refreshUserCategoryAndPostTable()
+	if err != nil {
+		log.Fatalf("Error refreshing user and post table: %v\n", err)
+	}
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatalf("Error Seeding table")
+	}
+
+	_, err = postInstance.DeletePost(server.DB, post.ID, post.AuthorID)
+	if err != nil {
+		t.Errorf("this is the error deleting the post: %v\n", err)
+		return
+	}
+
+	// Nothing is old enough yet
+	purged, err := models.PurgeTrash(server.DB, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Errorf("this is the error purging the trash: %v\n", err)
+		return
+	}
+	assert.Equal(t, purged, int64(0))
+
+	purged, err = models.PurgeTrash(server.DB, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Errorf("this is the error purging the trash: %v\n", err)
+		return
+	}
+	assert.Equal(t, purged, int64(1))
+
+	_, err = (&models.Post{}).RestorePost(server.DB, post.ID)
+	assert.NotEqual(t, err, nil)
+}
@@ -1,6 +1,7 @@
 package modelstests
 
 import (
+	"encoding/json"
 	"log"
 	"testing"
 
@@ -95,3 +96,34 @@ func TestDeleteUser(t *testing.T) {
 	}
 	assert.Equal(t, isDeleted, int64(1))
 }
+
+func TestEncodeUsers(t *testing.T) {
+	post, err := seedOneUserOneCategoryAndOnePost()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Authors nested in a post only show their public profile
+	found, err := postInstance.FindPostById(server.DB, post.ID, "Author")
+	if err != nil {
+		t.Errorf("this is the error getting the post: %v\n", err)
+		return
+	}
+	encoded, err := json.Marshal(found)
+	assert.Equal(t, err, nil)
+	decoded := map[string]map[string]interface{}{}
+	json.Unmarshal(encoded, &decoded)
+	assert.Equal(t, decoded["author"]["username"], found.Author.Username)
+	_, ok := decoded["author"]["email"]
+	assert.Equal(t, ok, false)
+
+	// Users themselves encode in full, but for their password
+	encoded, err = json.Marshal(found.Author.User)
+	assert.Equal(t, err, nil)
+	user := map[string]interface{}{}
+	json.Unmarshal(encoded, &user)
+	assert.Equal(t, user["email"], found.Author.Email)
+	assert.Equal(t, user["role"], models.RoleUser)
+	_, ok = user["password"]
+	assert.Equal(t, ok, false)
+}